@@ -0,0 +1,187 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/forkchoice"
+	"github.com/devlongs/gean/storage"
+)
+
+// ErrUnknownParent is returned when importing a block whose parent has not
+// been imported.
+var ErrUnknownParent = errors.New("unknown parent block")
+
+// Chain imports blocks: it verifies signatures, runs the state transition,
+// stores the block and post-state and updates fork choice.
+type Chain struct {
+	db       storage.Store
+	fc       *forkchoice.Store
+	pruner   *Pruner
+	verifier signature.Verifier
+	workers  int
+
+	// mu serializes imports.
+	mu sync.Mutex
+}
+
+// New starts a chain at anchor. A nil verifier disables signature checks.
+func New(anchor *Anchor, db storage.Store, verifier signature.Verifier, workers int) *Chain {
+	fc := anchor.Init(db)
+	return &Chain{
+		db:       db,
+		fc:       fc,
+		pruner:   NewPruner(fc, db, false),
+		verifier: verifier,
+		workers:  workers,
+	}
+}
+
+func (c *Chain) ForkChoice() *forkchoice.Store { return c.fc }
+
+func (c *Chain) Storage() storage.Store { return c.db }
+
+// ImportBlock imports a block whose parent is known. Importing a known
+// block is a no-op.
+func (c *Chain) ImportBlock(ctx context.Context, signed *types.SignedBlockWithAttestation) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	block := &signed.Message.Block
+	root := BlockRoot(block)
+	if c.fc.HasBlock(root) {
+		return nil
+	}
+	pre, ok := c.db.GetState(block.ParentRoot)
+	if !ok || !c.fc.HasBlock(block.ParentRoot) {
+		return fmt.Errorf("%w %x", ErrUnknownParent, block.ParentRoot[:4])
+	}
+	if c.verifier != nil {
+		if err := VerifyBlockSignatures(ctx, pre, signed, c.workers, c.verifier); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBlock, err)
+		}
+	}
+	post, err := StateTransition(pre, block)
+	if err != nil {
+		return err
+	}
+
+	c.db.PutBlock(root, signed)
+	c.db.PutState(root, post)
+	if err := c.fc.AddBlock(root, block.ParentRoot, block.Slot); err != nil {
+		return err
+	}
+	for i := range block.Body.Attestations {
+		att := &block.Body.Attestations[i]
+		for _, v := range participantIndices(att.AggregationBits) {
+			c.fc.ProcessAttestation(v, att.Data.Head)
+		}
+	}
+	proposerAtt := &signed.Message.ProposerAttestation
+	c.fc.ProcessAttestation(proposerAtt.ValidatorID, proposerAtt.Data.Head)
+
+	c.fc.UpdateCheckpoints(post.LatestJustified, post.LatestFinalized)
+	// The block is imported at this point; a failed prune only leaves stale
+	// entries behind and must not be blamed on whoever sent the block.
+	if _, err := c.pruner.OnFinalized(c.fc.Finalized()); err != nil {
+		log.Printf("chain: prune at finalized slot %d: %v", c.fc.Finalized().Slot, err)
+	}
+	return nil
+}
+
+func (c *Chain) HasBlock(root types.Root) bool { return c.fc.HasBlock(root) }
+
+func (c *Chain) Finalized() types.Checkpoint { return c.fc.Finalized() }
+
+func (c *Chain) Justified() types.Checkpoint { return c.fc.Justified() }
+
+// Head returns the fork choice head.
+func (c *Chain) Head() types.Checkpoint {
+	root := c.fc.Head()
+	node, _ := c.fc.Node(root)
+	return types.Checkpoint{Root: root, Slot: node.Slot}
+}
+
+// SafeTarget is the latest block that a two-thirds majority of validators
+// vote for, directly or through descendants.
+func (c *Chain) SafeTarget() types.Checkpoint {
+	n := c.NumValidators()
+	root := c.fc.SafeTarget((2*n + 2) / 3)
+	node, _ := c.fc.Node(root)
+	return types.Checkpoint{Root: root, Slot: node.Slot}
+}
+
+// HeadState returns the post-state of the head block.
+func (c *Chain) HeadState() *types.State {
+	s, _ := c.db.GetState(c.fc.Head())
+	return s
+}
+
+// NumValidators is the size of the registry at the head.
+func (c *Chain) NumValidators() uint64 {
+	if s := c.HeadState(); s != nil {
+		return uint64(len(s.Validators))
+	}
+	return 0
+}
+
+// ValidatorPubkey returns the public key of a validator in the head state.
+func (c *Chain) ValidatorPubkey(index types.ValidatorIndex) (types.Bytes52, bool) {
+	s := c.HeadState()
+	if s == nil || uint64(index) >= uint64(len(s.Validators)) {
+		return types.Bytes52{}, false
+	}
+	return s.Validators[index].Pubkey, true
+}
+
+// ValidatorPubkeyAt returns the public key of a validator in the post-state
+// of the block root, if that state is still stored.
+func (c *Chain) ValidatorPubkeyAt(root types.Root, index types.ValidatorIndex) (types.Bytes52, bool) {
+	s, ok := c.db.GetState(root)
+	if !ok || uint64(index) >= uint64(len(s.Validators)) {
+		return types.Bytes52{}, false
+	}
+	return s.Validators[index].Pubkey, true
+}
+
+func (c *Chain) Block(root types.Root) (*types.SignedBlockWithAttestation, bool) {
+	return c.db.GetBlock(root)
+}
+
+// BlocksByRange returns the canonical blocks with slots in
+// [start, start+count). The head state's historical roots index the
+// canonical chain by slot, so the cost depends on count only. Blocks not
+// stored, such as those below a checkpoint anchor that are not backfilled
+// yet, are left out.
+func (c *Chain) BlocksByRange(start types.Slot, count uint64) []*types.SignedBlockWithAttestation {
+	// The head is resolved once: a concurrent import must not pair one
+	// head's slot with another head's historical roots.
+	head := c.Head()
+	state, ok := c.db.GetState(head.Root)
+	if !ok || count == 0 || start > head.Slot {
+		return nil
+	}
+	end := head.Slot
+	if uint64(end-start) >= count {
+		end = start + types.Slot(count-1)
+	}
+	var blocks []*types.SignedBlockWithAttestation
+	for slot := start; slot <= end; slot++ {
+		root := head.Root
+		if slot < head.Slot {
+			if uint64(slot) >= uint64(len(state.HistoricalRoots)) || state.HistoricalRoots[slot].IsZero() {
+				continue
+			}
+			root = state.HistoricalRoots[slot]
+		}
+		if b, ok := c.db.GetBlock(root); ok {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
@@ -0,0 +1,83 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/storage"
+)
+
+// buildChain returns signed blocks for the given slots on top of anchor.
+func buildChain(t *testing.T, anchor *Anchor, slots ...types.Slot) []*types.SignedBlockWithAttestation {
+	t.Helper()
+	var blocks []*types.SignedBlockWithAttestation
+	state := anchor.State
+	for _, slot := range slots {
+		block, post, err := BuildBlock(state, slot, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, &types.SignedBlockWithAttestation{
+			Message: types.BlockWithAttestation{Block: *block},
+		})
+		state = post
+	}
+	return blocks
+}
+
+func TestImportBlocks(t *testing.T) {
+	anchor := Genesis(1700000000, testValidators(4))
+	c := New(anchor, storage.NewMemoryStore(), nil, 1)
+	blocks := buildChain(t, anchor, 1, 2, 4, 5)
+
+	if err := c.ImportBlock(context.Background(), blocks[1]); !errors.Is(err, ErrUnknownParent) {
+		t.Errorf("expected ErrUnknownParent, got %v", err)
+	}
+	for _, b := range blocks {
+		if err := c.ImportBlock(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Importing again is a no-op.
+	if err := c.ImportBlock(context.Background(), blocks[0]); err != nil {
+		t.Error(err)
+	}
+
+	head := c.Head()
+	if head.Slot != 5 || head.Root != BlockRoot(&blocks[3].Message.Block) {
+		t.Errorf("unexpected head %+v", head)
+	}
+	if c.NumValidators() != 4 {
+		t.Error("unexpected validator count")
+	}
+
+	got := c.BlocksByRange(2, 3)
+	if len(got) != 2 || got[0].Message.Block.Slot != 2 || got[1].Message.Block.Slot != 4 {
+		t.Errorf("unexpected range %v", got)
+	}
+	if got := c.BlocksByRange(0, 100); len(got) != 5 {
+		t.Errorf("expected genesis and 4 blocks, got %d", len(got))
+	}
+	if got := c.BlocksByRange(5, 1); len(got) != 1 || got[0] != blocks[3] {
+		t.Error("expected the head block")
+	}
+	if got := c.BlocksByRange(6, 10); len(got) != 0 {
+		t.Errorf("expected no blocks past the head, got %d", len(got))
+	}
+}
+
+func TestImportRejectsInvalidBlock(t *testing.T) {
+	anchor := Genesis(1700000000, testValidators(4))
+	c := New(anchor, storage.NewMemoryStore(), nil, 1)
+	blocks := buildChain(t, anchor, 1)
+	blocks[0].Message.Block.StateRoot = types.Root{1}
+
+	if err := c.ImportBlock(context.Background(), blocks[0]); !errors.Is(err, ErrInvalidBlock) {
+		t.Errorf("expected ErrInvalidBlock, got %v", err)
+	}
+	if c.HasBlock(BlockRoot(&blocks[0].Message.Block)) {
+		t.Error("invalid block imported")
+	}
+}
@@ -0,0 +1,87 @@
+package chain
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/forkchoice"
+	"github.com/devlongs/gean/storage"
+)
+
+// Anchor is a trusted finalized state and the block that produced it, used
+// to start the node without syncing from genesis.
+//
+// History below the anchor is not needed to follow the chain; blocks before
+// it are backfilled later, walking back from BackfillRoot.
+type Anchor struct {
+	State *types.State
+	Block *types.SignedBlockWithAttestation
+	Root  types.Root
+}
+
+// BlockRoot returns the hash tree root of a block.
+func BlockRoot(b *types.Block) types.Root {
+	return ssz.HashTreeRootBlock(b, types.AttestationsLimit)
+}
+
+// StateRoot returns the hash tree root of a state.
+func StateRoot(s *types.State) types.Root {
+	return ssz.HashTreeRootState(s, types.HistoricalRootsLimit, types.ValidatorRegistryLimit)
+}
+
+// NewAnchor checks that the block commits to the state and returns the
+// resulting anchor.
+func NewAnchor(state *types.State, block *types.SignedBlockWithAttestation) (*Anchor, error) {
+	b := &block.Message.Block
+	if b.Slot != state.Slot {
+		return nil, fmt.Errorf("block slot %d does not match state slot %d", b.Slot, state.Slot)
+	}
+	if stateRoot := StateRoot(state); b.StateRoot != stateRoot {
+		return nil, fmt.Errorf("block state root %x does not match state root %x", b.StateRoot[:4], stateRoot[:4])
+	}
+	return &Anchor{State: state, Block: block, Root: BlockRoot(b)}, nil
+}
+
+// LoadCheckpoint reads an SSZ-encoded state and signed block from disk and
+// validates them as an anchor.
+func LoadCheckpoint(statePath, blockPath string) (*Anchor, error) {
+	stateBytes, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint state: %w", err)
+	}
+	state, err := ssz.UnmarshalState(stateBytes, types.HistoricalRootsLimit, types.ValidatorRegistryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("decode checkpoint state: %w", err)
+	}
+
+	blockBytes, err := os.ReadFile(blockPath)
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint block: %w", err)
+	}
+	block, err := ssz.UnmarshalSignedBlockWithAttestation(blockBytes, types.AttestationsLimit, types.ValidatorRegistryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("decode checkpoint block: %w", err)
+	}
+
+	return NewAnchor(state, block)
+}
+
+// Checkpoint returns the anchor as a checkpoint.
+func (a *Anchor) Checkpoint() types.Checkpoint {
+	return types.Checkpoint{Root: a.Root, Slot: a.Block.Message.Block.Slot}
+}
+
+// BackfillRoot is the first block missing below the anchor.
+func (a *Anchor) BackfillRoot() types.Root {
+	return a.Block.Message.Block.ParentRoot
+}
+
+// Init stores the anchor block and state and returns a fork choice store
+// rooted at the anchor checkpoint.
+func (a *Anchor) Init(db storage.Store) *forkchoice.Store {
+	db.PutBlock(a.Root, a.Block)
+	db.PutState(a.Root, a.State)
+	return forkchoice.NewStore(a.Checkpoint(), a.BackfillRoot())
+}
@@ -0,0 +1,95 @@
+package chain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/storage"
+)
+
+func testAnchor() (*types.State, *types.SignedBlockWithAttestation) {
+	justifiedSlots, _ := types.BitlistFromBits([]bool{true}, types.HistoricalRootsLimit)
+	votes, _ := types.BitlistFromBits(nil, types.HistoricalRootsLimit*types.ValidatorRegistryLimit)
+	state := &types.State{
+		Config:             types.Config{GenesisTime: 1700000000},
+		Slot:               types.Slot(8),
+		LatestBlockHeader:  types.BlockHeader{Slot: 8, ParentRoot: types.Root{7}},
+		LatestFinalized:    types.Checkpoint{Root: types.Root{4}, Slot: 4},
+		HistoricalRoots:    []types.Root{{1}, {2}},
+		JustifiedSlots:     justifiedSlots,
+		Validators:         []types.Validator{{Pubkey: types.Bytes52{0xaa}}},
+		JustificationVotes: votes,
+	}
+	block := &types.SignedBlockWithAttestation{}
+	block.Message.Block.Slot = 8
+	block.Message.Block.ParentRoot = types.Root{7}
+	block.Message.Block.StateRoot = StateRoot(state)
+	return state, block
+}
+
+func TestNewAnchor(t *testing.T) {
+	state, block := testAnchor()
+	anchor, err := NewAnchor(state, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anchor.Checkpoint().Slot != 8 || anchor.Root != BlockRoot(&block.Message.Block) {
+		t.Error("anchor checkpoint")
+	}
+
+	db := storage.NewMemoryStore()
+	fc := anchor.Init(db)
+	if fc.Finalized() != anchor.Checkpoint() || fc.Justified() != anchor.Checkpoint() {
+		t.Error("fork choice should be anchored at the checkpoint")
+	}
+	if fc.Head() != anchor.Root {
+		t.Error("head should be the anchor")
+	}
+	if _, ok := db.GetState(anchor.Root); !ok {
+		t.Error("anchor state should be stored")
+	}
+	if anchor.BackfillRoot() != (types.Root{7}) {
+		t.Error("backfill should start at the anchor parent")
+	}
+}
+
+func TestNewAnchorRejectsMismatch(t *testing.T) {
+	state, block := testAnchor()
+	block.Message.Block.StateRoot[0] ^= 1
+	if _, err := NewAnchor(state, block); err == nil {
+		t.Error("expected state root mismatch")
+	}
+
+	state, block = testAnchor()
+	block.Message.Block.Slot = 9
+	if _, err := NewAnchor(state, block); err == nil {
+		t.Error("expected slot mismatch")
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	state, block := testAnchor()
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.ssz")
+	blockPath := filepath.Join(dir, "block.ssz")
+	if err := os.WriteFile(statePath, ssz.MarshalState(state), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(blockPath, ssz.MarshalSignedBlockWithAttestation(block), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	anchor, err := LoadCheckpoint(statePath, blockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anchor.State.Slot != 8 {
+		t.Error("loaded state")
+	}
+	if _, err := LoadCheckpoint(filepath.Join(dir, "missing"), blockPath); err == nil {
+		t.Error("expected error for missing state file")
+	}
+}
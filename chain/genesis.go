@@ -0,0 +1,37 @@
+package chain
+
+import (
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+)
+
+// GenesisState builds the state at slot 0 for the given validators.
+func GenesisState(genesisTime uint64, validators []types.Validator) *types.State {
+	emptyBody := types.BlockBody{}
+	return &types.State{
+		Config: types.Config{GenesisTime: genesisTime},
+		LatestBlockHeader: types.BlockHeader{
+			BodyRoot: ssz.HashTreeRootBlockBody(&emptyBody, types.AttestationsLimit),
+		},
+		JustifiedSlots:     types.NewBitlist(types.HistoricalRootsLimit),
+		Validators:         append([]types.Validator(nil), validators...),
+		JustificationVotes: types.NewBitlist(justificationVotesLimit),
+	}
+}
+
+// GenesisBlock returns the block committing to the genesis state. It
+// carries no signatures.
+func GenesisBlock(state *types.State) *types.SignedBlockWithAttestation {
+	return &types.SignedBlockWithAttestation{
+		Message: types.BlockWithAttestation{
+			Block: types.Block{StateRoot: StateRoot(state)},
+		},
+	}
+}
+
+// Genesis returns the anchor for a chain starting at genesis.
+func Genesis(genesisTime uint64, validators []types.Validator) *Anchor {
+	state := GenesisState(genesisTime, validators)
+	block := GenesisBlock(state)
+	return &Anchor{State: state, Block: block, Root: BlockRoot(&block.Message.Block)}
+}
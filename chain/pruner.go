@@ -0,0 +1,109 @@
+// Package chain ties fork choice, storage and state processing together.
+package chain
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/forkchoice"
+	"github.com/devlongs/gean/storage"
+)
+
+// PruneResult reports how many entries a prune removed.
+type PruneResult struct {
+	ForkChoiceNodes int
+	Blocks          int
+	States          int
+}
+
+// Pruner deletes stale forks from fork choice and storage whenever the
+// finalized checkpoint advances.
+//
+// Blocks on the canonical chain below finalization are always kept. Their
+// states are deleted unless archive mode is enabled; the finalized state
+// itself is always kept.
+type Pruner struct {
+	mu            sync.Mutex
+	forkChoice    *forkchoice.Store
+	db            storage.Store
+	archive       bool
+	lastFinalized types.Checkpoint
+}
+
+func NewPruner(fc *forkchoice.Store, db storage.Store, archive bool) *Pruner {
+	return &Pruner{
+		forkChoice:    fc,
+		db:            db,
+		archive:       archive,
+		lastFinalized: fc.Finalized(),
+	}
+}
+
+// OnFinalized prunes up to the given finalized checkpoint, typically taken
+// from State.LatestFinalized after a block import. Checkpoints that do not
+// advance past the last pruned one are a no-op.
+func (p *Pruner) OnFinalized(finalized types.Checkpoint) (PruneResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var result PruneResult
+	if finalized.Slot <= p.lastFinalized.Slot {
+		return result, nil
+	}
+
+	removed, err := p.forkChoice.Prune(finalized.Root)
+	if err != nil {
+		return result, fmt.Errorf("prune fork choice: %w", err)
+	}
+	result.ForkChoiceNodes = len(removed)
+
+	// Only the nodes fork choice dropped can become stale: everything else
+	// was pruned at an earlier finalization or descends from this one. Of
+	// these, the ones on the path back to the previous finalized block are
+	// canonical.
+	canonical := p.canonicalSince(finalized.Root)
+	for _, root := range removed {
+		if canonical[root] {
+			if !p.archive && p.deleteState(root) {
+				result.States++
+			}
+			continue
+		}
+		if _, ok := p.db.GetBlock(root); ok {
+			p.db.DeleteBlock(root)
+			result.Blocks++
+		}
+		if p.deleteState(root) {
+			result.States++
+		}
+	}
+
+	p.lastFinalized = finalized
+	return result, nil
+}
+
+// canonicalSince walks parent links from root back to the previously
+// finalized block and returns the visited roots.
+func (p *Pruner) canonicalSince(root types.Root) map[types.Root]bool {
+	canonical := make(map[types.Root]bool)
+	for {
+		canonical[root] = true
+		if root == p.lastFinalized.Root {
+			return canonical
+		}
+		block, ok := p.db.GetBlock(root)
+		if !ok || block.Message.Block.Slot < p.lastFinalized.Slot {
+			return canonical
+		}
+		root = block.Message.Block.ParentRoot
+	}
+}
+
+func (p *Pruner) deleteState(root types.Root) bool {
+	if _, ok := p.db.GetState(root); !ok {
+		return false
+	}
+	p.db.DeleteState(root)
+	return true
+}
@@ -0,0 +1,145 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/forkchoice"
+	"github.com/devlongs/gean/storage"
+)
+
+type testBlock struct {
+	root, parent types.Root
+	slot         types.Slot
+}
+
+// setupChain builds genesis(0) -> 1 -> 2 -> 3 with orphans 10 (off genesis)
+// and 20 (off block 1), storing every block and state.
+func setupChain(t *testing.T) (*forkchoice.Store, *storage.MemoryStore) {
+	t.Helper()
+	genesis := types.Root{0xff}
+	fc := forkchoice.NewStore(types.Checkpoint{Root: genesis}, types.Root{})
+	db := storage.NewMemoryStore()
+	put := func(root, parent types.Root, slot types.Slot) {
+		block := &types.SignedBlockWithAttestation{}
+		block.Message.Block.Slot = slot
+		block.Message.Block.ParentRoot = parent
+		db.PutBlock(root, block)
+		db.PutState(root, &types.State{Slot: slot})
+	}
+	put(genesis, types.Root{}, 0)
+	for _, b := range []testBlock{
+		{types.Root{1}, genesis, 1},
+		{types.Root{10}, genesis, 1},
+		{types.Root{2}, types.Root{1}, 2},
+		{types.Root{20}, types.Root{1}, 2},
+		{types.Root{3}, types.Root{2}, 3},
+	} {
+		if err := fc.AddBlock(b.root, b.parent, b.slot); err != nil {
+			t.Fatal(err)
+		}
+		put(b.root, b.parent, b.slot)
+	}
+	return fc, db
+}
+
+func TestPrunerRemovesOrphans(t *testing.T) {
+	fc, db := setupChain(t)
+	p := NewPruner(fc, db, false)
+
+	result, err := p.OnFinalized(types.Checkpoint{Root: types.Root{2}, Slot: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fork choice drops genesis, 1, 10 and 20.
+	if result.ForkChoiceNodes != 4 {
+		t.Errorf("expected 4 fork choice nodes removed, got %d", result.ForkChoiceNodes)
+	}
+	if result.Blocks != 2 {
+		t.Errorf("expected 2 blocks removed, got %d", result.Blocks)
+	}
+	// Orphan states plus canonical states of genesis and block 1.
+	if result.States != 4 {
+		t.Errorf("expected 4 states removed, got %d", result.States)
+	}
+
+	for _, root := range []types.Root{{0xff}, {1}, {2}, {3}} {
+		if _, ok := db.GetBlock(root); !ok {
+			t.Errorf("canonical block %x should be kept", root[:1])
+		}
+	}
+	for _, root := range []types.Root{{10}, {20}} {
+		if _, ok := db.GetBlock(root); ok {
+			t.Errorf("orphan block %x should be removed", root[:1])
+		}
+	}
+	if _, ok := db.GetState(types.Root{2}); !ok {
+		t.Error("finalized state should be kept")
+	}
+	if _, ok := db.GetState(types.Root{1}); ok {
+		t.Error("canonical state below finalized should be removed")
+	}
+}
+
+func TestPrunerArchive(t *testing.T) {
+	fc, db := setupChain(t)
+	p := NewPruner(fc, db, true)
+
+	result, err := p.OnFinalized(types.Checkpoint{Root: types.Root{2}, Slot: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Blocks != 2 || result.States != 2 {
+		t.Errorf("expected only orphans removed, got %+v", result)
+	}
+	if _, ok := db.GetState(types.Root{1}); !ok {
+		t.Error("archive should keep canonical states")
+	}
+}
+
+func TestPrunerIgnoresStaleFinalization(t *testing.T) {
+	fc, db := setupChain(t)
+	p := NewPruner(fc, db, false)
+
+	if _, err := p.OnFinalized(types.Checkpoint{Root: types.Root{2}, Slot: 2}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.OnFinalized(types.Checkpoint{Root: types.Root{1}, Slot: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (PruneResult{}) {
+		t.Errorf("stale finalization should be a no-op, got %+v", result)
+	}
+
+	if _, err := p.OnFinalized(types.Checkpoint{Root: types.Root{10}, Slot: 5}); err == nil {
+		t.Error("expected error for finalized root unknown to fork choice")
+	}
+}
+
+// historyStore refuses to list its blocks, which a prune must not need.
+type historyStore struct {
+	*storage.MemoryStore
+}
+
+func (historyStore) BlockRoots() []types.Root {
+	panic("prune walked the whole block history")
+}
+
+func TestPrunerSkipsHistory(t *testing.T) {
+	fc, db := setupChain(t)
+	// A backfilled block below the anchor is not in fork choice.
+	old := &types.SignedBlockWithAttestation{}
+	db.PutBlock(types.Root{0xee}, old)
+	p := NewPruner(fc, historyStore{db}, false)
+
+	if _, err := p.OnFinalized(types.Checkpoint{Root: types.Root{2}, Slot: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.GetBlock(types.Root{0xee}); !ok {
+		t.Error("backfilled block should be kept")
+	}
+	if _, ok := db.GetBlock(types.Root{10}); ok {
+		t.Error("orphan block should be removed")
+	}
+}
@@ -0,0 +1,114 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/batch"
+	"github.com/devlongs/gean/crypto/signature"
+)
+
+// AttestationSigningRoot is the message validators sign when attesting.
+func AttestationSigningRoot(data *types.AttestationData) types.Root {
+	return ssz.HashTreeRootAttestationData(data)
+}
+
+// ProposerSigningRoot is the message the proposer signs: the block together
+// with its own attestation.
+func ProposerSigningRoot(bwa *types.BlockWithAttestation) types.Root {
+	return ssz.HashTreeRootBlockWithAttestation(bwa, types.AttestationsLimit)
+}
+
+// SignedAggregate is an aggregated attestation together with the
+// signatures of its participants in ascending validator index, as they are
+// laid out in a block's Signatures.
+type SignedAggregate struct {
+	Attestation types.AggregatedAttestation
+	Signatures  []types.Bytes3116
+}
+
+// BlockSignatureJobs maps the signatures of a block to the keys that made
+// them. Signatures holds, for each attestation in Body.Attestations, one
+// signature per participant in ascending validator index, followed by the
+// proposer's signature. Blocks whose signature count does not match the
+// number of participants plus the proposer are rejected.
+//
+// Once succinct aggregate proofs are available they replace the
+// per-participant signatures of an attestation.
+func BlockSignatureJobs(state *types.State, signed *types.SignedBlockWithAttestation) ([]batch.Job, error) {
+	atts := signed.Message.Block.Body.Attestations
+
+	participants := make([][]types.ValidatorIndex, len(atts))
+	expected := 1
+	for i := range atts {
+		participants[i] = participantIndices(atts[i].AggregationBits)
+		if len(participants[i]) == 0 {
+			return nil, fmt.Errorf("attestation %d has no participants", i)
+		}
+		expected += len(participants[i])
+	}
+	if len(signed.Signatures) != expected {
+		return nil, fmt.Errorf("expected %d signatures, got %d", expected, len(signed.Signatures))
+	}
+
+	jobs := make([]batch.Job, 0, expected)
+	for i := range atts {
+		msg := AttestationSigningRoot(&atts[i].Data)
+		for _, v := range participants[i] {
+			pubkey, err := validatorPubkey(state, v)
+			if err != nil {
+				return nil, fmt.Errorf("attestation %d: %w", i, err)
+			}
+			jobs = append(jobs, batch.Job{
+				Pubkey:    pubkey,
+				Message:   msg,
+				Signature: &signed.Signatures[len(jobs)],
+			})
+		}
+	}
+
+	proposer := signed.Message.Block.ProposerIndex
+	pubkey, err := validatorPubkey(state, proposer)
+	if err != nil {
+		return nil, fmt.Errorf("proposer: %w", err)
+	}
+	jobs = append(jobs, batch.Job{
+		Pubkey:    pubkey,
+		Message:   ProposerSigningRoot(&signed.Message),
+		Signature: &signed.Signatures[len(jobs)],
+	})
+	return jobs, nil
+}
+
+// VerifyBlockSignatures checks every signature of a block concurrently. A
+// failing signature is reported as a *batch.Error carrying its index in
+// Signatures.
+func VerifyBlockSignatures(ctx context.Context, state *types.State, signed *types.SignedBlockWithAttestation, workers int, verifier signature.Verifier) error {
+	jobs, err := BlockSignatureJobs(state, signed)
+	if err != nil {
+		return err
+	}
+	return batch.Verify(ctx, jobs, workers, verifier)
+}
+
+func participantIndices(bits *types.Bitlist) []types.ValidatorIndex {
+	if bits == nil {
+		return nil
+	}
+	var indices []types.ValidatorIndex
+	for i := 0; i < bits.Len(); i++ {
+		if bits.Get(i) {
+			indices = append(indices, types.ValidatorIndex(i))
+		}
+	}
+	return indices
+}
+
+func validatorPubkey(state *types.State, index types.ValidatorIndex) (types.Bytes52, error) {
+	if uint64(index) >= uint64(len(state.Validators)) {
+		return types.Bytes52{}, fmt.Errorf("validator index %d out of range", index)
+	}
+	return state.Validators[index].Pubkey, nil
+}
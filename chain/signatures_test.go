@@ -0,0 +1,147 @@
+package chain
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/batch"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/crypto/xmss"
+)
+
+var testXMSSParams = xmss.Params{TreeHeight: 2}
+
+var testVerifier = signature.XMSSVerifier{Params: testXMSSParams}
+
+// signedTestBlock builds a block by validator 0 carrying an aggregated
+// attestation from validators 1 and 3 and a single one from validator 2.
+func signedTestBlock(t *testing.T) (*types.State, *types.SignedBlockWithAttestation) {
+	t.Helper()
+	state := &types.State{}
+	signers := make([]*xmss.Signer, 4)
+	for i := range signers {
+		key, err := xmss.GenerateKey(testXMSSParams, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers[i], _ = xmss.NewSigner(key, &xmss.MemoryLeafStore{})
+		state.Validators = append(state.Validators, types.Validator{Pubkey: key.PublicKey(), Index: types.ValidatorIndex(i)})
+	}
+
+	signed := &types.SignedBlockWithAttestation{}
+	block := &signed.Message.Block
+	block.Slot = 3
+	for i, group := range [][]int{{1, 3}, {2}} {
+		bits := make([]bool, 4)
+		for _, v := range group {
+			bits[v] = true
+		}
+		bl, _ := types.BitlistFromBits(bits, types.ValidatorRegistryLimit)
+		data := types.AttestationData{Slot: 2, Head: types.Checkpoint{Root: types.Root{byte(i)}, Slot: 2}}
+		block.Body.Attestations = append(block.Body.Attestations, types.AggregatedAttestation{AggregationBits: bl, Data: data})
+		for _, v := range group {
+			sig, err := signers[v].Sign(AttestationSigningRoot(&data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed.Signatures = append(signed.Signatures, sig)
+		}
+	}
+	signed.Message.ProposerAttestation = types.Attestation{ValidatorID: 0, Data: types.AttestationData{Slot: 3}}
+	sig, err := signers[0].Sign(ProposerSigningRoot(&signed.Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed.Signatures = append(signed.Signatures, sig)
+	return state, signed
+}
+
+func TestVerifyBlockSignatures(t *testing.T) {
+	state, signed := signedTestBlock(t)
+	if err := VerifyBlockSignatures(context.Background(), state, signed, 2, testVerifier); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyBlockSignaturesAttributesFailure(t *testing.T) {
+	state, signed := signedTestBlock(t)
+	signed.Signatures[1][100] ^= 0x01 // validator 3 in the aggregate
+
+	err := VerifyBlockSignatures(context.Background(), state, signed, 2, testVerifier)
+	var batchErr *batch.Error
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 {
+		t.Fatalf("expected failure at signature 1, got %v", err)
+	}
+
+	state, signed = signedTestBlock(t)
+	signed.Message.Block.Slot = 4 // invalidates the proposer signature
+	err = VerifyBlockSignatures(context.Background(), state, signed, 2, testVerifier)
+	if !errors.As(err, &batchErr) || batchErr.Index != 3 {
+		t.Fatalf("expected failure at proposer signature, got %v", err)
+	}
+}
+
+func TestVerifyBlockSignaturesSwappedParticipants(t *testing.T) {
+	state, signed := signedTestBlock(t)
+	signed.Signatures[0], signed.Signatures[1] = signed.Signatures[1], signed.Signatures[0]
+	if err := VerifyBlockSignatures(context.Background(), state, signed, 2, testVerifier); err == nil {
+		t.Error("signatures must follow participant order")
+	}
+}
+
+func TestBlockSignatureJobsShape(t *testing.T) {
+	state, signed := signedTestBlock(t)
+	jobs, err := BlockSignatureJobs(state, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 4 || jobs[1].Pubkey != state.Validators[3].Pubkey {
+		t.Error("jobs should follow participant order")
+	}
+
+	signed.Signatures = signed.Signatures[:3]
+	if _, err := BlockSignatureJobs(state, signed); err == nil {
+		t.Error("expected error for missing signature")
+	}
+
+	state, signed = signedTestBlock(t)
+	signed.Message.Block.Body.Attestations[1].AggregationBits.Set(0, true)
+	if _, err := BlockSignatureJobs(state, signed); err == nil {
+		t.Error("expected error for signature count not matching participants")
+	}
+
+	state, signed = signedTestBlock(t)
+	signed.Message.Block.Body.Attestations[1].AggregationBits.Set(2, false)
+	if _, err := BlockSignatureJobs(state, signed); err == nil {
+		t.Error("expected error for attestation without participants")
+	}
+
+	state, signed = signedTestBlock(t)
+	signed.Message.Block.ProposerIndex = 9
+	if _, err := BlockSignatureJobs(state, signed); err == nil {
+		t.Error("expected error for unknown proposer")
+	}
+}
+
+func TestVerifyBlockSignaturesMockScheme(t *testing.T) {
+	state := &types.State{}
+	signers := []*signature.MockSigner{signature.NewMockSigner(0), signature.NewMockSigner(1)}
+	for i, s := range signers {
+		state.Validators = append(state.Validators, types.Validator{Pubkey: s.PublicKey(), Index: types.ValidatorIndex(i)})
+	}
+
+	signed := &types.SignedBlockWithAttestation{}
+	bits, _ := types.BitlistFromBits([]bool{false, true}, types.ValidatorRegistryLimit)
+	data := types.AttestationData{Slot: 1}
+	signed.Message.Block.Body.Attestations = []types.AggregatedAttestation{{AggregationBits: bits, Data: data}}
+	attSig, _ := signers[1].Sign(AttestationSigningRoot(&data))
+	proposerSig, _ := signers[0].Sign(ProposerSigningRoot(&signed.Message))
+	signed.Signatures = []types.Bytes3116{attSig, proposerSig}
+
+	if err := VerifyBlockSignatures(context.Background(), state, signed, 0, signature.MockVerifier{}); err != nil {
+		t.Fatal(err)
+	}
+}
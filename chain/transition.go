@@ -0,0 +1,254 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/validator/duties"
+)
+
+// justificationVotesLimit bounds the flattened vote bits: one bit per
+// validator for every root being tracked.
+const justificationVotesLimit = types.HistoricalRootsLimit * types.ValidatorRegistryLimit
+
+// ErrInvalidBlock is wrapped by every state transition failure caused by
+// the block itself.
+var ErrInvalidBlock = errors.New("invalid block")
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidBlock, fmt.Sprintf(format, args...))
+}
+
+// CopyState returns a deep copy of s.
+func CopyState(s *types.State) *types.State {
+	c := *s
+	c.HistoricalRoots = append([]types.Root(nil), s.HistoricalRoots...)
+	c.JustifiedSlots = s.JustifiedSlots.Copy()
+	c.Validators = append([]types.Validator(nil), s.Validators...)
+	c.JustificationRoots = append([]types.Root(nil), s.JustificationRoots...)
+	c.JustificationVotes = s.JustificationVotes.Copy()
+	return &c
+}
+
+// StateTransition applies block to a copy of pre and checks the resulting
+// state root against the block. Signatures are not checked here; see
+// VerifyBlockSignatures.
+func StateTransition(pre *types.State, block *types.Block) (*types.State, error) {
+	s := CopyState(pre)
+	if err := ProcessSlots(s, block.Slot); err != nil {
+		return nil, err
+	}
+	if err := ProcessBlock(s, block); err != nil {
+		return nil, err
+	}
+	if root := StateRoot(s); root != block.StateRoot {
+		return nil, invalid("state root %x, block commits to %x", root[:4], block.StateRoot[:4])
+	}
+	return s, nil
+}
+
+// ProcessSlots advances s to slot. The first advance after a block fills in
+// that block's state root in the latest header.
+//
+// Slots past HistoricalRootsLimit can never hold a block, so they are
+// refused before looping: the slot may come from an untrusted block.
+func ProcessSlots(s *types.State, slot types.Slot) error {
+	if slot <= s.Slot {
+		return invalid("slot %d not after state slot %d", slot, s.Slot)
+	}
+	if uint64(slot) > types.HistoricalRootsLimit {
+		return invalid("slot %d beyond historical roots limit %d", slot, types.HistoricalRootsLimit)
+	}
+	for s.Slot < slot {
+		if s.LatestBlockHeader.StateRoot.IsZero() {
+			s.LatestBlockHeader.StateRoot = StateRoot(s)
+		}
+		s.Slot++
+	}
+	return nil
+}
+
+// BuildBlock creates the block for slot on top of pre with the given
+// attestations, filling in the proposer, parent and state root. It returns
+// the block and its post-state.
+func BuildBlock(pre *types.State, slot types.Slot, attestations []types.AggregatedAttestation) (*types.Block, *types.State, error) {
+	s := CopyState(pre)
+	if err := ProcessSlots(s, slot); err != nil {
+		return nil, nil, err
+	}
+	proposer, err := duties.ProposerIndex(slot, uint64(len(s.Validators)))
+	if err != nil {
+		return nil, nil, invalid("%v", err)
+	}
+	block := &types.Block{
+		Slot:          slot,
+		ProposerIndex: proposer,
+		ParentRoot:    ssz.HashTreeRootBlockHeader(&s.LatestBlockHeader),
+		Body:          types.BlockBody{Attestations: attestations},
+	}
+	if err := ProcessBlock(s, block); err != nil {
+		return nil, nil, err
+	}
+	block.StateRoot = StateRoot(s)
+	return block, s, nil
+}
+
+func ProcessBlock(s *types.State, block *types.Block) error {
+	if err := processBlockHeader(s, block); err != nil {
+		return err
+	}
+	return processAttestations(s, block.Body.Attestations)
+}
+
+func processBlockHeader(s *types.State, block *types.Block) error {
+	parent := s.LatestBlockHeader
+	if block.Slot != s.Slot {
+		return invalid("block slot %d, state slot %d", block.Slot, s.Slot)
+	}
+	if block.Slot <= parent.Slot {
+		return invalid("block slot %d not after parent slot %d", block.Slot, parent.Slot)
+	}
+	if !duties.IsProposer(s, block.Slot, block.ProposerIndex) {
+		return invalid("validator %d is not the proposer for slot %d", block.ProposerIndex, block.Slot)
+	}
+	if parentRoot := ssz.HashTreeRootBlockHeader(&parent); block.ParentRoot != parentRoot {
+		return invalid("parent root %x, expected %x", block.ParentRoot[:4], parentRoot[:4])
+	}
+
+	// The genesis block is justified and finalized by definition.
+	if parent.Slot == 0 {
+		s.LatestJustified.Root = block.ParentRoot
+		s.LatestFinalized.Root = block.ParentRoot
+	}
+
+	// Record the parent and any skipped slots.
+	emptySlots := int(block.Slot - parent.Slot - 1)
+	if len(s.HistoricalRoots)+1+emptySlots > types.HistoricalRootsLimit {
+		return invalid("historical roots limit reached")
+	}
+	s.HistoricalRoots = append(s.HistoricalRoots, block.ParentRoot)
+	s.JustifiedSlots.Append(parent.Slot == 0)
+	for i := 0; i < emptySlots; i++ {
+		s.HistoricalRoots = append(s.HistoricalRoots, types.Root{})
+		s.JustifiedSlots.Append(false)
+	}
+
+	s.LatestBlockHeader = types.BlockHeader{
+		Slot:          block.Slot,
+		ProposerIndex: block.ProposerIndex,
+		ParentRoot:    block.ParentRoot,
+		BodyRoot:      ssz.HashTreeRootBlockBody(&block.Body, types.AttestationsLimit),
+	}
+	return nil
+}
+
+// processAttestations counts votes for each target and applies the 3SF-mini
+// justification and finalization rules. Attestations that cannot count are
+// skipped rather than invalidating the block.
+func processAttestations(s *types.State, attestations []types.AggregatedAttestation) error {
+	numValidators := len(s.Validators)
+	votes := justificationsFromState(s)
+
+	for i := range attestations {
+		att := &attestations[i]
+		source, target := att.Data.Source, att.Data.Target
+		if !s.JustifiedSlots.Get(int(source.Slot)) || s.JustifiedSlots.Get(int(target.Slot)) {
+			continue
+		}
+		if source.Root.IsZero() || target.Root.IsZero() || !rootAtSlot(s, source) || !rootAtSlot(s, target) {
+			continue
+		}
+		if target.Slot <= source.Slot || !target.Slot.IsJustifiableAfter(s.LatestFinalized.Slot) {
+			continue
+		}
+
+		bits, ok := votes[target.Root]
+		if !ok {
+			bits = make([]bool, numValidators)
+			votes[target.Root] = bits
+		}
+		for v := 0; v < att.AggregationBits.Len() && v < numValidators; v++ {
+			if att.AggregationBits.Get(v) {
+				bits[v] = true
+			}
+		}
+
+		if 3*countVotes(bits) < 2*numValidators {
+			continue
+		}
+		s.LatestJustified = target
+		s.JustifiedSlots.Set(int(target.Slot), true)
+		delete(votes, target.Root)
+
+		// The source is finalized when no slot between it and the target
+		// could have been justified.
+		finalized := true
+		for slot := source.Slot + 1; slot < target.Slot; slot++ {
+			if slot.IsJustifiableAfter(s.LatestFinalized.Slot) {
+				finalized = false
+				break
+			}
+		}
+		if finalized {
+			s.LatestFinalized = source
+		}
+	}
+
+	return storeJustifications(s, votes)
+}
+
+// rootAtSlot reports whether cp matches the block root recorded for its
+// slot.
+func rootAtSlot(s *types.State, cp types.Checkpoint) bool {
+	return int(cp.Slot) < len(s.HistoricalRoots) && s.HistoricalRoots[cp.Slot] == cp.Root
+}
+
+func countVotes(bits []bool) int {
+	n := 0
+	for _, b := range bits {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// justificationsFromState unflattens JustificationVotes into one bit slice
+// per root.
+func justificationsFromState(s *types.State) map[types.Root][]bool {
+	n := len(s.Validators)
+	votes := make(map[types.Root][]bool, len(s.JustificationRoots))
+	for i, root := range s.JustificationRoots {
+		bits := make([]bool, n)
+		for v := range bits {
+			bits[v] = s.JustificationVotes.Get(i*n + v)
+		}
+		votes[root] = bits
+	}
+	return votes
+}
+
+// storeJustifications flattens votes back into the state, ordered by root.
+func storeJustifications(s *types.State, votes map[types.Root][]bool) error {
+	roots := make([]types.Root, 0, len(votes))
+	for root := range votes {
+		roots = append(roots, root)
+	}
+	sort.Slice(roots, func(i, j int) bool { return bytes.Compare(roots[i][:], roots[j][:]) < 0 })
+
+	flat := make([]bool, 0, len(roots)*len(s.Validators))
+	for _, root := range roots {
+		flat = append(flat, votes[root]...)
+	}
+	bits, err := types.BitlistFromBits(flat, justificationVotesLimit)
+	if err != nil {
+		return invalid("%v", err)
+	}
+	s.JustificationRoots = roots
+	s.JustificationVotes = bits
+	return nil
+}
@@ -0,0 +1,143 @@
+package chain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+func testValidators(n int) []types.Validator {
+	vals := make([]types.Validator, n)
+	for i := range vals {
+		vals[i] = types.Validator{Pubkey: types.Bytes52{byte(i)}, Index: types.ValidatorIndex(i)}
+	}
+	return vals
+}
+
+// vote aggregates the given validators voting from source to target.
+func vote(source, target types.Checkpoint, validators ...int) types.AggregatedAttestation {
+	bits := types.NewBitlist(types.ValidatorRegistryLimit)
+	for i := 0; i <= validators[len(validators)-1]; i++ {
+		bits.Append(false)
+	}
+	for _, v := range validators {
+		bits.Set(v, true)
+	}
+	return types.AggregatedAttestation{
+		AggregationBits: bits,
+		Data:            types.AttestationData{Slot: target.Slot, Head: target, Source: source, Target: target},
+	}
+}
+
+func TestGenesis(t *testing.T) {
+	anchor := Genesis(1700000000, testValidators(4))
+	if _, err := NewAnchor(anchor.State, anchor.Block); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first block's parent is the genesis block.
+	block, _, err := BuildBlock(anchor.State, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.ParentRoot != anchor.Root {
+		t.Error("first block should build on the genesis block")
+	}
+}
+
+func TestJustificationAndFinalization(t *testing.T) {
+	anchor := Genesis(1700000000, testValidators(4))
+	genesis := types.Checkpoint{Root: anchor.Root}
+
+	b1, s1, err := BuildBlock(anchor.State, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s1.LatestJustified != genesis || s1.LatestFinalized != genesis {
+		t.Error("genesis should be justified and finalized")
+	}
+	cp1 := types.Checkpoint{Root: BlockRoot(b1), Slot: 1}
+
+	// Two of four votes are not a supermajority.
+	b2, s2, err := BuildBlock(s1, 2, []types.AggregatedAttestation{vote(genesis, cp1, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2.LatestJustified != genesis || len(s2.JustificationRoots) != 1 {
+		t.Error("slot 1 justified too early")
+	}
+	cp2 := types.Checkpoint{Root: BlockRoot(b2), Slot: 2}
+
+	// A third vote justifies slot 1 and finalizes genesis.
+	b3, s3, err := BuildBlock(s2, 3, []types.AggregatedAttestation{vote(genesis, cp1, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s3.LatestJustified != cp1 || len(s3.JustificationRoots) != 0 {
+		t.Errorf("expected slot 1 justified, got %+v", s3.LatestJustified)
+	}
+
+	// Justifying slot 2 from slot 1 finalizes slot 1.
+	_, s4, err := BuildBlock(s3, 4, []types.AggregatedAttestation{vote(cp1, cp2, 0, 1, 3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s4.LatestJustified != cp2 || s4.LatestFinalized != cp1 {
+		t.Errorf("expected slot 2 justified and slot 1 finalized, got %+v %+v", s4.LatestJustified, s4.LatestFinalized)
+	}
+
+	// Replaying through StateTransition yields the same states.
+	post, err := StateTransition(s2, b3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if StateRoot(post) != StateRoot(s3) {
+		t.Error("state transition mismatch")
+	}
+}
+
+func TestStateTransitionSkipsSlots(t *testing.T) {
+	anchor := Genesis(1700000000, testValidators(3))
+	b1, s1, _ := BuildBlock(anchor.State, 1, nil)
+	b5, s5, err := BuildBlock(s1, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s5.HistoricalRoots) != 5 || s5.HistoricalRoots[1] != BlockRoot(b1) || !s5.HistoricalRoots[2].IsZero() {
+		t.Errorf("unexpected historical roots %x", s5.HistoricalRoots)
+	}
+	if s5.JustifiedSlots.Len() != 5 || !s5.JustifiedSlots.Get(0) || s5.JustifiedSlots.Get(1) {
+		t.Error("unexpected justified slots")
+	}
+	if b5.ParentRoot != BlockRoot(b1) {
+		t.Error("parent should be the last block")
+	}
+}
+
+func TestStateTransitionRejectsInvalidBlocks(t *testing.T) {
+	anchor := Genesis(1700000000, testValidators(4))
+	good, _, _ := BuildBlock(anchor.State, 1, nil)
+
+	tests := map[string]func(b *types.Block){
+		"wrong proposer":   func(b *types.Block) { b.ProposerIndex = 2 },
+		"wrong parent":     func(b *types.Block) { b.ParentRoot = types.Root{1} },
+		"wrong state root": func(b *types.Block) { b.StateRoot = types.Root{1} },
+		"slot in the past": func(b *types.Block) { b.Slot = 0 },
+		"far future slot":  func(b *types.Block) { b.Slot = 1 << 62 },
+	}
+	for name, mutate := range tests {
+		b := *good
+		mutate(&b)
+		if _, err := StateTransition(anchor.State, &b); !errors.Is(err, ErrInvalidBlock) {
+			t.Errorf("%s: expected ErrInvalidBlock, got %v", name, err)
+		}
+	}
+
+	if _, err := StateTransition(anchor.State, good); err != nil {
+		t.Errorf("valid block rejected: %v", err)
+	}
+	if anchor.State.Slot != 0 {
+		t.Error("pre-state modified")
+	}
+}
@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// validatorConfig is the JSON file listing the genesis validators, written
+// by "gean keys generate" and read by "gean genesis".
+type validatorConfig struct {
+	Validators []validatorEntry `json:"validators"`
+}
+
+type validatorEntry struct {
+	Index  types.ValidatorIndex `json:"index"`
+	Pubkey string               `json:"pubkey"`
+}
+
+// LoadValidators reads a validator config. Indices must run from 0 in file
+// order and public keys must be unique.
+func LoadValidators(path string) ([]types.Validator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg validatorConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("decode validator config: %w", err)
+	}
+	if uint64(len(cfg.Validators)) > types.ValidatorRegistryLimit {
+		return nil, fmt.Errorf("%d validators exceed the registry limit", len(cfg.Validators))
+	}
+	validators := make([]types.Validator, len(cfg.Validators))
+	seen := make(map[types.Bytes52]bool)
+	for i, e := range cfg.Validators {
+		if e.Index != types.ValidatorIndex(i) {
+			return nil, fmt.Errorf("validator %d has index %d", i, e.Index)
+		}
+		b, err := hex.DecodeString(strings.TrimPrefix(e.Pubkey, "0x"))
+		if err != nil || len(b) != len(types.Bytes52{}) {
+			return nil, fmt.Errorf("validator %d: invalid pubkey", i)
+		}
+		v := types.Validator{Index: e.Index}
+		copy(v.Pubkey[:], b)
+		if seen[v.Pubkey] {
+			return nil, fmt.Errorf("validator %d: duplicate pubkey", i)
+		}
+		seen[v.Pubkey] = true
+		validators[i] = v
+	}
+	return validators, nil
+}
+
+// WriteValidators writes a validator config for validators.
+func WriteValidators(path string, validators []types.Validator) error {
+	cfg := validatorConfig{Validators: make([]validatorEntry, len(validators))}
+	for i, v := range validators {
+		cfg.Validators[i] = validatorEntry{Index: v.Index, Pubkey: "0x" + hex.EncodeToString(v.Pubkey[:])}
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
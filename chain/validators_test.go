@@ -0,0 +1,43 @@
+package chain
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+func TestValidatorConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "validators.json")
+	validators := []types.Validator{
+		{Index: 0, Pubkey: types.Bytes52{1}},
+		{Index: 1, Pubkey: types.Bytes52{2}},
+	}
+	if err := WriteValidators(path, validators); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadValidators(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, validators) {
+		t.Errorf("loaded %v, want %v", got, validators)
+	}
+
+	bad := map[string][]types.Validator{
+		"gap":       {{Index: 1, Pubkey: types.Bytes52{1}}},
+		"duplicate": {{Index: 0, Pubkey: types.Bytes52{1}}, {Index: 1, Pubkey: types.Bytes52{1}}},
+	}
+	for name, vs := range bad {
+		WriteValidators(path, vs)
+		if _, err := LoadValidators(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	os.WriteFile(path, []byte(`{"validators":[{"index":0,"pubkey":"0x01"}]}`), 0o644)
+	if _, err := LoadValidators(path); err == nil {
+		t.Error("expected an error for a short pubkey")
+	}
+}
@@ -0,0 +1,163 @@
+package chainsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/peers"
+	"github.com/devlongs/gean/p2p/transport"
+	"github.com/devlongs/gean/storage"
+)
+
+var errBadBatch = errors.New("chainsync: backfill batch does not match historical roots")
+
+type BackfillConfig struct {
+	// BatchSize is the number of slots requested per BlocksByRange.
+	BatchSize uint64
+	// RetryDelay is how long to wait when no peer can serve a batch.
+	RetryDelay time.Duration
+}
+
+func DefaultBackfillConfig() BackfillConfig {
+	return BackfillConfig{
+		BatchSize:  64,
+		RetryDelay: time.Duration(types.SecondsPerSlot) * time.Second,
+	}
+}
+
+// Backfill downloads the blocks below a checkpoint anchor. It walks back
+// from the anchor with BlocksByRange and only stores blocks whose roots
+// match the HistoricalRoots of the anchor state, so every stored block is
+// on the anchor's chain. Backfilled blocks are written to storage only;
+// fork choice and head following are not involved.
+type Backfill struct {
+	db    storage.Store
+	net   Network
+	peers Peers
+	cfg   BackfillConfig
+	roots []types.Root
+
+	mu     sync.Mutex
+	oldest types.Slot
+}
+
+func NewBackfill(anchor *chain.Anchor, db storage.Store, net Network, p Peers, cfg BackfillConfig) *Backfill {
+	return &Backfill{
+		db:     db,
+		net:    net,
+		peers:  p,
+		cfg:    cfg,
+		roots:  anchor.State.HistoricalRoots,
+		oldest: anchor.Checkpoint().Slot,
+	}
+}
+
+// Oldest returns the slot of the oldest block stored so far. Backfill is
+// done once it reaches slot 0.
+func (b *Backfill) Oldest() types.Slot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.oldest
+}
+
+// Run backfills until the genesis block is stored or ctx is cancelled. It
+// is meant to run in its own goroutine.
+func (b *Backfill) Run(ctx context.Context) error {
+	end := types.Slot(len(b.roots))
+	for end > 0 {
+		start := types.Slot(0)
+		if uint64(end) > b.cfg.BatchSize {
+			start = end - types.Slot(b.cfg.BatchSize)
+		}
+		blocks, err := b.download(ctx, start, end)
+		if err != nil {
+			return err
+		}
+		for i := len(blocks) - 1; i >= 0; i-- {
+			block := blocks[i]
+			b.db.PutBlock(b.roots[block.Message.Block.Slot], block)
+		}
+		b.mu.Lock()
+		if len(blocks) > 0 {
+			b.oldest = blocks[0].Message.Block.Slot
+		}
+		b.mu.Unlock()
+		end = start
+	}
+	return nil
+}
+
+// download fetches the blocks in [start, end), trying each peer in turn and
+// waiting for new peers when none can serve it.
+func (b *Backfill) download(ctx context.Context, start, end types.Slot) ([]*types.SignedBlockWithAttestation, error) {
+	tried := make(map[transport.PeerID]bool)
+	for {
+		peer, ok := b.pickPeer(end, tried)
+		if !ok {
+			clear(tried)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(b.cfg.RetryDelay):
+			}
+			continue
+		}
+		tried[peer] = true
+
+		blocks, err := b.net.BlocksByRange(ctx, peer, start, uint64(end-start))
+		if err != nil {
+			b.peers.ReportResponse(peer, err)
+		} else if err = b.verify(blocks, start, end); err != nil {
+			b.peers.ReportAction(peer, peers.ActionInvalidResponse)
+		} else {
+			b.peers.ReportResponse(peer, nil)
+			return blocks, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pickPeer returns a peer, not yet tried, whose finalized checkpoint covers
+// the range. Our anchor is finalized, so such peers have the same history.
+func (b *Backfill) pickPeer(end types.Slot, tried map[transport.PeerID]bool) (transport.PeerID, bool) {
+	for _, p := range b.peers.Peers() {
+		if tried[p] {
+			continue
+		}
+		if st, ok := b.peers.Status(p); ok && st.Finalized.Slot >= end {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// verify checks that blocks are exactly the non-empty slots of [start, end)
+// recorded in the anchor's historical roots.
+func (b *Backfill) verify(blocks []*types.SignedBlockWithAttestation, start, end types.Slot) error {
+	i := 0
+	for slot := start; slot < end; slot++ {
+		want := b.roots[slot]
+		if want == (types.Root{}) {
+			continue
+		}
+		if i >= len(blocks) {
+			return fmt.Errorf("%w: missing block at slot %d", errBadBatch, slot)
+		}
+		block := &blocks[i].Message.Block
+		if block.Slot != slot || chain.BlockRoot(block) != want {
+			return fmt.Errorf("%w: unexpected block at slot %d", errBadBatch, block.Slot)
+		}
+		i++
+	}
+	if i != len(blocks) {
+		return fmt.Errorf("%w: %d extra blocks", errBadBatch, len(blocks)-i)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package chainsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/reqresp"
+	"github.com/devlongs/gean/storage"
+)
+
+// checkpointAnchor returns the anchor at the last of blocks, as a node
+// starting from a checkpoint would load it.
+func checkpointAnchor(t *testing.T, blocks []*types.SignedBlockWithAttestation) *chain.Anchor {
+	t.Helper()
+	remote := newChain(t, blocks)
+	last := blocks[len(blocks)-1]
+	state, ok := remote.Storage().GetState(chain.BlockRoot(&last.Message.Block))
+	if !ok {
+		t.Fatal("missing anchor state")
+	}
+	anchor, err := chain.NewAnchor(state, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return anchor
+}
+
+func TestBackfill(t *testing.T) {
+	genesis := chain.Genesis(1700000000, testValidators(4))
+	blocks := generateChain(t, genesis, 150)
+	anchor := checkpointAnchor(t, blocks)
+
+	net := newStubNetwork(append(blocks, genesis.Block))
+	net.bad["bad"] = true
+	m := newPeers("bad", "good")
+	for _, p := range m.Peers() {
+		m.UpdateStatus(p, reqresp.Status{Finalized: anchor.Checkpoint(), Head: anchor.Checkpoint()})
+	}
+
+	db := storage.NewMemoryStore()
+	local := chain.New(anchor, db, nil, 1)
+	cfg := DefaultBackfillConfig()
+	cfg.BatchSize = 32
+	b := NewBackfill(anchor, db, net, m, cfg)
+	if err := b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Oldest() != 0 {
+		t.Errorf("backfill stopped at slot %d", b.Oldest())
+	}
+	for _, block := range append(blocks, genesis.Block) {
+		if _, ok := db.GetBlock(chain.BlockRoot(&block.Message.Block)); !ok {
+			t.Errorf("block at slot %d not stored", block.Message.Block.Slot)
+		}
+	}
+	if local.Head() != anchor.Checkpoint() {
+		t.Error("backfill should not move the head")
+	}
+	if !m.IsBanned("bad") && m.Score("bad") >= 0 {
+		t.Errorf("peer serving incomplete batches should be penalised, score %d", m.Score("bad"))
+	}
+}
+
+func TestBackfillWaitsForPeers(t *testing.T) {
+	genesis := chain.Genesis(1700000000, testValidators(4))
+	blocks := generateChain(t, genesis, 10)
+	anchor := checkpointAnchor(t, blocks)
+
+	cfg := DefaultBackfillConfig()
+	cfg.RetryDelay = time.Millisecond
+	b := NewBackfill(anchor, storage.NewMemoryStore(), newStubNetwork(nil), newPeers(), cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if b.Oldest() != anchor.Checkpoint().Slot {
+		t.Error("nothing should be backfilled")
+	}
+}
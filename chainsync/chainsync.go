@@ -0,0 +1,52 @@
+// Package chainsync downloads blocks from peers to catch up with the chain.
+package chainsync
+
+import (
+	"context"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/peers"
+	"github.com/devlongs/gean/p2p/reqresp"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+// Chain is the local chain being synced.
+type Chain interface {
+	Head() types.Checkpoint
+	Finalized() types.Checkpoint
+	HasBlock(root types.Root) bool
+	ImportBlock(ctx context.Context, block *types.SignedBlockWithAttestation) error
+}
+
+// Network fetches blocks from peers. *reqresp.Client implements it.
+type Network interface {
+	BlocksByRange(ctx context.Context, peer transport.PeerID, start types.Slot, count uint64) ([]*types.SignedBlockWithAttestation, error)
+	BlocksByRoot(ctx context.Context, peer transport.PeerID, roots []types.Root) ([]*types.SignedBlockWithAttestation, error)
+}
+
+// Peers is the view of the peer manager sync needs. *peers.Manager
+// implements it.
+type Peers interface {
+	Peers() []transport.PeerID
+	Status(peer transport.PeerID) (reqresp.Status, bool)
+	ReportAction(peer transport.PeerID, a peers.Action)
+	ReportResponse(peer transport.PeerID, err error)
+}
+
+// Provider serves a chain to peers over req/resp.
+type Provider struct {
+	Chain *chain.Chain
+}
+
+func (p Provider) Status() reqresp.Status {
+	return reqresp.Status{Finalized: p.Chain.Finalized(), Head: p.Chain.Head()}
+}
+
+func (p Provider) BlockByRoot(root types.Root) (*types.SignedBlockWithAttestation, bool) {
+	return p.Chain.Block(root)
+}
+
+func (p Provider) BlocksByRange(start types.Slot, count uint64) []*types.SignedBlockWithAttestation {
+	return p.Chain.BlocksByRange(start, count)
+}
@@ -0,0 +1,303 @@
+package chainsync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/clock"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/peers"
+	"github.com/devlongs/gean/p2p/transport"
+	"github.com/devlongs/gean/p2p/validation"
+)
+
+// ErrFutureBlock is returned for blocks from a slot the clock has not
+// reached yet.
+var ErrFutureBlock = errors.New("chainsync: block from a future slot")
+
+type PendingConfig struct {
+	// MaxBlocks bounds the number of queued blocks. When the cache is full,
+	// the oldest block outside the chain being resolved is evicted.
+	MaxBlocks int
+	// Expiry is how long a block waits for its parent before it is dropped.
+	Expiry time.Duration
+	// LookupAttempts is how many peers are asked for a missing ancestor.
+	LookupAttempts int
+}
+
+func DefaultPendingConfig() PendingConfig {
+	return PendingConfig{
+		MaxBlocks:      256,
+		Expiry:         time.Duration(64*types.SecondsPerSlot) * time.Second,
+		LookupAttempts: 3,
+	}
+}
+
+type pendingBlock struct {
+	block *types.SignedBlockWithAttestation
+	peer  transport.PeerID
+	added time.Time
+}
+
+// Pending follows the chain tip. Blocks whose parent is unknown are queued
+// by parent root while the missing ancestors are fetched with BlocksByRoot;
+// once a parent is imported, its queued descendants are imported too.
+type Pending struct {
+	chain Chain
+	net   Network
+	peers Peers
+	clock *clock.SlotClock
+	cfg   PendingConfig
+	now   func() time.Time
+
+	mu       sync.Mutex
+	blocks   map[types.Root]*pendingBlock
+	children map[types.Root][]types.Root
+	lookups  map[types.Root]bool
+}
+
+// NewPending returns an empty cache. Blocks from slots clk has not reached
+// are refused.
+func NewPending(c Chain, net Network, p Peers, clk *clock.SlotClock, cfg PendingConfig) *Pending {
+	return &Pending{
+		chain:    c,
+		net:      net,
+		peers:    p,
+		clock:    clk,
+		cfg:      cfg,
+		now:      time.Now,
+		blocks:   make(map[types.Root]*pendingBlock),
+		children: make(map[types.Root][]types.Root),
+		lookups:  make(map[types.Root]bool),
+	}
+}
+
+// Has reports whether the block is queued.
+func (p *Pending) Has(root types.Root) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.blocks[root]
+	return ok
+}
+
+// Len returns the number of queued blocks.
+func (p *Pending) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.blocks)
+}
+
+// Add handles a block received from peer. If its parent is known the block
+// is imported along with any queued descendants; otherwise it is queued and
+// the first missing ancestor is requested in the background.
+func (p *Pending) Add(ctx context.Context, peer transport.PeerID, block *types.SignedBlockWithAttestation) error {
+	if block.Message.Block.Slot > p.clock.SlotAt(p.clock.Now().Add(validation.MaxClockDisparity)) {
+		return ErrFutureBlock
+	}
+	root := chain.BlockRoot(&block.Message.Block)
+	if p.chain.HasBlock(root) {
+		return nil
+	}
+	parent := block.Message.Block.ParentRoot
+	if p.chain.HasBlock(parent) {
+		if err := p.chain.ImportBlock(ctx, block); err != nil {
+			return err
+		}
+		p.importChildren(ctx, root)
+		return nil
+	}
+	if block.Message.Block.Slot <= p.chain.Finalized().Slot {
+		return nil
+	}
+
+	p.mu.Lock()
+	p.queueLocked(root, peer, block)
+	missing := parent
+	for {
+		pb, ok := p.blocks[missing]
+		if !ok {
+			break
+		}
+		missing = pb.block.Message.Block.ParentRoot
+	}
+	p.mu.Unlock()
+
+	// The ancestor may have been imported while we were queueing.
+	if p.chain.HasBlock(missing) {
+		p.importChildren(ctx, missing)
+		return nil
+	}
+	p.lookup(ctx, peer, missing)
+	return nil
+}
+
+// queueLocked queues block. When the cache is full, the oldest block that
+// does not descend from block is evicted: while ancestors are fetched one
+// by one, the tip they lead to must stay. If every queued block descends
+// from block, block itself is not queued; such a long chain is left to
+// range sync.
+func (p *Pending) queueLocked(root types.Root, peer transport.PeerID, block *types.SignedBlockWithAttestation) {
+	if _, ok := p.blocks[root]; ok {
+		return
+	}
+	p.pruneLocked()
+	if len(p.blocks) >= p.cfg.MaxBlocks {
+		resolving := p.descendantsLocked(root)
+		var oldest types.Root
+		var oldestAdded time.Time
+		for r, pb := range p.blocks {
+			if resolving[r] {
+				continue
+			}
+			if oldestAdded.IsZero() || pb.added.Before(oldestAdded) {
+				oldest, oldestAdded = r, pb.added
+			}
+		}
+		if oldestAdded.IsZero() {
+			return
+		}
+		p.removeLocked(oldest)
+	}
+	p.blocks[root] = &pendingBlock{block: block, peer: peer, added: p.now()}
+	parent := block.Message.Block.ParentRoot
+	p.children[parent] = append(p.children[parent], root)
+}
+
+// descendantsLocked returns the queued blocks descending from root.
+func (p *Pending) descendantsLocked(root types.Root) map[types.Root]bool {
+	out := make(map[types.Root]bool)
+	queue := []types.Root{root}
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		for _, c := range p.children[r] {
+			if !out[c] {
+				out[c] = true
+				queue = append(queue, c)
+			}
+		}
+	}
+	return out
+}
+
+// pruneLocked drops expired blocks and blocks that can no longer become
+// canonical because finalization has passed them.
+func (p *Pending) pruneLocked() {
+	finalized := p.chain.Finalized().Slot
+	now := p.now()
+	for root, pb := range p.blocks {
+		if now.Sub(pb.added) > p.cfg.Expiry || pb.block.Message.Block.Slot <= finalized {
+			p.removeLocked(root)
+		}
+	}
+}
+
+func (p *Pending) removeLocked(root types.Root) {
+	pb, ok := p.blocks[root]
+	if !ok {
+		return
+	}
+	delete(p.blocks, root)
+	parent := pb.block.Message.Block.ParentRoot
+	siblings := p.children[parent]
+	for i, r := range siblings {
+		if r == root {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.children, parent)
+	} else {
+		p.children[parent] = siblings
+	}
+}
+
+// importChildren imports the queued descendants of root. A block that fails
+// to import is dropped together with its descendants.
+func (p *Pending) importChildren(ctx context.Context, root types.Root) {
+	queue := []types.Root{root}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		p.mu.Lock()
+		var ready []*pendingBlock
+		for _, r := range p.children[parent] {
+			ready = append(ready, p.blocks[r])
+			delete(p.blocks, r)
+		}
+		delete(p.children, parent)
+		p.mu.Unlock()
+
+		for _, pb := range ready {
+			child := chain.BlockRoot(&pb.block.Message.Block)
+			if err := p.chain.ImportBlock(ctx, pb.block); err != nil {
+				p.peers.ReportAction(pb.peer, peers.ActionInvalidResponse)
+				p.drop(child)
+				continue
+			}
+			queue = append(queue, child)
+		}
+	}
+}
+
+// drop removes the queued descendants of root.
+func (p *Pending) drop(root types.Root) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	queue := []types.Root{root}
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		children := append([]types.Root(nil), p.children[r]...)
+		for _, c := range children {
+			p.removeLocked(c)
+		}
+		queue = append(queue, children...)
+	}
+}
+
+// lookup fetches root in the background, asking peer first and then the
+// other connected peers. At most one lookup per root is in flight.
+func (p *Pending) lookup(ctx context.Context, peer transport.PeerID, root types.Root) {
+	p.mu.Lock()
+	if p.lookups[root] {
+		p.mu.Unlock()
+		return
+	}
+	p.lookups[root] = true
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.lookups, root)
+			p.mu.Unlock()
+		}()
+
+		candidates := []transport.PeerID{peer}
+		for _, other := range p.peers.Peers() {
+			if other != peer {
+				candidates = append(candidates, other)
+			}
+		}
+		for i, from := range candidates {
+			if i >= p.cfg.LookupAttempts || ctx.Err() != nil {
+				return
+			}
+			blocks, err := p.net.BlocksByRoot(ctx, from, []types.Root{root})
+			p.peers.ReportResponse(from, err)
+			if err != nil || len(blocks) == 0 {
+				continue
+			}
+			if err := p.Add(ctx, from, blocks[0]); err != nil {
+				p.peers.ReportAction(from, peers.ActionInvalidResponse)
+			}
+			return
+		}
+	}()
+}
@@ -0,0 +1,238 @@
+package chainsync
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/clock"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/peers"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+// stubNetwork serves a fixed set of blocks. Peers marked bad leave out the
+// first block of every range.
+type stubNetwork struct {
+	mu     sync.Mutex
+	blocks map[types.Root]*types.SignedBlockWithAttestation
+	bad    map[transport.PeerID]bool
+}
+
+func newStubNetwork(blocks []*types.SignedBlockWithAttestation) *stubNetwork {
+	n := &stubNetwork{
+		blocks: make(map[types.Root]*types.SignedBlockWithAttestation),
+		bad:    make(map[transport.PeerID]bool),
+	}
+	for _, b := range blocks {
+		n.blocks[chain.BlockRoot(&b.Message.Block)] = b
+	}
+	return n
+}
+
+func (n *stubNetwork) BlocksByRange(ctx context.Context, peer transport.PeerID, start types.Slot, count uint64) ([]*types.SignedBlockWithAttestation, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var out []*types.SignedBlockWithAttestation
+	for _, b := range n.blocks {
+		if s := b.Message.Block.Slot; s >= start && uint64(s-start) < count {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Message.Block.Slot < out[j].Message.Block.Slot })
+	if n.bad[peer] && len(out) > 0 {
+		out = out[1:]
+	}
+	return out, nil
+}
+
+func (n *stubNetwork) BlocksByRoot(ctx context.Context, peer transport.PeerID, roots []types.Root) ([]*types.SignedBlockWithAttestation, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var out []*types.SignedBlockWithAttestation
+	for _, r := range roots {
+		if b, ok := n.blocks[r]; ok {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+type nopDisconnecter struct{}
+
+func (nopDisconnecter) Disconnect(transport.PeerID) {}
+
+func newPeers(ids ...transport.PeerID) *peers.Manager {
+	m := peers.NewManager(peers.DefaultConfig(), nopDisconnecter{})
+	for _, id := range ids {
+		m.Connected(id)
+	}
+	return m
+}
+
+func testClock() *clock.SlotClock { return clock.New(1700000000) }
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPendingCatchesUp(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 20)
+	remote := newChain(t, blocks)
+	local := newChain(t, blocks[:10])
+
+	p := NewPending(local, newStubNetwork(blocks), newPeers("peer"), testClock(), DefaultPendingConfig())
+	tip := blocks[len(blocks)-1]
+	if err := p.Add(context.Background(), "peer", tip); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return local.Head() == remote.Head() })
+	if p.Len() != 0 {
+		t.Errorf("%d blocks left in the cache", p.Len())
+	}
+}
+
+func TestPendingImportsWhenParentArrives(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 3)
+	local := newChain(t, nil)
+
+	// Nobody can serve the missing parent.
+	p := NewPending(local, newStubNetwork(nil), newPeers("peer"), testClock(), DefaultPendingConfig())
+	for _, b := range blocks[1:] {
+		if err := p.Add(context.Background(), "peer", b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, b := range blocks[1:] {
+		if !p.Has(chain.BlockRoot(&b.Message.Block)) {
+			t.Errorf("block at slot %d should be queued", b.Message.Block.Slot)
+		}
+	}
+
+	if err := p.Add(context.Background(), "peer", blocks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if local.Head().Slot != 3 {
+		t.Errorf("head at slot %d, want 3", local.Head().Slot)
+	}
+	if p.Len() != 0 {
+		t.Errorf("%d blocks left in the cache", p.Len())
+	}
+}
+
+func TestPendingDropsInvalidDescendants(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 3)
+	local := newChain(t, nil)
+	m := newPeers("good", "bad")
+
+	p := NewPending(local, newStubNetwork(nil), m, testClock(), DefaultPendingConfig())
+	bad := *blocks[1]
+	bad.Message.Block.StateRoot[0] ^= 1
+	child := *blocks[2]
+	child.Message.Block.ParentRoot = chain.BlockRoot(&bad.Message.Block)
+	p.Add(context.Background(), "bad", &bad)
+	p.Add(context.Background(), "bad", &child)
+
+	p.Add(context.Background(), "good", blocks[0])
+	if local.Head().Slot != 1 {
+		t.Errorf("head at slot %d, want 1", local.Head().Slot)
+	}
+	if p.Len() != 0 {
+		t.Error("invalid block and its descendants should be dropped")
+	}
+	if m.Score("bad") >= 0 {
+		t.Errorf("sender of the invalid block should be penalised, score %d", m.Score("bad"))
+	}
+}
+
+func TestPendingBoundsAndExpiry(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 6)
+	local := newChain(t, nil)
+
+	cfg := DefaultPendingConfig()
+	cfg.MaxBlocks = 3
+	cfg.Expiry = time.Minute
+	p := NewPending(local, newStubNetwork(nil), newPeers("peer"), testClock(), cfg)
+	now := time.Unix(0, 0)
+	p.now = func() time.Time { return now }
+
+	for _, b := range blocks[1:] {
+		now = now.Add(time.Second)
+		p.Add(context.Background(), "peer", b)
+	}
+	if p.Len() != 3 {
+		t.Fatalf("cache holds %d blocks, want 3", p.Len())
+	}
+	if p.Has(chain.BlockRoot(&blocks[1].Message.Block)) {
+		t.Error("oldest block should be evicted")
+	}
+
+	now = now.Add(2 * time.Minute)
+	p.Add(context.Background(), "peer", blocks[1])
+	if p.Len() != 1 {
+		t.Errorf("expired blocks should be dropped, %d left", p.Len())
+	}
+}
+
+func TestPendingKeepsResolvingChain(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 6)
+	local := newChain(t, nil)
+
+	cfg := DefaultPendingConfig()
+	cfg.MaxBlocks = 3
+	p := NewPending(local, newStubNetwork(nil), newPeers("peer"), testClock(), cfg)
+	now := time.Unix(0, 0)
+	p.now = func() time.Time { return now }
+
+	// An unrelated block is queued first, then the tip and its ancestors
+	// arrive newest first, as they do while walking back.
+	unrelated := *blocks[1]
+	unrelated.Message.Block.ParentRoot = types.Root{0xff}
+	order := []*types.SignedBlockWithAttestation{&unrelated, blocks[5], blocks[4], blocks[3], blocks[2]}
+	for _, b := range order {
+		now = now.Add(time.Second)
+		p.Add(context.Background(), "peer", b)
+	}
+	if p.Has(chain.BlockRoot(&unrelated.Message.Block)) {
+		t.Error("the unrelated block should be evicted")
+	}
+	for _, b := range blocks[3:] {
+		if !p.Has(chain.BlockRoot(&b.Message.Block)) {
+			t.Errorf("block at slot %d of the resolving chain was evicted", b.Message.Block.Slot)
+		}
+	}
+	if p.Len() != 3 {
+		t.Errorf("cache holds %d blocks, want 3", p.Len())
+	}
+}
+
+func TestPendingRejectsFutureBlocks(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 6)
+	local := newChain(t, nil)
+
+	// The clock is at slot 2.
+	clk := clock.NewWithTime(1700000000, func() time.Time {
+		return time.Unix(1700000000+2*int64(types.SecondsPerSlot), 0)
+	})
+	p := NewPending(local, newStubNetwork(nil), newPeers("peer"), clk, DefaultPendingConfig())
+	if err := p.Add(context.Background(), "peer", blocks[4]); !errors.Is(err, ErrFutureBlock) {
+		t.Errorf("expected ErrFutureBlock, got %v", err)
+	}
+	if p.Len() != 0 {
+		t.Error("a future block should not be queued")
+	}
+	if err := p.Add(context.Background(), "peer", blocks[0]); err != nil {
+		t.Errorf("a block at the current slot should be accepted: %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package chainsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/clock"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/peers"
+	"github.com/devlongs/gean/p2p/reqresp"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+var ErrNoPeers = errors.New("chainsync: no peer can serve the range")
+
+type Config struct {
+	// SyncDistance is how far a peer's head must be ahead of ours before
+	// range sync starts; closer heads are followed through gossip.
+	SyncDistance types.Slot
+	// BatchSize is the number of slots requested per BlocksByRange.
+	BatchSize uint64
+	// ParallelBatches is how many batches are downloaded at once.
+	ParallelBatches int
+	// MaxAttempts bounds how often a batch is downloaded before giving up.
+	MaxAttempts int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		SyncDistance:    4,
+		BatchSize:       64,
+		ParallelBatches: 4,
+		MaxAttempts:     5,
+	}
+}
+
+// RangeSync catches up with peers far ahead of us. The slot range is split
+// into batches that are downloaded from several peers in parallel and then
+// imported strictly in order. A batch that fails to download or import is
+// fetched again from another peer.
+type RangeSync struct {
+	chain Chain
+	net   Network
+	peers Peers
+	clock *clock.SlotClock
+	cfg   Config
+}
+
+// NewRangeSync returns a range sync. Peer heads past the current slot of
+// clk are not trusted as sync targets.
+func NewRangeSync(c Chain, net Network, p Peers, clk *clock.SlotClock, cfg Config) *RangeSync {
+	return &RangeSync{chain: c, net: net, peers: p, clock: clk, cfg: cfg}
+}
+
+type batch struct {
+	index  int
+	start  types.Slot
+	count  uint64
+	tried  map[transport.PeerID]bool
+	blocks []*types.SignedBlockWithAttestation
+	peer   transport.PeerID
+	err    error
+}
+
+// Target returns the highest head slot among peers, if it is at least
+// SyncDistance ahead of ours. Heads claimed beyond the current slot are
+// ignored.
+func (r *RangeSync) Target() (types.Slot, bool) {
+	ours := r.chain.Head().Slot
+	current := r.clock.CurrentSlot()
+	var best types.Slot
+	for _, p := range r.peers.Peers() {
+		if st, ok := r.peers.Status(p); ok && st.Head.Slot > best && st.Head.Slot <= current {
+			best = st.Head.Slot
+		}
+	}
+	return best, best >= ours+r.cfg.SyncDistance
+}
+
+// Sync downloads and imports blocks until we reach the target from Target.
+// It returns nil immediately when no peer is far enough ahead.
+//
+// Sync starts after our head. If peers do not build on it, our head is on a
+// fork they do not have, and sync starts over after the finalized block,
+// which every peer shares.
+func (r *RangeSync) Sync(ctx context.Context) error {
+	target, ok := r.Target()
+	if !ok {
+		return nil
+	}
+	start := r.chain.Head().Slot + 1
+	fromFinalized := false
+
+	var prev *batch
+	for start <= target {
+		var batches []*batch
+		for i := 0; i < r.cfg.ParallelBatches && start <= target; i++ {
+			count := min(r.cfg.BatchSize, uint64(target-start)+1)
+			batches = append(batches, &batch{index: i, start: start, count: count, tried: make(map[transport.PeerID]bool)})
+			start += types.Slot(count)
+		}
+
+		var wg sync.WaitGroup
+		for _, b := range batches {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.download(ctx, b)
+			}()
+		}
+		wg.Wait()
+
+		for _, b := range batches {
+			err := r.importBatch(ctx, b, prev)
+			if errors.Is(err, errOffChain) && !fromFinalized {
+				start, prev, fromFinalized = r.chain.Finalized().Slot+1, nil, true
+				break
+			}
+			if errors.Is(err, errForkedBatch) {
+				// The previous batch took us onto a chain the peers do not
+				// build on. Start again from our new head.
+				start, prev = r.chain.Head().Slot+1, nil
+				break
+			}
+			if err != nil {
+				return err
+			}
+			prev = b
+		}
+	}
+	return nil
+}
+
+// errOffChain reports a first batch that does not build on our chain.
+var errOffChain = errors.New("batch does not build on our chain")
+
+// errForkedBatch reports a batch that does not build on the previous one
+// although two peers agree on it.
+var errForkedBatch = errors.New("batch does not build on the previous batch")
+
+// importBatch imports a downloaded batch, downloading it again from another
+// peer when its blocks fail to import. prev is the batch imported just
+// before, if any.
+//
+// A batch whose first parent is unknown may be the fault of its own peer,
+// serving another fork, or of the peer of prev, serving another fork or
+// leaving blocks out. The batch is fetched once more to tell them apart:
+// if a second peer serves the same gap, prev is blamed; if it does not, the
+// first peer is.
+func (r *RangeSync) importBatch(ctx context.Context, b *batch, prev *batch) error {
+	var suspect transport.PeerID
+	for {
+		if b.err != nil {
+			return fmt.Errorf("batch at slot %d: %w", b.start, b.err)
+		}
+		if len(b.blocks) > 0 && !r.chain.HasBlock(b.blocks[0].Message.Block.ParentRoot) {
+			if suspect == "" {
+				suspect = b.peer
+				r.download(ctx, b)
+				continue
+			}
+			if prev == nil {
+				return fmt.Errorf("batch at slot %d: %w", b.start, errOffChain)
+			}
+			r.peers.ReportAction(prev.peer, peers.ActionInvalidResponse)
+			return errForkedBatch
+		}
+		if suspect != "" && len(b.blocks) > 0 {
+			r.peers.ReportAction(suspect, peers.ActionInvalidResponse)
+			suspect = ""
+		}
+		err := r.importBlocks(ctx, b.blocks)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.peers.ReportAction(b.peer, peers.ActionInvalidResponse)
+		r.download(ctx, b)
+	}
+}
+
+func (r *RangeSync) importBlocks(ctx context.Context, blocks []*types.SignedBlockWithAttestation) error {
+	for _, block := range blocks {
+		if err := r.chain.ImportBlock(ctx, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download fetches the batch from a peer that has not served it before,
+// retrying with other peers until it gets a batch with valid parent
+// linkage or runs out of attempts.
+func (r *RangeSync) download(ctx context.Context, b *batch) {
+	for len(b.tried) < r.cfg.MaxAttempts {
+		peer, ok := r.pickPeer(b)
+		if !ok {
+			b.err = ErrNoPeers
+			return
+		}
+		b.tried[peer] = true
+
+		blocks, err := r.net.BlocksByRange(ctx, peer, b.start, b.count)
+		if err == nil {
+			err = checkLinkage(blocks)
+			if err == nil {
+				st, _ := r.peers.Status(peer)
+				err = checkKnownSlots(st, b, blocks)
+			}
+			if err != nil {
+				r.peers.ReportAction(peer, peers.ActionInvalidResponse)
+			} else {
+				r.peers.ReportResponse(peer, nil)
+			}
+		} else {
+			r.peers.ReportResponse(peer, err)
+		}
+		if ctx.Err() != nil {
+			b.err = ctx.Err()
+			return
+		}
+		if err == nil {
+			b.blocks, b.peer, b.err = blocks, peer, nil
+			return
+		}
+	}
+	b.err = fmt.Errorf("%w after %d attempts", ErrNoPeers, len(b.tried))
+}
+
+// pickPeer chooses among peers whose head reaches the batch, spreading
+// batches over peers by index.
+func (r *RangeSync) pickPeer(b *batch) (transport.PeerID, bool) {
+	var candidates []transport.PeerID
+	for _, p := range r.peers.Peers() {
+		if b.tried[p] {
+			continue
+		}
+		if st, ok := r.peers.Status(p); ok && st.Head.Slot >= b.start {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+	return candidates[b.index%len(candidates)], true
+}
+
+// checkLinkage verifies that each block's parent is the block before it.
+func checkLinkage(blocks []*types.SignedBlockWithAttestation) error {
+	for i := 1; i < len(blocks); i++ {
+		parent := chain.BlockRoot(&blocks[i-1].Message.Block)
+		if blocks[i].Message.Block.ParentRoot != parent {
+			return fmt.Errorf("block at slot %d does not build on slot %d", blocks[i].Message.Block.Slot, blocks[i-1].Message.Block.Slot)
+		}
+	}
+	return nil
+}
+
+// checkKnownSlots verifies that the batch holds the blocks the peer's
+// status commits to: its head and finalized blocks exist at their slots, so
+// a batch covering them cannot leave them out.
+func checkKnownSlots(st reqresp.Status, b *batch, blocks []*types.SignedBlockWithAttestation) error {
+	for _, cp := range []types.Checkpoint{st.Head, st.Finalized} {
+		if cp.Slot < b.start || uint64(cp.Slot-b.start) >= b.count {
+			continue
+		}
+		found := false
+		for _, block := range blocks {
+			if block.Message.Block.Slot == cp.Slot {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("batch at slot %d lacks the block at slot %d", b.start, cp.Slot)
+		}
+	}
+	return nil
+}
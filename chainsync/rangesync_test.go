@@ -0,0 +1,281 @@
+package chainsync
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/clock"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/host"
+	"github.com/devlongs/gean/p2p/peers"
+	"github.com/devlongs/gean/p2p/reqresp"
+	"github.com/devlongs/gean/p2p/transport"
+	"github.com/devlongs/gean/storage"
+)
+
+func testValidators(n int) []types.Validator {
+	validators := make([]types.Validator, n)
+	for i := range validators {
+		validators[i] = types.Validator{Pubkey: types.Bytes52{byte(i + 1)}, Index: types.ValidatorIndex(i)}
+	}
+	return validators
+}
+
+// generateChain builds a chain of blocks on top of genesis, skipping every
+// seventh slot.
+func generateChain(t *testing.T, anchor *chain.Anchor, head types.Slot) []*types.SignedBlockWithAttestation {
+	t.Helper()
+	var blocks []*types.SignedBlockWithAttestation
+	state := anchor.State
+	for slot := types.Slot(1); slot <= head; slot++ {
+		if slot%7 == 0 {
+			continue
+		}
+		block, post, err := chain.BuildBlock(state, slot, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, &types.SignedBlockWithAttestation{
+			Message: types.BlockWithAttestation{Block: *block},
+		})
+		state = post
+	}
+	return blocks
+}
+
+func newChain(t *testing.T, blocks []*types.SignedBlockWithAttestation) *chain.Chain {
+	t.Helper()
+	c := chain.New(chain.Genesis(1700000000, testValidators(4)), storage.NewMemoryStore(), nil, 1)
+	for _, b := range blocks {
+		if err := c.ImportBlock(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func newHost(t *testing.T, id transport.PeerID) *host.Host {
+	t.Helper()
+	h := host.New(id, transport.NewTCP(id))
+	if err := h.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// corruptProvider serves blocks whose state roots do not match, so their
+// parent linkage holds but the state transition fails.
+type corruptProvider struct {
+	Provider
+}
+
+func (p corruptProvider) BlocksByRange(start types.Slot, count uint64) []*types.SignedBlockWithAttestation {
+	blocks := p.Provider.BlocksByRange(start, count)
+	out := make([]*types.SignedBlockWithAttestation, len(blocks))
+	for i, b := range blocks {
+		bad := *b
+		bad.Message.Block.StateRoot[0] ^= 1
+		out[i] = &bad
+	}
+	return out
+}
+
+// emptyProvider advertises the chain but serves no blocks by range.
+type emptyProvider struct {
+	Provider
+}
+
+func (emptyProvider) BlocksByRange(types.Slot, uint64) []*types.SignedBlockWithAttestation {
+	return nil
+}
+
+type testNode struct {
+	chain *chain.Chain
+	peers *peers.Manager
+	sync  *RangeSync
+}
+
+// setup starts a syncing node connected to one server per provider.
+func setup(t *testing.T, cfg Config, providers ...reqresp.Provider) *testNode {
+	t.Helper()
+	h := newHost(t, "client")
+	m := peers.NewManager(peers.DefaultConfig(), h)
+	h.Notify(m)
+	client := reqresp.NewClient(h, reqresp.DefaultConfig())
+
+	local := newChain(t, nil)
+	ours := Provider{Chain: local}.Status()
+	for i, p := range providers {
+		server := newHost(t, transport.PeerID(fmt.Sprintf("server-%d", i)))
+		reqresp.NewServer(server, p, reqresp.DefaultConfig())
+		peer, err := h.Connect(context.Background(), server.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, err := client.Status(context.Background(), peer, ours)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.UpdateStatus(peer, *status)
+	}
+	return &testNode{chain: local, peers: m, sync: NewRangeSync(local, client, m, clock.New(1700000000), cfg)}
+}
+
+func TestRangeSync(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 300)
+	remote := newChain(t, blocks)
+
+	cfg := DefaultConfig()
+	cfg.BatchSize = 16
+	node := setup(t, cfg, Provider{Chain: remote}, Provider{Chain: remote}, Provider{Chain: remote})
+
+	if _, ok := node.sync.Target(); !ok {
+		t.Fatal("expected a sync target")
+	}
+	if err := node.sync.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if node.chain.Head() != remote.Head() {
+		t.Errorf("head %v, want %v", node.chain.Head(), remote.Head())
+	}
+	if _, ok := node.sync.Target(); ok {
+		t.Error("no target expected once synced")
+	}
+	for _, p := range node.peers.Peers() {
+		if node.peers.Score(p) <= 0 {
+			t.Errorf("peer %s should be rewarded, score %d", p, node.peers.Score(p))
+		}
+	}
+}
+
+func TestRangeSyncRetriesBadPeer(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 100)
+	remote := newChain(t, blocks)
+
+	cfg := DefaultConfig()
+	cfg.BatchSize = 10
+	node := setup(t, cfg, corruptProvider{Provider{Chain: remote}}, Provider{Chain: remote})
+
+	if err := node.sync.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if node.chain.Head() != remote.Head() {
+		t.Errorf("head %v, want %v", node.chain.Head(), remote.Head())
+	}
+	if !node.peers.IsBanned("server-0") && node.peers.Score("server-0") >= 0 {
+		t.Errorf("bad peer should be penalised, score %d", node.peers.Score("server-0"))
+	}
+}
+
+func TestRangeSyncFailsWithoutGoodPeers(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 40)
+	remote := newChain(t, blocks)
+
+	node := setup(t, DefaultConfig(), corruptProvider{Provider{Chain: remote}})
+	if err := node.sync.Sync(context.Background()); err == nil {
+		t.Error("expected sync to fail")
+	}
+	if node.chain.Head().Slot != 0 {
+		t.Error("no blocks should be imported")
+	}
+}
+
+func TestRangeSyncBlamesEmptyBatch(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 100)
+	remote := newChain(t, blocks)
+
+	cfg := DefaultConfig()
+	cfg.BatchSize = 10
+	node := setup(t, cfg, emptyProvider{Provider{Chain: remote}}, Provider{Chain: remote}, Provider{Chain: remote})
+
+	if err := node.sync.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if node.chain.Head() != remote.Head() {
+		t.Errorf("head %v, want %v", node.chain.Head(), remote.Head())
+	}
+	if !node.peers.IsBanned("server-0") && node.peers.Score("server-0") >= 0 {
+		t.Errorf("peer leaving blocks out should be penalised, score %d", node.peers.Score("server-0"))
+	}
+	for _, p := range []transport.PeerID{"server-1", "server-2"} {
+		if node.peers.Score(p) < 0 {
+			t.Errorf("honest peer %s blamed, score %d", p, node.peers.Score(p))
+		}
+	}
+}
+
+func TestRangeSyncLeavesLocalFork(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 40)
+	remote := newChain(t, blocks)
+
+	cfg := DefaultConfig()
+	cfg.BatchSize = 8
+	node := setup(t, cfg, Provider{Chain: remote}, Provider{Chain: remote})
+
+	// Our head is a block at slot 8 built directly on slot 5, which no peer
+	// has.
+	for _, b := range blocks[:5] {
+		if err := node.chain.ImportBlock(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fork, _, err := chain.BuildBlock(node.chain.HeadState(), 8, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node.chain.ImportBlock(context.Background(), &types.SignedBlockWithAttestation{
+		Message: types.BlockWithAttestation{Block: *fork},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := node.sync.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !node.chain.HasBlock(remote.Head().Root) {
+		t.Error("the peers' chain should be imported")
+	}
+}
+
+func TestTargetIgnoresFutureHeads(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 20)
+	node := setup(t, DefaultConfig(), Provider{Chain: newChain(t, blocks)})
+
+	// The clock is at slot 10, behind the peer's head at slot 20.
+	node.sync.clock = clock.NewWithTime(1700000000, func() time.Time {
+		return time.Unix(1700000000+10*int64(types.SecondsPerSlot), 0)
+	})
+	if _, ok := node.sync.Target(); ok {
+		t.Error("a head beyond the current slot should not be a target")
+	}
+}
+
+func TestCheckKnownSlots(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 10)
+	st := reqresp.Status{Head: types.Checkpoint{Slot: 10}, Finalized: types.Checkpoint{Slot: 2}}
+	b := &batch{start: 1, count: 10}
+	if err := checkKnownSlots(st, b, blocks); err != nil {
+		t.Error(err)
+	}
+	if err := checkKnownSlots(st, b, blocks[:len(blocks)-1]); err == nil {
+		t.Error("expected an error for a missing head block")
+	}
+	if err := checkKnownSlots(st, &batch{start: 3, count: 5}, nil); err != nil {
+		t.Errorf("an empty range without known blocks is fine: %v", err)
+	}
+}
+
+func TestCheckLinkage(t *testing.T) {
+	blocks := generateChain(t, chain.Genesis(1700000000, testValidators(4)), 5)
+	if err := checkLinkage(blocks); err != nil {
+		t.Error(err)
+	}
+	blocks[1], blocks[2] = blocks[2], blocks[1]
+	if err := checkLinkage(blocks); err == nil {
+		t.Error("expected linkage error")
+	}
+}
@@ -0,0 +1,196 @@
+// Command gean-signer is a reference remote signer. It serves the
+// remotesigner HTTP API for a set of local keys to clients holding its
+// token, over TLS when given a certificate, and checks every request
+// against its slashing protection database.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/keystore"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/crypto/xmss"
+	"github.com/devlongs/gean/validator/remotesigner"
+	"github.com/devlongs/gean/validator/slashing"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:9000", "TCP address to serve the signing API on")
+	keystoreDir := flag.String("keystore-dir", "", "directory of encrypted keystores to serve")
+	passwordFile := flag.String("password-file", "", "file holding the password of the keystores")
+	leafRange := flag.String("leaf-range", "", "restrict keystore keys to the one-time keys first:end, leaving the rest to a node's local fallback")
+	mockKeys := flag.Int("mock-keys", 0, "serve this many deterministic mock keys (seeds 0..n-1)")
+	slashingDB := flag.String("slashing-db", "slashing-protection.json", "slashing protection database")
+	genesisRoot := flag.String("genesis-root", "", "genesis validators root recorded in the slashing database")
+	var sc serverConfig
+	flag.StringVar(&sc.tokenFile, "token-file", "", "file holding the bearer token clients must present (required)")
+	flag.StringVar(&sc.tlsCert, "tls-cert", "", "TLS certificate to serve https with")
+	flag.StringVar(&sc.tlsKey, "tls-key", "", "private key of --tls-cert")
+	flag.StringVar(&sc.clientCA, "tls-client-ca", "", "CA certificates clients must present a certificate from")
+	flag.Parse()
+
+	keys, err := loadKeys(*keystoreDir, *passwordFile, *leafRange, *mockKeys)
+	if err == nil {
+		err = run(*listen, keys, *slashingDB, *genesisRoot, sc)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gean-signer:", err)
+		os.Exit(1)
+	}
+}
+
+// loadKeys decrypts the keystores in dir, restricted to leafRange if set,
+// and adds mockKeys mock keys.
+func loadKeys(dir, passwordFile, leafRange string, mockKeys int) ([]signature.Signer, error) {
+	var keys []signature.Signer
+	if dir != "" {
+		if passwordFile == "" {
+			return nil, errors.New("--password-file is required with --keystore-dir")
+		}
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, err
+		}
+		password := strings.TrimRight(string(data), "\r\n")
+		d, err := keystore.OpenDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		list, err := d.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, ks := range list {
+			s, err := rangeSigner(d, ks, password, leafRange)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", ks.Pubkey, err)
+			}
+			keys = append(keys, s)
+		}
+	}
+	for i := 0; i < mockKeys; i++ {
+		keys = append(keys, signature.NewMockSigner(uint64(i)))
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys to serve")
+	}
+	return keys, nil
+}
+
+type serverConfig struct {
+	tokenFile string
+	tlsCert   string
+	tlsKey    string
+	clientCA  string
+}
+
+// tlsConfig returns the TLS settings, or nil to serve plain http.
+func (sc serverConfig) tlsConfig() (*tls.Config, error) {
+	if sc.tlsCert == "" && sc.tlsKey == "" {
+		if sc.clientCA != "" {
+			return nil, errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(sc.tlsCert, sc.tlsKey)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if sc.clientCA != "" {
+		pem, err := os.ReadFile(sc.clientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s holds no certificates", sc.clientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// rangeSigner decrypts ks and returns its signer, restricted to the leaves
+// first:end given by leafRange unless that is empty.
+func rangeSigner(d *keystore.Dir, ks *keystore.Keystore, password, leafRange string) (*xmss.Signer, error) {
+	pubkey, err := ks.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if leafRange == "" {
+		return d.Signer(pubkey, password)
+	}
+	firstStr, endStr, ok := strings.Cut(leafRange, ":")
+	if !ok {
+		return nil, fmt.Errorf("--leaf-range %q is not first:end", leafRange)
+	}
+	first, err := strconv.ParseUint(firstStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("--leaf-range: %w", err)
+	}
+	end, err := strconv.ParseUint(endStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("--leaf-range: %w", err)
+	}
+	key, err := ks.Decrypt(password)
+	if err != nil {
+		return nil, err
+	}
+	return xmss.NewRangeSigner(key, d.Leaves(pubkey), first, end)
+}
+
+func run(listen string, keys []signature.Signer, slashingDB, genesisRoot string, sc serverConfig) error {
+	if sc.tokenFile == "" {
+		return errors.New("--token-file is required")
+	}
+	data, err := os.ReadFile(sc.tokenFile)
+	if err != nil {
+		return err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("%s holds no token", sc.tokenFile)
+	}
+	tlsCfg, err := sc.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	if slashingDB == "" {
+		return errors.New("--slashing-db is required")
+	}
+	var root types.Root
+	if genesisRoot != "" {
+		if root, err = remotesigner.ParseRoot(genesisRoot); err != nil {
+			return fmt.Errorf("--genesis-root: %w", err)
+		}
+	}
+	db, err := slashing.Open(slashingDB, root)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if tlsCfg != nil {
+		ln = tls.NewListener(ln, tlsCfg)
+		scheme = "https"
+	}
+	fmt.Printf("Serving %d keys on %s://%s\n", len(keys), scheme, ln.Addr())
+	return http.Serve(ln, remotesigner.NewServer(keys, db, token))
+}
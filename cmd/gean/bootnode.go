@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/devlongs/gean/p2p/discover"
+)
+
+// runBootnode runs discovery only, so other nodes can join the network
+// through it.
+func runBootnode(args []string) error {
+	fs := flag.NewFlagSet("bootnode", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:9000", "UDP address to listen on")
+	nodeKey := fs.String("nodekey", "", "file holding the node key, created if missing (default: ephemeral key)")
+	bootnodes := fs.String("bootnodes", "", "comma-separated records of other bootnodes")
+	fs.Parse(args)
+
+	key, err := loadNodeKey(*nodeKey)
+	if err != nil {
+		return err
+	}
+	records, err := parseBootnodes(*bootnodes)
+	if err != nil {
+		return err
+	}
+	addr, err := net.ResolveUDPAddr("udp", *listen)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	cfg := discover.DefaultConfig()
+	cfg.PrivateKey = key
+	cfg.Bootnodes = records
+	d := discover.Listen(conn, cfg)
+	defer d.Close()
+
+	fmt.Printf("Bootnode listening on %s\n", conn.LocalAddr())
+	fmt.Println(d.Self())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+	return nil
+}
+
+func loadNodeKey(path string) (ed25519.PrivateKey, error) {
+	if path == "" {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return discover.LoadOrGenerateKey(path)
+}
+
+func parseBootnodes(list string) ([]*discover.Record, error) {
+	var records []*discover.Record
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		r, err := discover.ParseENR(s)
+		if err != nil {
+			return nil, fmt.Errorf("bootnode %q: %w", s, err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/ssz"
+)
+
+// runGenesis writes the genesis state and block for a validator config.
+// The node starts from them with --checkpoint-state and --checkpoint-block.
+func runGenesis(args []string) error {
+	fs := flag.NewFlagSet("genesis", flag.ExitOnError)
+	validators := fs.String("validators", "validators.json", "validator config")
+	genesisTime := fs.Uint64("genesis-time", 0, "unix time of slot 0 (default: one minute from now)")
+	outState := fs.String("out-state", "genesis_state.ssz", "file to write the SSZ genesis state to")
+	outBlock := fs.String("out-block", "genesis_block.ssz", "file to write the SSZ genesis block to")
+	fs.Parse(args)
+
+	vs, err := chain.LoadValidators(*validators)
+	if err != nil {
+		return err
+	}
+	if len(vs) == 0 {
+		return fmt.Errorf("%s lists no validators", *validators)
+	}
+	if *genesisTime == 0 {
+		*genesisTime = uint64(time.Now().Add(time.Minute).Unix())
+	}
+
+	anchor := chain.Genesis(*genesisTime, vs)
+	if err := os.WriteFile(*outState, ssz.MarshalState(anchor.State), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*outBlock, ssz.MarshalSignedBlockWithAttestation(anchor.Block), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Genesis time %d, %d validators, root %x\n", *genesisTime, len(vs), anchor.Root)
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/keystore"
+	"github.com/devlongs/gean/crypto/xmss"
+)
+
+const keysUsage = `usage: gean keys <command> [flags]
+
+commands:
+  generate  create encrypted keys and add them to a validator config
+  list      show the keys in a keystore directory
+  import    add exported keystores to a keystore directory
+  export    write a keystore with its leaf counter for another host`
+
+// runKeys manages the encrypted XMSS keystores of a validator.
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+	switch args[0] {
+	case "generate":
+		return keysGenerate(args[1:])
+	case "list":
+		return keysList(args[1:])
+	case "import":
+		return keysImport(args[1:])
+	case "export":
+		return keysExport(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], keysUsage)
+	}
+}
+
+func keysGenerate(args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ExitOnError)
+	dir := fs.String("dir", "keys", "keystore directory")
+	count := fs.Int("count", 1, "number of keys to generate")
+	height := fs.Int("tree-height", xmss.DefaultParams.TreeHeight, "XMSS tree height; a key can sign 2^height messages")
+	passwordFile := fs.String("password-file", "", "file holding the keystore password")
+	iterations := fs.Int("kdf-iterations", keystore.DefaultIterations, "PBKDF2 iterations")
+	validators := fs.String("validators", "validators.json", "validator config to add the new keys to")
+	fs.Parse(args)
+
+	password, err := readPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+	d, err := keystore.OpenDir(*dir)
+	if err != nil {
+		return err
+	}
+	var pubkeys []types.Bytes52
+	for i := 0; i < *count; i++ {
+		key, err := xmss.GenerateKey(xmss.Params{TreeHeight: *height}, rand.Reader)
+		if err != nil {
+			return err
+		}
+		ks, err := keystore.Encrypt(key, password, *iterations)
+		if err != nil {
+			return err
+		}
+		if err := d.Store(ks); err != nil {
+			return err
+		}
+		pubkeys = append(pubkeys, key.PublicKey())
+		fmt.Println(ks.Pubkey)
+	}
+	return addValidators(*validators, pubkeys)
+}
+
+func keysList(args []string) error {
+	fs := flag.NewFlagSet("keys list", flag.ExitOnError)
+	dir := fs.String("dir", "keys", "keystore directory")
+	fs.Parse(args)
+
+	d, err := keystore.OpenDir(*dir)
+	if err != nil {
+		return err
+	}
+	list, err := d.List()
+	if err != nil {
+		return err
+	}
+	for _, ks := range list {
+		pubkey, _ := ks.PublicKey()
+		used, err := d.Leaves(pubkey).Load()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s  %d/%d signatures used\n", ks.Pubkey, used, ks.Lifetime())
+	}
+	return nil
+}
+
+func keysImport(args []string) error {
+	fs := flag.NewFlagSet("keys import", flag.ExitOnError)
+	dir := fs.String("dir", "keys", "keystore directory")
+	validators := fs.String("validators", "", "validator config to add the imported keys to")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: gean keys import [flags] <keystore.json>...")
+	}
+
+	d, err := keystore.OpenDir(*dir)
+	if err != nil {
+		return err
+	}
+	var pubkeys []types.Bytes52
+	for _, path := range fs.Args() {
+		ks, err := keystore.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := d.Import(ks); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		pubkey, _ := ks.PublicKey()
+		pubkeys = append(pubkeys, pubkey)
+		fmt.Println(ks.Pubkey)
+	}
+	if *validators == "" {
+		return nil
+	}
+	return addValidators(*validators, pubkeys)
+}
+
+func keysExport(args []string) error {
+	fs := flag.NewFlagSet("keys export", flag.ExitOnError)
+	dir := fs.String("dir", "keys", "keystore directory")
+	pubkeyHex := fs.String("pubkey", "", "public key of the key to export")
+	out := fs.String("out", "", "file to write the keystore to")
+	fs.Parse(args)
+	if *pubkeyHex == "" || *out == "" {
+		return errors.New("--pubkey and --out are required")
+	}
+
+	pubkey, err := keystore.ParsePublicKey(*pubkeyHex)
+	if err != nil {
+		return fmt.Errorf("--pubkey: %w", err)
+	}
+	d, err := keystore.OpenDir(*dir)
+	if err != nil {
+		return err
+	}
+	ks, err := d.Export(pubkey, *out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Exported with leaf counter", ks.NextLeaf, "- the key can no longer sign here.")
+	return nil
+}
+
+// addValidators appends pubkeys that are not listed yet to the validator
+// config at path, creating it if needed.
+func addValidators(path string, pubkeys []types.Bytes52) error {
+	validators, err := chain.LoadValidators(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	known := make(map[types.Bytes52]bool)
+	for _, v := range validators {
+		known[v.Pubkey] = true
+	}
+	for _, pk := range pubkeys {
+		if known[pk] {
+			continue
+		}
+		known[pk] = true
+		validators = append(validators, types.Validator{Pubkey: pk, Index: types.ValidatorIndex(len(validators))})
+	}
+	return chain.WriteValidators(path, validators)
+}
+
+func readPassword(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("--password-file is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -1,16 +1,98 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"time"
 
+	"github.com/devlongs/gean/chain"
 	"github.com/devlongs/gean/common/ssz"
 	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		commands := map[string]func([]string) error{
+			"bootnode": runBootnode,
+			"keys":     runKeys,
+			"genesis":  runGenesis,
+		}
+		if run, ok := commands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	checkpointState := flag.String("checkpoint-state", "", "SSZ-encoded finalized state to start from instead of genesis")
+	checkpointBlock := flag.String("checkpoint-block", "", "SSZ-encoded signed block matching --checkpoint-state")
+	var nc networkConfig
+	flag.StringVar(&nc.listen, "listen", "", "TCP address to accept p2p connections on; without a checkpoint, networking is off if empty")
+	flag.StringVar(&nc.nodeKey, "nodekey", "", "file holding the node key, created if missing (default: ephemeral key)")
+	flag.StringVar(&nc.staticPeers, "static-peers", "", "comma-separated peers to always stay connected to (<peer id>@<host:port> or enr:...)")
+	flag.StringVar(&nc.trustedPeers, "trusted-peers", "", "comma-separated peers exempt from scoring bans and peer limits")
+	flag.StringVar(&nc.bootnodes, "bootnodes", "", "comma-separated bootnode records (enr:...); discovery runs on the --listen address over UDP")
+	var vc validatorConfig
+	flag.StringVar(&vc.keystoreDir, "keystore-dir", "", "directory of encrypted validator keystores to perform duties for")
+	flag.StringVar(&vc.passwordFile, "password-file", "", "file holding the password of the keystores")
+	flag.StringVar(&vc.leafRange, "leaf-range", "", "restrict keystore keys to the one-time keys first:end; with --signer-url they sign only when the remote signer is unreachable, and it must not use this range")
+	flag.StringVar(&vc.signerURL, "signer-url", "", "remote signer holding the validator keys")
+	flag.StringVar(&vc.signerTokenFile, "signer-token-file", "", "file holding the bearer token of --signer-url")
+	flag.DurationVar(&vc.signerTimeout, "signer-timeout", 2*time.Second, "timeout of remote signer requests")
+	flag.IntVar(&vc.mockKeys, "mock-keys", 0, "perform duties for this many deterministic mock keys (seeds 0..n-1)")
+	flag.StringVar(&vc.slashingDB, "slashing-db", "slashing-protection.json", "slashing protection database of the validator keys")
+	scheme := flag.String("signature-scheme", signature.SchemeXMSS, "signature scheme of the validator keys (xmss or mock)")
+	flag.Parse()
+
 	fmt.Println("Gean - Go Lean Ethereum Client")
 	fmt.Println()
 
+	if *checkpointState != "" || *checkpointBlock != "" {
+		if err := startFromCheckpoint(*checkpointState, *checkpointBlock, nc, vc, *scheme); err != nil {
+			fmt.Fprintln(os.Stderr, "node:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if vc.enabled() {
+		fmt.Fprintln(os.Stderr, "validator keys need --checkpoint-state and --checkpoint-block")
+		os.Exit(1)
+	}
+	if nc.listen != "" {
+		if err := runNetwork(nc); err != nil {
+			fmt.Fprintln(os.Stderr, "network:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	demo()
+}
+
+// startFromCheckpoint runs the node from a finalized state and block, such
+// as those written by gean genesis.
+func startFromCheckpoint(statePath, blockPath string, nc networkConfig, vc validatorConfig, scheme string) error {
+	if statePath == "" || blockPath == "" {
+		return fmt.Errorf("--checkpoint-state and --checkpoint-block must be set together")
+	}
+	verifier, err := signature.NewVerifier(scheme)
+	if err != nil {
+		return err
+	}
+	anchor, err := chain.LoadCheckpoint(statePath, blockPath)
+	if err != nil {
+		return err
+	}
+	return runNode(anchor, nc, vc, verifier)
+}
+
+func demo() {
+
 	// Primitives
 	slot := types.Slot(100)
 	idx := types.ValidatorIndex(42)
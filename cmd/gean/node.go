@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/chainsync"
+	"github.com/devlongs/gean/common/clock"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/p2p/discover"
+	"github.com/devlongs/gean/p2p/gossip"
+	"github.com/devlongs/gean/p2p/host"
+	"github.com/devlongs/gean/p2p/peers"
+	"github.com/devlongs/gean/p2p/reqresp"
+	"github.com/devlongs/gean/p2p/transport"
+	"github.com/devlongs/gean/p2p/validation"
+	"github.com/devlongs/gean/pool"
+	"github.com/devlongs/gean/storage"
+)
+
+type networkConfig struct {
+	listen       string
+	nodeKey      string
+	staticPeers  string
+	trustedPeers string
+	bootnodes    string
+}
+
+const (
+	// dialInterval is how often discovered nodes are dialed while we have
+	// fewer peers than the target.
+	dialInterval = 5 * time.Second
+	dialTimeout  = 5 * time.Second
+)
+
+// network is the p2p host with its peer manager and, when listening,
+// discovery.
+type network struct {
+	host  *host.Host
+	peers *peers.Manager
+	disc  *discover.Discovery // nil if not listening
+}
+
+// startNetwork creates the host and peer manager for nc. If an address is
+// configured, it listens there for TCP connections and runs discovery on
+// the same address over UDP.
+func startNetwork(nc networkConfig) (*network, error) {
+	key, err := loadNodeKey(nc.nodeKey)
+	if err != nil {
+		return nil, err
+	}
+	cfg := peers.DefaultConfig()
+	if cfg.StaticPeers, err = parsePeerList(nc.staticPeers); err != nil {
+		return nil, err
+	}
+	if cfg.TrustedPeers, err = parsePeerIDs(nc.trustedPeers); err != nil {
+		return nil, err
+	}
+	bootnodes, err := parseBootnodes(nc.bootnodes)
+	if err != nil {
+		return nil, err
+	}
+	if len(bootnodes) > 0 && nc.listen == "" {
+		return nil, fmt.Errorf("--bootnodes needs --listen")
+	}
+
+	tr := transport.NewAuthenticatedTCP(key)
+	h := host.New(tr.ID(), tr)
+	mgr := peers.NewManager(cfg, h)
+	h.Notify(mgr)
+	n := &network{host: h, peers: mgr}
+	if nc.listen == "" {
+		return n, nil
+	}
+
+	if err := h.Listen(nc.listen); err != nil {
+		return nil, err
+	}
+	tcp := h.Addr().(*net.TCPAddr)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: tcp.IP, Port: tcp.Port})
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	dcfg := discover.DefaultConfig()
+	dcfg.PrivateKey = key
+	dcfg.TCPPort = uint16(tcp.Port)
+	dcfg.Bootnodes = bootnodes
+	n.disc = discover.Listen(conn, dcfg)
+
+	fmt.Printf("Listening on %s as %s\n", tcp, h.ID())
+	fmt.Println(n.disc.Self())
+	return n, nil
+}
+
+func (n *network) close() {
+	if n.disc != nil {
+		n.disc.Close()
+	}
+	n.host.Close()
+}
+
+// run keeps the static peers connected and dials discovered nodes until
+// ctx is done.
+func (n *network) run(ctx context.Context) {
+	if n.disc != nil {
+		go n.dialDiscovered(ctx)
+	}
+	n.peers.MaintainStatic(ctx, n.host)
+	<-ctx.Done()
+}
+
+// dialDiscovered connects to discovered nodes while we have fewer peers
+// than the target.
+func (n *network) dialDiscovered(ctx context.Context) {
+	ticker := time.NewTicker(dialInterval)
+	defer ticker.Stop()
+	for {
+		if n.peers.Wanted() > 0 {
+			n.dialNodes(ctx)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dialNodes dials the nodes in the routing table and those found by a
+// lookup of a random ID, which also refills the table.
+func (n *network) dialNodes(ctx context.Context) {
+	var target discover.NodeID
+	rand.Read(target[:])
+	for _, r := range append(n.disc.Nodes(), n.disc.Lookup(target)...) {
+		if n.peers.Wanted() == 0 || ctx.Err() != nil {
+			return
+		}
+		id := r.PeerID()
+		if r.TCP == 0 || id == n.host.ID() || n.host.IsConnected(id) || !n.peers.CanDial(id) {
+			continue
+		}
+		dctx, cancel := context.WithTimeout(ctx, dialTimeout)
+		got, err := n.host.Connect(dctx, r.TCPAddr())
+		cancel()
+		if err == nil && got != id {
+			n.host.Disconnect(got)
+		}
+	}
+}
+
+// runNetwork starts the p2p host with the peer manager and discovery and
+// keeps peers connected until interrupted.
+func runNetwork(nc networkConfig) error {
+	n, err := startNetwork(nc)
+	if err != nil {
+		return err
+	}
+	defer n.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	n.run(ctx)
+	return nil
+}
+
+// statusInterval is how often, in slots, peers are asked for their status.
+const statusInterval = 8
+
+// node follows the chain from an anchor: it imports gossip blocks, catches
+// up with range sync, backfills the blocks below the anchor and serves the
+// chain to peers. Gossip votes are kept in the pool for block proposals.
+type node struct {
+	anchor   *chain.Anchor
+	chain    *chain.Chain
+	pool     *pool.Pool
+	clock    *clock.SlotClock
+	net      *network
+	client   *reqresp.Client
+	router   *gossip.Router
+	pending  *chainsync.Pending
+	sync     *chainsync.RangeSync
+	backfill *chainsync.Backfill
+}
+
+// runNode runs a node from anchor until interrupted, performing the duties
+// of the validator keys in vc if there are any.
+func runNode(anchor *chain.Anchor, nc networkConfig, vc validatorConfig, verifier signature.Verifier) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	nw, err := startNetwork(nc)
+	if err != nil {
+		return err
+	}
+	defer nw.close()
+
+	n := newNode(ctx, anchor, nw, verifier)
+	cp := anchor.Checkpoint()
+	fmt.Printf("Anchored at slot %d, root %x\n", cp.Slot, cp.Root[:8])
+	if vc.enabled() {
+		client, err := newValidatorClient(n, vc)
+		if err != nil {
+			return err
+		}
+		go runValidator(ctx, client)
+	}
+	n.run(ctx)
+	return nil
+}
+
+func newNode(ctx context.Context, anchor *chain.Anchor, net *network, verifier signature.Verifier) *node {
+	db := storage.NewMemoryStore()
+	c := chain.New(anchor, db, verifier, runtime.NumCPU())
+	clk := clock.New(anchor.State.Config.GenesisTime)
+	client := reqresp.NewClient(net.host, reqresp.DefaultConfig())
+	p := pool.New(pool.DefaultConfig())
+	imp := importer{Chain: c, pool: p}
+	n := &node{
+		anchor:   anchor,
+		chain:    c,
+		pool:     p,
+		clock:    clk,
+		net:      net,
+		client:   client,
+		pending:  chainsync.NewPending(imp, client, net.peers, clk, chainsync.DefaultPendingConfig()),
+		sync:     chainsync.NewRangeSync(imp, client, net.peers, clk, chainsync.DefaultConfig()),
+		backfill: chainsync.NewBackfill(anchor, db, client, net.peers, chainsync.DefaultBackfillConfig()),
+	}
+
+	server := reqresp.NewServer(net.host, chainsync.Provider{Chain: c}, reqresp.DefaultConfig())
+	server.OnStatus(net.peers.UpdateStatus)
+	server.OnInvalidRequest(func(peer transport.PeerID) {
+		net.peers.ReportAction(peer, peers.ActionInvalidRequest)
+	})
+	net.host.Notify(&statusExchange{ctx: ctx, node: n})
+
+	n.router = gossip.NewRouter(net.host, gossip.DefaultConfig())
+	blocks := &validation.BlockValidator{
+		Clock:    clk,
+		Chain:    c,
+		Verifier: verifier,
+		OnUnknownParent: func(peer transport.PeerID, block *types.SignedBlockWithAttestation) {
+			n.onBlock(ctx, peer, block)
+		},
+	}
+	atts := &validation.AttestationValidator{Clock: clk, Chain: c, Verifier: verifier}
+	n.router.SetValidator(gossip.TopicBlock, validation.GossipBlockValidator(blocks, net.peers.ReportValidation))
+	n.router.SetValidator(gossip.TopicAttestation, validation.GossipAttestationValidator(atts, net.peers.ReportValidation))
+	n.router.Subscribe(gossip.TopicBlock, func(msg *gossip.Message) {
+		if block, err := gossip.DecodeBlock(msg); err == nil {
+			n.onBlock(ctx, msg.From, block)
+		}
+	})
+	n.router.Subscribe(gossip.TopicAttestation, func(msg *gossip.Message) {
+		if att, err := gossip.DecodeAttestation(msg); err == nil {
+			n.onAttestation(att)
+		}
+	})
+	return n
+}
+
+// onBlock imports a gossip block, or queues it until its parent arrives.
+func (n *node) onBlock(ctx context.Context, peer transport.PeerID, block *types.SignedBlockWithAttestation) {
+	if err := n.pending.Add(ctx, peer, block); err != nil {
+		n.net.peers.ReportAction(peer, peers.ActionInvalidResponse)
+	}
+}
+
+// onAttestation counts a validated gossip vote in fork choice and keeps it
+// for inclusion in a block.
+func (n *node) onAttestation(att *types.SignedAttestation) {
+	n.chain.ForkChoice().ProcessAttestation(att.ValidatorID, att.Message.Head)
+	n.pool.Add(att)
+}
+
+// importer imports blocks into the chain and drops from the pool the votes
+// a block includes and those finalization made useless.
+type importer struct {
+	*chain.Chain
+	pool *pool.Pool
+}
+
+func (i importer) ImportBlock(ctx context.Context, block *types.SignedBlockWithAttestation) error {
+	if err := i.Chain.ImportBlock(ctx, block); err != nil {
+		return err
+	}
+	i.pool.RemoveIncluded(block.Message.Block.Body.Attestations)
+	i.pool.Prune(i.Chain.Finalized())
+	return nil
+}
+
+// run drives the node until ctx is done: it keeps the static peers
+// connected, backfills below the anchor and, every slot, refreshes peer
+// statuses when due and range syncs if peers are far ahead.
+func (n *node) run(ctx context.Context) {
+	go n.net.run(ctx)
+	if n.anchor.Checkpoint().Slot > 0 {
+		go func() {
+			if err := n.backfill.Run(ctx); err != nil && ctx.Err() == nil {
+				fmt.Fprintln(os.Stderr, "backfill:", err)
+			}
+		}()
+	}
+
+	for {
+		slot := n.clock.CurrentSlot() + 1
+		select {
+		case <-time.After(time.Until(n.clock.SlotStart(slot))):
+		case <-ctx.Done():
+			return
+		}
+		if slot%statusInterval == 0 {
+			for _, peer := range n.net.peers.Peers() {
+				go n.exchangeStatus(ctx, peer)
+			}
+		}
+		if err := n.sync.Sync(ctx); err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, "range sync:", err)
+		}
+		head, finalized := n.chain.Head(), n.chain.Finalized()
+		fmt.Printf("Slot %d: head %d %x, finalized %d, %d peers\n", slot, head.Slot, head.Root[:4], finalized.Slot, n.net.peers.Count())
+	}
+}
+
+// exchangeStatus sends our status to peer and records theirs, which range
+// sync and backfill choose peers by.
+func (n *node) exchangeStatus(ctx context.Context, peer transport.PeerID) {
+	ours := chainsync.Provider{Chain: n.chain}.Status()
+	st, err := n.client.Status(ctx, peer, ours)
+	n.net.peers.ReportResponse(peer, err)
+	if err == nil {
+		n.net.peers.UpdateStatus(peer, *st)
+	}
+}
+
+// statusExchange exchanges statuses with every new peer.
+type statusExchange struct {
+	ctx  context.Context
+	node *node
+}
+
+func (s *statusExchange) Connected(peer transport.PeerID) { go s.node.exchangeStatus(s.ctx, peer) }
+func (s *statusExchange) Disconnected(transport.PeerID)   {}
+
+func parsePeerList(list string) ([]peers.StaticPeer, error) {
+	var out []peers.StaticPeer
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		p, err := peers.ParsePeer(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// parsePeerIDs accepts bare peer IDs as well as the static peer forms.
+func parsePeerIDs(list string) ([]transport.PeerID, error) {
+	var out []transport.PeerID
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.HasPrefix(s, "enr:") && !strings.Contains(s, "@") {
+			out = append(out, transport.PeerID(s))
+			continue
+		}
+		p, err := peers.ParsePeer(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p.ID)
+	}
+	return out, nil
+}
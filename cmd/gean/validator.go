@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/keystore"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/crypto/xmss"
+	"github.com/devlongs/gean/p2p/gossip"
+	"github.com/devlongs/gean/validator"
+	"github.com/devlongs/gean/validator/remotesigner"
+	"github.com/devlongs/gean/validator/slashing"
+)
+
+type validatorConfig struct {
+	keystoreDir  string
+	passwordFile string
+	leafRange    string
+	mockKeys     int
+	slashingDB   string
+
+	signerURL       string
+	signerTokenFile string
+	signerTimeout   time.Duration
+}
+
+// enabled reports whether any validator keys are configured.
+func (vc validatorConfig) enabled() bool {
+	return vc.keystoreDir != "" || vc.signerURL != "" || vc.mockKeys > 0
+}
+
+// signers returns the configured validator keys and mockKeys mock keys.
+//
+// Without a remote signer the keystores in keystoreDir sign locally. With
+// one, the keys are held by the service; keystores then serve as its
+// fallback and must be restricted to a leaf range the service does not use.
+// Without keystores, the keys are those the service lists.
+func (vc validatorConfig) signers() ([]signature.Signer, error) {
+	var out []signature.Signer
+	var local []*xmss.Signer
+	if vc.keystoreDir != "" {
+		if vc.signerURL != "" && vc.leafRange == "" {
+			return nil, errors.New("--leaf-range is required to fall back to --keystore-dir keys")
+		}
+		var err error
+		if local, err = vc.keystoreSigners(); err != nil {
+			return nil, err
+		}
+	}
+
+	if vc.signerURL == "" {
+		for _, s := range local {
+			out = append(out, s)
+		}
+	} else {
+		client, err := vc.signerClient()
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range local {
+			f, err := remotesigner.NewFallback(client.Signer(l.PublicKey()), l)
+			if err != nil {
+				return nil, fmt.Errorf("%x: %w", l.PublicKey(), err)
+			}
+			out = append(out, f)
+		}
+		if len(local) == 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), vc.signerTimeout)
+			pubkeys, err := client.PublicKeys(ctx)
+			cancel()
+			if err != nil {
+				return nil, fmt.Errorf("list remote signer keys: %w", err)
+			}
+			for _, pubkey := range pubkeys {
+				out = append(out, client.Signer(pubkey))
+			}
+		}
+	}
+
+	for i := 0; i < vc.mockKeys; i++ {
+		out = append(out, signature.NewMockSigner(uint64(i)))
+	}
+	return out, nil
+}
+
+// keystoreSigners decrypts the keystores in keystoreDir, restricted to
+// leafRange if set.
+func (vc validatorConfig) keystoreSigners() ([]*xmss.Signer, error) {
+	password, err := readPassword(vc.passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	d, err := keystore.OpenDir(vc.keystoreDir)
+	if err != nil {
+		return nil, err
+	}
+	list, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+	var out []*xmss.Signer
+	for _, ks := range list {
+		s, err := rangeSigner(d, ks, password, vc.leafRange)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ks.Pubkey, err)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// rangeSigner decrypts ks and returns its signer, restricted to the leaves
+// first:end given by leafRange unless that is empty.
+func rangeSigner(d *keystore.Dir, ks *keystore.Keystore, password, leafRange string) (*xmss.Signer, error) {
+	pubkey, err := ks.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if leafRange == "" {
+		return d.Signer(pubkey, password)
+	}
+	firstStr, endStr, ok := strings.Cut(leafRange, ":")
+	if !ok {
+		return nil, fmt.Errorf("--leaf-range %q is not first:end", leafRange)
+	}
+	first, err := strconv.ParseUint(firstStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("--leaf-range: %w", err)
+	}
+	end, err := strconv.ParseUint(endStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("--leaf-range: %w", err)
+	}
+	key, err := ks.Decrypt(password)
+	if err != nil {
+		return nil, err
+	}
+	return xmss.NewRangeSigner(key, d.Leaves(pubkey), first, end)
+}
+
+// signerClient returns the client of the remote signer at signerURL.
+func (vc validatorConfig) signerClient() (*remotesigner.Client, error) {
+	if vc.signerTokenFile == "" {
+		return nil, errors.New("--signer-token-file is required with --signer-url")
+	}
+	data, err := os.ReadFile(vc.signerTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("%s holds no token", vc.signerTokenFile)
+	}
+	return remotesigner.NewClient(vc.signerURL, token, vc.signerTimeout), nil
+}
+
+// validatorKeys maps signers to their index in the registry of state.
+func validatorKeys(state *types.State, signers []signature.Signer) (validator.Keys, error) {
+	index := make(map[types.Bytes52]types.ValidatorIndex, len(state.Validators))
+	for i, v := range state.Validators {
+		index[v.Pubkey] = types.ValidatorIndex(i)
+	}
+	keys := make(validator.Keys, len(signers))
+	for _, s := range signers {
+		i, ok := index[s.PublicKey()]
+		if !ok {
+			return nil, fmt.Errorf("validator key %x is not in the registry", s.PublicKey())
+		}
+		keys[i] = s
+	}
+	return keys, nil
+}
+
+// newValidatorClient returns a client performing the duties of the keys in
+// vc on n: blocks are built from the pool and imported into the chain, and
+// both blocks and attestations are published on the router.
+func newValidatorClient(n *node, vc validatorConfig) (*validator.Client, error) {
+	if vc.slashingDB == "" {
+		return nil, errors.New("--slashing-db is required with validator keys")
+	}
+	signers, err := vc.signers()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := validatorKeys(n.chain.HeadState(), signers)
+	if err != nil {
+		return nil, err
+	}
+	protect, err := slashing.Open(vc.slashingDB, types.Root{})
+	if err != nil {
+		return nil, err
+	}
+
+	c := importer{Chain: n.chain, pool: n.pool}
+	pub := publisher{Router: n.router, node: n}
+	p := validator.NewProposer(c, n.pool, pub, keys, protect)
+	a := validator.NewAttester(c, pub, keys, protect)
+	fmt.Printf("Running %d validators\n", len(keys))
+	return validator.NewClient(n.clock, p, a), nil
+}
+
+// runValidator performs validator duties until ctx is done.
+func runValidator(ctx context.Context, vc *validator.Client) {
+	vc.Run(ctx, func(slot types.Slot, err error) {
+		fmt.Fprintf(os.Stderr, "validator: slot %d: %v\n", slot, err)
+	})
+}
+
+// publisher broadcasts on the router and counts our own votes locally, as
+// the router does not deliver what we publish to our subscriptions.
+type publisher struct {
+	*gossip.Router
+	node *node
+}
+
+func (p publisher) PublishAttestation(att *types.SignedAttestation) gossip.MessageID {
+	p.node.onAttestation(att)
+	return p.Router.PublishAttestation(att)
+}
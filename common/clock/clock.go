@@ -0,0 +1,65 @@
+// Package clock maps wall-clock time to slots.
+package clock
+
+import (
+	"time"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// SlotClock reports the current slot relative to genesis.
+type SlotClock struct {
+	genesisTime uint64
+	now         func() time.Time
+}
+
+func New(genesisTime uint64) *SlotClock {
+	return NewWithTime(genesisTime, time.Now)
+}
+
+// NewWithTime uses now as the time source, for tests and simulations.
+func NewWithTime(genesisTime uint64, now func() time.Time) *SlotClock {
+	return &SlotClock{genesisTime: genesisTime, now: now}
+}
+
+func (c *SlotClock) GenesisTime() uint64 { return c.genesisTime }
+
+func (c *SlotClock) Now() time.Time { return c.now() }
+
+// SlotAt returns the slot containing t. Times before genesis map to slot 0.
+func (c *SlotClock) SlotAt(t time.Time) types.Slot {
+	unix := t.Unix()
+	if unix < 0 {
+		return 0
+	}
+	return types.TimeToSlot(uint64(unix), c.genesisTime)
+}
+
+func (c *SlotClock) CurrentSlot() types.Slot {
+	return c.SlotAt(c.now())
+}
+
+// SlotStart returns the time at which slot begins.
+func (c *SlotClock) SlotStart(slot types.Slot) time.Time {
+	return time.Unix(int64(types.SlotToTime(slot, c.genesisTime)), 0)
+}
+
+// IntervalAt returns the slot and the interval within it that contain t.
+func (c *SlotClock) IntervalAt(t time.Time) (types.Slot, uint64) {
+	slot := c.SlotAt(t)
+	elapsed := t.Sub(c.SlotStart(slot))
+	if elapsed < 0 {
+		return slot, 0
+	}
+	interval := uint64(elapsed / c.intervalDuration())
+	return slot, min(interval, types.IntervalsPerSlot-1)
+}
+
+// IntervalStart returns the time at which the interval of slot begins.
+func (c *SlotClock) IntervalStart(slot types.Slot, interval uint64) time.Time {
+	return c.SlotStart(slot).Add(time.Duration(interval) * c.intervalDuration())
+}
+
+func (c *SlotClock) intervalDuration() time.Duration {
+	return time.Duration(types.SecondsPerSlot) * time.Second / time.Duration(types.IntervalsPerSlot)
+}
@@ -0,0 +1,55 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+func TestSlotClock(t *testing.T) {
+	genesis := uint64(1700000000)
+	now := time.Unix(int64(genesis), 0)
+	c := NewWithTime(genesis, func() time.Time { return now })
+
+	if c.CurrentSlot() != 0 {
+		t.Error("slot at genesis")
+	}
+	now = now.Add(9 * time.Second)
+	if c.CurrentSlot() != 2 {
+		t.Errorf("expected slot 2, got %d", c.CurrentSlot())
+	}
+	if !c.SlotStart(2).Equal(time.Unix(int64(genesis)+8, 0)) {
+		t.Error("slot start")
+	}
+	if c.SlotAt(time.Unix(int64(genesis)-100, 0)) != 0 {
+		t.Error("before genesis")
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	genesis := uint64(1700000000)
+	c := NewWithTime(genesis, time.Now)
+
+	start := time.Unix(int64(genesis), 0)
+	tests := []struct {
+		offset   time.Duration
+		slot     types.Slot
+		interval uint64
+	}{
+		{0, 0, 0},
+		{1500 * time.Millisecond, 0, 1},
+		{3999 * time.Millisecond, 0, 3},
+		{9 * time.Second, 2, 1},
+		{-time.Hour, 0, 0},
+	}
+	for _, tt := range tests {
+		slot, interval := c.IntervalAt(start.Add(tt.offset))
+		if slot != tt.slot || interval != tt.interval {
+			t.Errorf("%v: got slot %d interval %d, want %d/%d", tt.offset, slot, interval, tt.slot, tt.interval)
+		}
+	}
+	if !c.IntervalStart(2, types.AttestInterval).Equal(start.Add(9 * time.Second)) {
+		t.Error("interval start")
+	}
+}
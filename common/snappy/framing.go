@@ -0,0 +1,172 @@
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Chunk types of the snappy framing format.
+const (
+	chunkCompressed   = 0x00
+	chunkUncompressed = 0x01
+	chunkPadding      = 0xfe
+	chunkStreamID     = 0xff
+)
+
+const (
+	maxFrameBlock = 65536
+	checksumSize  = 4
+)
+
+var (
+	streamID = []byte("sNaPpY")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	ErrChecksum    = errors.New("snappy: corrupt input: checksum mismatch")
+	ErrUnsupported = errors.New("snappy: unsupported chunk type")
+)
+
+func maskedCRC(b []byte) uint32 {
+	c := crc32.Checksum(b, crcTable)
+	return (c>>15 | c<<17) + 0xa282ead8
+}
+
+// Writer compresses data in the snappy framing format. Each Write is
+// emitted as complete chunks; there is nothing to flush.
+type Writer struct {
+	w           io.Writer
+	wroteHeader bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		hdr := append([]byte{chunkStreamID, byte(len(streamID)), 0, 0}, streamID...)
+		if _, err := w.w.Write(hdr); err != nil {
+			return 0, err
+		}
+		w.wroteHeader = true
+	}
+
+	written := 0
+	for len(p) > 0 {
+		block := p
+		if len(block) > maxFrameBlock {
+			block = block[:maxFrameBlock]
+		}
+
+		typ := byte(chunkCompressed)
+		body := encodeBlock(binary.AppendUvarint(nil, uint64(len(block))), block)
+		if len(body) >= len(block) {
+			typ, body = chunkUncompressed, block
+		}
+
+		length := checksumSize + len(body)
+		chunk := make([]byte, 0, 4+length)
+		chunk = append(chunk, typ, byte(length), byte(length>>8), byte(length>>16))
+		chunk = binary.LittleEndian.AppendUint32(chunk, maskedCRC(block))
+		chunk = append(chunk, body...)
+		if _, err := w.w.Write(chunk); err != nil {
+			return written, err
+		}
+		written += len(block)
+		p = p[len(block):]
+	}
+	return written, nil
+}
+
+// Reader decompresses a snappy framed stream. It reads from the underlying
+// reader one chunk at a time and never past the chunk it needs.
+type Reader struct {
+	r       io.Reader
+	buf     []byte
+	hdr     [4]byte
+	started bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if err := r.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *Reader) nextChunk() error {
+	if _, err := io.ReadFull(r.r, r.hdr[:]); err != nil {
+		return err
+	}
+	typ := r.hdr[0]
+	length := int(r.hdr[1]) | int(r.hdr[2])<<8 | int(r.hdr[3])<<16
+
+	if !r.started && typ != chunkStreamID {
+		return ErrCorrupt
+	}
+
+	switch {
+	case typ == chunkStreamID:
+		id := make([]byte, length)
+		if _, err := io.ReadFull(r.r, id); err != nil {
+			return unexpectedEOF(err)
+		}
+		if string(id) != string(streamID) {
+			return ErrCorrupt
+		}
+		r.started = true
+		return nil
+
+	case typ == chunkCompressed || typ == chunkUncompressed:
+		if length < checksumSize || length > checksumSize+MaxEncodedLen(maxFrameBlock) {
+			return ErrCorrupt
+		}
+		chunk := make([]byte, length)
+		if _, err := io.ReadFull(r.r, chunk); err != nil {
+			return unexpectedEOF(err)
+		}
+		sum := binary.LittleEndian.Uint32(chunk)
+		data := chunk[checksumSize:]
+		if typ == chunkCompressed {
+			var err error
+			if data, err = Decode(data, maxFrameBlock); err != nil {
+				return err
+			}
+		} else if len(data) > maxFrameBlock {
+			return ErrCorrupt
+		}
+		if maskedCRC(data) != sum {
+			return ErrChecksum
+		}
+		r.buf = data
+		return nil
+
+	case typ >= 0x80:
+		// Padding and reserved skippable chunks.
+		if _, err := io.CopyN(io.Discard, r.r, int64(length)); err != nil {
+			return unexpectedEOF(err)
+		}
+		return nil
+
+	default:
+		return ErrUnsupported
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
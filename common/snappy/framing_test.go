@@ -0,0 +1,95 @@
+package snappy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func frame(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := NewWriter(&buf).Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFramingRoundTrip(t *testing.T) {
+	random := make([]byte, 150000)
+	rand.New(rand.NewSource(3)).Read(random)
+
+	for name, in := range map[string][]byte{
+		"small":      []byte("hello snappy"),
+		"repetitive": bytes.Repeat([]byte("abc"), 100000),
+		"random":     random,
+	} {
+		out, err := io.ReadAll(NewReader(bytes.NewReader(frame(t, in))))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(out, in) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+	}
+}
+
+// The reader must stop at the end of a message so that the next message on
+// the same stream stays intact.
+func TestFramingReaderDoesNotOverread(t *testing.T) {
+	first := bytes.Repeat([]byte{1}, 70000)
+	stream := append(frame(t, first), []byte("tail")...)
+	src := bytes.NewReader(stream)
+
+	got := make([]byte, len(first))
+	if _, err := io.ReadFull(NewReader(src), got); err != nil {
+		t.Fatal(err)
+	}
+	rest, _ := io.ReadAll(src)
+	if string(rest) != "tail" {
+		t.Errorf("reader consumed past the message: %q", rest)
+	}
+}
+
+// Stream from the reference framing implementation: "hello" as an
+// uncompressed chunk.
+func TestFramingReference(t *testing.T) {
+	stream := []byte{
+		0xff, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y',
+		0x01, 0x09, 0x00, 0x00,
+	}
+	sum := maskedCRC([]byte("hello"))
+	stream = append(stream, byte(sum), byte(sum>>8), byte(sum>>16), byte(sum>>24))
+	stream = append(stream, "hello"...)
+
+	out, err := io.ReadAll(NewReader(bytes.NewReader(stream)))
+	if err != nil || string(out) != "hello" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestFramingCorrupt(t *testing.T) {
+	good := frame(t, []byte("some payload to check"))
+
+	badSum := append([]byte{}, good...)
+	badSum[14] ^= 0xff
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(badSum))); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(good[10:]))); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected error for missing stream identifier, got %v", err)
+	}
+
+	unsupported := append(append([]byte{}, good[:10]...), 0x02, 0x00, 0x00, 0x00)
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(unsupported))); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected unsupported chunk error, got %v", err)
+	}
+
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(good[:len(good)-3]))); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+}
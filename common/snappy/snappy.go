@@ -0,0 +1,207 @@
+// Package snappy implements the snappy block compression format.
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	ErrCorrupt  = errors.New("snappy: corrupt input")
+	ErrTooLarge = errors.New("snappy: decoded length exceeds limit")
+)
+
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+
+	// Input is compressed in independent blocks so that every copy offset
+	// fits in two bytes.
+	maxBlockSize = 65536
+
+	// Blocks shorter than this are emitted as a single literal.
+	minMatchBlockSize = 17
+
+	tableBits = 14
+)
+
+// MaxEncodedLen returns an upper bound on the encoded size of n bytes.
+func MaxEncodedLen(n int) int {
+	return 32 + n + n/6
+}
+
+// Encode compresses src.
+func Encode(src []byte) []byte {
+	dst := make([]byte, 0, MaxEncodedLen(len(src)))
+	dst = binary.AppendUvarint(dst, uint64(len(src)))
+	for len(src) > 0 {
+		block := src
+		if len(block) > maxBlockSize {
+			block = block[:maxBlockSize]
+		}
+		dst = encodeBlock(dst, block)
+		src = src[len(block):]
+	}
+	return dst
+}
+
+func load32(b []byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(b[i:])
+}
+
+func hash4(u uint32) uint32 {
+	return (u * 0x1e35a7bd) >> (32 - tableBits)
+}
+
+func encodeBlock(dst, src []byte) []byte {
+	if len(src) < minMatchBlockSize {
+		return emitLiteral(dst, src)
+	}
+
+	var table [1 << tableBits]int32
+	lit := 0
+	s := 1
+	for s+4 <= len(src) {
+		cur := load32(src, s)
+		h := hash4(cur)
+		cand := int(table[h])
+		table[h] = int32(s)
+		if cand >= s || load32(src, cand) != cur {
+			s++
+			continue
+		}
+
+		dst = emitLiteral(dst, src[lit:s])
+		length := 4
+		for s+length < len(src) && src[cand+length] == src[s+length] {
+			length++
+		}
+		dst = emitCopy(dst, s-cand, length)
+		s += length
+		lit = s
+	}
+	return emitLiteral(dst, src[lit:])
+}
+
+func emitLiteral(dst, lit []byte) []byte {
+	n := len(lit) - 1
+	switch {
+	case n < 0:
+		return dst
+	case n < 60:
+		dst = append(dst, byte(n)<<2|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	default:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	}
+	return append(dst, lit...)
+}
+
+func emitCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length < 12 && offset < 2048 {
+		return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|tagCopy1, byte(offset))
+	}
+	return append(dst, byte(length-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+}
+
+// DecodedLen returns the length src decodes to, as declared by its header.
+func DecodedLen(src []byte) (int, error) {
+	n, _, err := decodedLen(src)
+	return n, err
+}
+
+func decodedLen(src []byte) (int, int, error) {
+	v, n := binary.Uvarint(src)
+	if n <= 0 || v > 0xffffffff {
+		return 0, 0, ErrCorrupt
+	}
+	return int(v), n, nil
+}
+
+// Decode decompresses src. Inputs declaring more than maxLen bytes are
+// rejected before any allocation.
+func Decode(src []byte, maxLen int) ([]byte, error) {
+	length, n, err := decodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxLen {
+		return nil, ErrTooLarge
+	}
+	dst := make([]byte, 0, length)
+	src = src[n:]
+
+	for len(src) > 0 {
+		tag := src[0]
+		var offset, size int
+		switch tag & 0x03 {
+		case tagLiteral:
+			size = int(tag >> 2)
+			src = src[1:]
+			if size >= 60 {
+				extra := size - 59
+				if len(src) < extra {
+					return nil, ErrCorrupt
+				}
+				size = 0
+				for i := extra - 1; i >= 0; i-- {
+					size = size<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			size++
+			if size > len(src) || size > length-len(dst) {
+				return nil, ErrCorrupt
+			}
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+			continue
+		case tagCopy1:
+			if len(src) < 2 {
+				return nil, ErrCorrupt
+			}
+			size = 4 + int(tag>>2)&0x07
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case tagCopy2:
+			if len(src) < 3 {
+				return nil, ErrCorrupt
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case tagCopy4:
+			if len(src) < 5 {
+				return nil, ErrCorrupt
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || size > length-len(dst) {
+			return nil, ErrCorrupt
+		}
+		// Copies may overlap their own output, so go byte by byte.
+		start := len(dst) - offset
+		for i := 0; i < size; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+	if len(dst) != length {
+		return nil, ErrCorrupt
+	}
+	return dst, nil
+}
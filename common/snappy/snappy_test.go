@@ -0,0 +1,84 @@
+package snappy
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	rng.Read(random)
+
+	inputs := map[string][]byte{
+		"empty":      {},
+		"short":      []byte("hello"),
+		"repeated":   bytes.Repeat([]byte("gean"), 50000),
+		"zeros":      make([]byte, 3116*4),
+		"random":     random,
+		"mixed":      append(bytes.Repeat([]byte{0xab}, 70000), random[:5000]...),
+		"long match": append([]byte("x"), bytes.Repeat([]byte("abcdefgh"), 20)...),
+	}
+	for name, in := range inputs {
+		enc := Encode(in)
+		if len(enc) > MaxEncodedLen(len(in)) {
+			t.Errorf("%s: encoded length %d exceeds bound", name, len(enc))
+		}
+		dec, err := Decode(enc, len(in))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(dec, in) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+	}
+}
+
+func TestCompresses(t *testing.T) {
+	in := bytes.Repeat([]byte("lean consensus "), 1000)
+	if enc := Encode(in); len(enc) > len(in)/10 {
+		t.Errorf("expected repetitive input to compress, got %d of %d bytes", len(enc), len(in))
+	}
+}
+
+// Known encoding from the reference implementation.
+func TestDecodeReference(t *testing.T) {
+	// "aaaaaaaaaa": literal "a" followed by a copy of length 9 at offset 1.
+	enc := []byte{0x0a, 0x00, 'a', 0x15, 0x01}
+	dec, err := Decode(enc, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dec) != "aaaaaaaaaa" {
+		t.Errorf("got %q", dec)
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	enc := Encode(make([]byte, 1000))
+	if _, err := Decode(enc, 999); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+	if n, err := DecodedLen(enc); err != nil || n != 1000 {
+		t.Errorf("decoded len: %d %v", n, err)
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	cases := map[string][]byte{
+		"no header":         {},
+		"short literal":     {0x05, 0x10, 'a'},
+		"offset zero":       {0x05, 0x00, 'a', 0x01, 0x00},
+		"offset too far":    {0x05, 0x00, 'a', 0x01, 0x05},
+		"longer than said":  {0x01, 0x04, 'a', 'b'},
+		"shorter than said": {0x05, 0x00, 'a'},
+	}
+	for name, in := range cases {
+		if _, err := Decode(in, 100); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
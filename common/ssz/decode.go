@@ -0,0 +1,312 @@
+package ssz
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+func readUint64(data []byte) uint64 {
+	return binary.LittleEndian.Uint64(data)
+}
+
+func readOffset(data []byte) int {
+	return int(binary.LittleEndian.Uint32(data))
+}
+
+func checkSize(name string, data []byte, size int) error {
+	if len(data) != size {
+		return fmt.Errorf("%s: expected %d bytes, got %d", name, size, len(data))
+	}
+	return nil
+}
+
+// splitOffsets reads the offsets of the variable fields of a container and
+// returns the field slices. The first offset must point at the end of the
+// fixed part.
+func splitOffsets(name string, data []byte, fixed int, offsetPositions []int) ([][]byte, error) {
+	if len(data) < fixed {
+		return nil, fmt.Errorf("%s: expected at least %d bytes, got %d", name, fixed, len(data))
+	}
+	offsets := make([]int, len(offsetPositions)+1)
+	for i, pos := range offsetPositions {
+		offsets[i] = readOffset(data[pos:])
+	}
+	offsets[len(offsetPositions)] = len(data)
+	if offsets[0] != fixed {
+		return nil, fmt.Errorf("%s: first offset %d does not match fixed size %d", name, offsets[0], fixed)
+	}
+	parts := make([][]byte, len(offsetPositions))
+	for i := range parts {
+		if offsets[i] > offsets[i+1] || offsets[i+1] > len(data) {
+			return nil, fmt.Errorf("%s: invalid offset %d", name, offsets[i])
+		}
+		parts[i] = data[offsets[i]:offsets[i+1]]
+	}
+	return parts, nil
+}
+
+// splitVariableList splits a list of variable-size elements using its offset
+// table.
+func splitVariableList(name string, data []byte, limit int) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if len(data) < BytesPerOffset {
+		return nil, fmt.Errorf("%s: truncated offset table", name)
+	}
+	first := readOffset(data)
+	if first%BytesPerOffset != 0 || first == 0 || first > len(data) {
+		return nil, fmt.Errorf("%s: invalid first offset %d", name, first)
+	}
+	count := first / BytesPerOffset
+	if count > limit {
+		return nil, fmt.Errorf("%s: %d elements exceed limit %d", name, count, limit)
+	}
+	positions := make([]int, count)
+	for i := range positions {
+		positions[i] = i * BytesPerOffset
+	}
+	return splitOffsets(name, data, first, positions)
+}
+
+func splitFixedList(name string, data []byte, size, limit int) ([][]byte, error) {
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("%s: length %d not a multiple of %d", name, len(data), size)
+	}
+	count := len(data) / size
+	if count > limit {
+		return nil, fmt.Errorf("%s: %d elements exceed limit %d", name, count, limit)
+	}
+	elems := make([][]byte, count)
+	for i := range elems {
+		elems[i] = data[i*size : (i+1)*size]
+	}
+	return elems, nil
+}
+
+func decodeCheckpoint(data []byte) types.Checkpoint {
+	var c types.Checkpoint
+	copy(c.Root[:], data[:32])
+	c.Slot = types.Slot(readUint64(data[32:]))
+	return c
+}
+
+func decodeAttestationData(data []byte) types.AttestationData {
+	return types.AttestationData{
+		Slot:   types.Slot(readUint64(data)),
+		Head:   decodeCheckpoint(data[8:]),
+		Target: decodeCheckpoint(data[8+CheckpointSize:]),
+		Source: decodeCheckpoint(data[8+2*CheckpointSize:]),
+	}
+}
+
+func decodeAttestation(data []byte) types.Attestation {
+	return types.Attestation{
+		ValidatorID: types.ValidatorIndex(readUint64(data)),
+		Data:        decodeAttestationData(data[8:]),
+	}
+}
+
+func decodeBlockHeader(data []byte) types.BlockHeader {
+	var h types.BlockHeader
+	h.Slot = types.Slot(readUint64(data))
+	h.ProposerIndex = types.ValidatorIndex(readUint64(data[8:]))
+	copy(h.ParentRoot[:], data[16:48])
+	copy(h.StateRoot[:], data[48:80])
+	copy(h.BodyRoot[:], data[80:112])
+	return h
+}
+
+func UnmarshalCheckpoint(data []byte) (*types.Checkpoint, error) {
+	if err := checkSize("checkpoint", data, CheckpointSize); err != nil {
+		return nil, err
+	}
+	c := decodeCheckpoint(data)
+	return &c, nil
+}
+
+func UnmarshalAttestationData(data []byte) (*types.AttestationData, error) {
+	if err := checkSize("attestation data", data, AttestationDataSize); err != nil {
+		return nil, err
+	}
+	a := decodeAttestationData(data)
+	return &a, nil
+}
+
+func UnmarshalAttestation(data []byte) (*types.Attestation, error) {
+	if err := checkSize("attestation", data, AttestationSize); err != nil {
+		return nil, err
+	}
+	a := decodeAttestation(data)
+	return &a, nil
+}
+
+func UnmarshalSignedAttestation(data []byte) (*types.SignedAttestation, error) {
+	if err := checkSize("signed attestation", data, SignedAttestationSize); err != nil {
+		return nil, err
+	}
+	a := &types.SignedAttestation{
+		ValidatorID: types.ValidatorIndex(readUint64(data)),
+		Message:     decodeAttestationData(data[8:]),
+	}
+	copy(a.Signature[:], data[8+AttestationDataSize:])
+	return a, nil
+}
+
+func UnmarshalBlockHeader(data []byte) (*types.BlockHeader, error) {
+	if err := checkSize("block header", data, BlockHeaderSize); err != nil {
+		return nil, err
+	}
+	h := decodeBlockHeader(data)
+	return &h, nil
+}
+
+func UnmarshalAggregatedAttestation(data []byte, validatorLimit int) (*types.AggregatedAttestation, error) {
+	parts, err := splitOffsets("aggregated attestation", data, BytesPerOffset+AttestationDataSize, []int{0})
+	if err != nil {
+		return nil, err
+	}
+	bits, err := types.BitlistFromBytes(parts[0], validatorLimit)
+	if err != nil {
+		return nil, fmt.Errorf("aggregated attestation: %w", err)
+	}
+	return &types.AggregatedAttestation{
+		AggregationBits: bits,
+		Data:            decodeAttestationData(data[BytesPerOffset:]),
+	}, nil
+}
+
+func UnmarshalBlockBody(data []byte, attestationLimit, validatorLimit int) (*types.BlockBody, error) {
+	parts, err := splitOffsets("block body", data, BytesPerOffset, []int{0})
+	if err != nil {
+		return nil, err
+	}
+	elems, err := splitVariableList("attestations", parts[0], attestationLimit)
+	if err != nil {
+		return nil, err
+	}
+	body := &types.BlockBody{Attestations: make([]types.AggregatedAttestation, len(elems))}
+	for i, e := range elems {
+		att, err := UnmarshalAggregatedAttestation(e, validatorLimit)
+		if err != nil {
+			return nil, err
+		}
+		body.Attestations[i] = *att
+	}
+	return body, nil
+}
+
+func UnmarshalBlock(data []byte, attestationLimit, validatorLimit int) (*types.Block, error) {
+	const fixed = 8 + 8 + 32 + 32 + BytesPerOffset
+	parts, err := splitOffsets("block", data, fixed, []int{80})
+	if err != nil {
+		return nil, err
+	}
+	body, err := UnmarshalBlockBody(parts[0], attestationLimit, validatorLimit)
+	if err != nil {
+		return nil, err
+	}
+	b := &types.Block{
+		Slot:          types.Slot(readUint64(data)),
+		ProposerIndex: types.ValidatorIndex(readUint64(data[8:])),
+		Body:          *body,
+	}
+	copy(b.ParentRoot[:], data[16:48])
+	copy(b.StateRoot[:], data[48:80])
+	return b, nil
+}
+
+func UnmarshalBlockWithAttestation(data []byte, attestationLimit, validatorLimit int) (*types.BlockWithAttestation, error) {
+	parts, err := splitOffsets("block with attestation", data, BytesPerOffset+AttestationSize, []int{0})
+	if err != nil {
+		return nil, err
+	}
+	block, err := UnmarshalBlock(parts[0], attestationLimit, validatorLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &types.BlockWithAttestation{
+		Block:               *block,
+		ProposerAttestation: decodeAttestation(data[BytesPerOffset:]),
+	}, nil
+}
+
+func UnmarshalSignedBlockWithAttestation(data []byte, attestationLimit, validatorLimit int) (*types.SignedBlockWithAttestation, error) {
+	parts, err := splitOffsets("signed block with attestation", data, 2*BytesPerOffset, []int{0, BytesPerOffset})
+	if err != nil {
+		return nil, err
+	}
+	msg, err := UnmarshalBlockWithAttestation(parts[0], attestationLimit, validatorLimit)
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := splitFixedList("signatures", parts[1], len(types.Bytes3116{}), validatorLimit)
+	if err != nil {
+		return nil, err
+	}
+	sbwa := &types.SignedBlockWithAttestation{
+		Message:    *msg,
+		Signatures: make([]types.Bytes3116, len(sigs)),
+	}
+	for i, s := range sigs {
+		copy(sbwa.Signatures[i][:], s)
+	}
+	return sbwa, nil
+}
+
+func UnmarshalState(data []byte, historicalRootsLimit, validatorLimit int) (*types.State, error) {
+	const fixed = ConfigSize + 8 + BlockHeaderSize + 2*CheckpointSize + 5*BytesPerOffset
+	const offsetsAt = ConfigSize + 8 + BlockHeaderSize + 2*CheckpointSize
+	positions := []int{offsetsAt, offsetsAt + 4, offsetsAt + 8, offsetsAt + 12, offsetsAt + 16}
+	parts, err := splitOffsets("state", data, fixed, positions)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &types.State{
+		Config:            types.Config{GenesisTime: readUint64(data)},
+		Slot:              types.Slot(readUint64(data[8:])),
+		LatestBlockHeader: decodeBlockHeader(data[16:]),
+		LatestJustified:   decodeCheckpoint(data[16+BlockHeaderSize:]),
+		LatestFinalized:   decodeCheckpoint(data[16+BlockHeaderSize+CheckpointSize:]),
+	}
+
+	historical, err := splitFixedList("historical roots", parts[0], 32, historicalRootsLimit)
+	if err != nil {
+		return nil, err
+	}
+	s.HistoricalRoots = make([]types.Root, len(historical))
+	for i, r := range historical {
+		copy(s.HistoricalRoots[i][:], r)
+	}
+
+	if s.JustifiedSlots, err = types.BitlistFromBytes(parts[1], historicalRootsLimit); err != nil {
+		return nil, fmt.Errorf("justified slots: %w", err)
+	}
+
+	validators, err := splitFixedList("validators", parts[2], ValidatorSize, validatorLimit)
+	if err != nil {
+		return nil, err
+	}
+	s.Validators = make([]types.Validator, len(validators))
+	for i, v := range validators {
+		copy(s.Validators[i].Pubkey[:], v[:52])
+		s.Validators[i].Index = types.ValidatorIndex(readUint64(v[52:]))
+	}
+
+	roots, err := splitFixedList("justification roots", parts[3], 32, historicalRootsLimit)
+	if err != nil {
+		return nil, err
+	}
+	s.JustificationRoots = make([]types.Root, len(roots))
+	for i, r := range roots {
+		copy(s.JustificationRoots[i][:], r)
+	}
+
+	if s.JustificationVotes, err = types.BitlistFromBytes(parts[4], historicalRootsLimit*validatorLimit); err != nil {
+		return nil, fmt.Errorf("justification votes: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,180 @@
+package ssz
+
+import (
+	"encoding/binary"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+const BytesPerOffset = 4
+
+// Fixed SSZ sizes of the consensus containers.
+const (
+	CheckpointSize        = 32 + 8
+	ValidatorSize         = 52 + 8
+	AttestationDataSize   = 8 + 3*CheckpointSize
+	AttestationSize       = 8 + AttestationDataSize
+	SignedAttestationSize = 8 + AttestationDataSize + 3116
+	BlockHeaderSize       = 8 + 8 + 32 + 32 + 32
+	ConfigSize            = 8
+)
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(buf, v)
+}
+
+func appendOffset(buf []byte, offset int) []byte {
+	return binary.LittleEndian.AppendUint32(buf, uint32(offset))
+}
+
+func appendCheckpoint(buf []byte, c *types.Checkpoint) []byte {
+	buf = append(buf, c.Root[:]...)
+	return appendUint64(buf, uint64(c.Slot))
+}
+
+func appendAttestationData(buf []byte, a *types.AttestationData) []byte {
+	buf = appendUint64(buf, uint64(a.Slot))
+	buf = appendCheckpoint(buf, &a.Head)
+	buf = appendCheckpoint(buf, &a.Target)
+	return appendCheckpoint(buf, &a.Source)
+}
+
+func appendAttestation(buf []byte, a *types.Attestation) []byte {
+	buf = appendUint64(buf, uint64(a.ValidatorID))
+	return appendAttestationData(buf, &a.Data)
+}
+
+func appendBlockHeader(buf []byte, h *types.BlockHeader) []byte {
+	buf = appendUint64(buf, uint64(h.Slot))
+	buf = appendUint64(buf, uint64(h.ProposerIndex))
+	buf = append(buf, h.ParentRoot[:]...)
+	buf = append(buf, h.StateRoot[:]...)
+	return append(buf, h.BodyRoot[:]...)
+}
+
+func bitlistBytes(bl *types.Bitlist) []byte {
+	if bl == nil {
+		return []byte{0x01}
+	}
+	return bl.Bytes()
+}
+
+func MarshalCheckpoint(c *types.Checkpoint) []byte {
+	return appendCheckpoint(make([]byte, 0, CheckpointSize), c)
+}
+
+func MarshalAttestationData(a *types.AttestationData) []byte {
+	return appendAttestationData(make([]byte, 0, AttestationDataSize), a)
+}
+
+func MarshalAttestation(a *types.Attestation) []byte {
+	return appendAttestation(make([]byte, 0, AttestationSize), a)
+}
+
+func MarshalSignedAttestation(a *types.SignedAttestation) []byte {
+	buf := make([]byte, 0, SignedAttestationSize)
+	buf = appendUint64(buf, uint64(a.ValidatorID))
+	buf = appendAttestationData(buf, &a.Message)
+	return append(buf, a.Signature[:]...)
+}
+
+func MarshalBlockHeader(h *types.BlockHeader) []byte {
+	return appendBlockHeader(make([]byte, 0, BlockHeaderSize), h)
+}
+
+func MarshalAggregatedAttestation(a *types.AggregatedAttestation) []byte {
+	buf := appendOffset(nil, BytesPerOffset+AttestationDataSize)
+	buf = appendAttestationData(buf, &a.Data)
+	return append(buf, bitlistBytes(a.AggregationBits)...)
+}
+
+func MarshalBlockBody(b *types.BlockBody) []byte {
+	elems := make([][]byte, len(b.Attestations))
+	for i := range b.Attestations {
+		elems[i] = MarshalAggregatedAttestation(&b.Attestations[i])
+	}
+	buf := appendOffset(nil, BytesPerOffset)
+	return append(buf, marshalVariableList(elems)...)
+}
+
+func MarshalBlock(b *types.Block) []byte {
+	const fixed = 8 + 8 + 32 + 32 + BytesPerOffset
+	buf := make([]byte, 0, fixed)
+	buf = appendUint64(buf, uint64(b.Slot))
+	buf = appendUint64(buf, uint64(b.ProposerIndex))
+	buf = append(buf, b.ParentRoot[:]...)
+	buf = append(buf, b.StateRoot[:]...)
+	buf = appendOffset(buf, fixed)
+	return append(buf, MarshalBlockBody(&b.Body)...)
+}
+
+func MarshalBlockWithAttestation(bwa *types.BlockWithAttestation) []byte {
+	buf := appendOffset(nil, BytesPerOffset+AttestationSize)
+	buf = appendAttestation(buf, &bwa.ProposerAttestation)
+	return append(buf, MarshalBlock(&bwa.Block)...)
+}
+
+func MarshalSignedBlockWithAttestation(sbwa *types.SignedBlockWithAttestation) []byte {
+	msg := MarshalBlockWithAttestation(&sbwa.Message)
+	buf := appendOffset(nil, 2*BytesPerOffset)
+	buf = appendOffset(buf, 2*BytesPerOffset+len(msg))
+	buf = append(buf, msg...)
+	for i := range sbwa.Signatures {
+		buf = append(buf, sbwa.Signatures[i][:]...)
+	}
+	return buf
+}
+
+func MarshalState(s *types.State) []byte {
+	const fixed = ConfigSize + 8 + BlockHeaderSize + 2*CheckpointSize + 5*BytesPerOffset
+
+	historical := make([]byte, 0, len(s.HistoricalRoots)*32)
+	for _, r := range s.HistoricalRoots {
+		historical = append(historical, r[:]...)
+	}
+	justifiedSlots := bitlistBytes(s.JustifiedSlots)
+	validators := make([]byte, 0, len(s.Validators)*ValidatorSize)
+	for i := range s.Validators {
+		validators = append(validators, s.Validators[i].Pubkey[:]...)
+		validators = appendUint64(validators, uint64(s.Validators[i].Index))
+	}
+	justificationRoots := make([]byte, 0, len(s.JustificationRoots)*32)
+	for _, r := range s.JustificationRoots {
+		justificationRoots = append(justificationRoots, r[:]...)
+	}
+	justificationVotes := bitlistBytes(s.JustificationVotes)
+
+	buf := make([]byte, 0, fixed+len(historical)+len(justifiedSlots)+len(validators)+len(justificationRoots)+len(justificationVotes))
+	buf = appendUint64(buf, s.Config.GenesisTime)
+	buf = appendUint64(buf, uint64(s.Slot))
+	buf = appendBlockHeader(buf, &s.LatestBlockHeader)
+	buf = appendCheckpoint(buf, &s.LatestJustified)
+	buf = appendCheckpoint(buf, &s.LatestFinalized)
+
+	offset := fixed
+	for _, part := range [][]byte{historical, justifiedSlots, validators, justificationRoots} {
+		buf = appendOffset(buf, offset)
+		offset += len(part)
+	}
+	buf = appendOffset(buf, offset)
+
+	for _, part := range [][]byte{historical, justifiedSlots, validators, justificationRoots, justificationVotes} {
+		buf = append(buf, part...)
+	}
+	return buf
+}
+
+// marshalVariableList encodes a list of variable-size elements: an offset
+// table followed by the elements.
+func marshalVariableList(elems [][]byte) []byte {
+	var buf []byte
+	offset := len(elems) * BytesPerOffset
+	for _, e := range elems {
+		buf = appendOffset(buf, offset)
+		offset += len(e)
+	}
+	for _, e := range elems {
+		buf = append(buf, e...)
+	}
+	return buf
+}
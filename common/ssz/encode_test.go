@@ -0,0 +1,133 @@
+package ssz
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+func testAttestationData() types.AttestationData {
+	return types.AttestationData{
+		Slot:   types.Slot(10),
+		Head:   types.Checkpoint{Root: types.Root{1}, Slot: types.Slot(10)},
+		Target: types.Checkpoint{Root: types.Root{2}, Slot: types.Slot(8)},
+		Source: types.Checkpoint{Root: types.Root{3}, Slot: types.Slot(4)},
+	}
+}
+
+func testSignedBlock() *types.SignedBlockWithAttestation {
+	bits, _ := types.BitlistFromBits([]bool{true, false, true}, 4096)
+	var sig types.Bytes3116
+	sig[0], sig[3115] = 0xaa, 0xbb
+	return &types.SignedBlockWithAttestation{
+		Message: types.BlockWithAttestation{
+			Block: types.Block{
+				Slot:          types.Slot(11),
+				ProposerIndex: types.ValidatorIndex(3),
+				ParentRoot:    types.Root{1, 2, 3},
+				StateRoot:     types.Root{4, 5, 6},
+				Body: types.BlockBody{Attestations: []types.AggregatedAttestation{
+					{AggregationBits: bits, Data: testAttestationData()},
+					{AggregationBits: bits, Data: testAttestationData()},
+				}},
+			},
+			ProposerAttestation: types.Attestation{ValidatorID: 3, Data: testAttestationData()},
+		},
+		Signatures: []types.Bytes3116{sig, sig},
+	}
+}
+
+func TestSignedAttestationRoundTrip(t *testing.T) {
+	a := &types.SignedAttestation{ValidatorID: 7, Message: testAttestationData()}
+	a.Signature[100] = 0x42
+
+	data := MarshalSignedAttestation(a)
+	if len(data) != SignedAttestationSize {
+		t.Fatalf("expected %d bytes, got %d", SignedAttestationSize, len(data))
+	}
+	got, err := UnmarshalSignedAttestation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *a {
+		t.Error("signed attestation round trip mismatch")
+	}
+	if _, err := UnmarshalSignedAttestation(data[1:]); err == nil {
+		t.Error("expected error for truncated input")
+	}
+}
+
+func TestSignedBlockRoundTrip(t *testing.T) {
+	block := testSignedBlock()
+	data := MarshalSignedBlockWithAttestation(block)
+
+	got, err := UnmarshalSignedBlockWithAttestation(data, 4096, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if HashTreeRootSignedBlockWithAttestation(got, 4096, 4096) != HashTreeRootSignedBlockWithAttestation(block, 4096, 4096) {
+		t.Error("round trip changed the block root")
+	}
+	if !bytes.Equal(MarshalSignedBlockWithAttestation(got), data) {
+		t.Error("re-encoding mismatch")
+	}
+	if len(got.Signatures) != 2 || got.Signatures[1][3115] != 0xbb {
+		t.Error("signatures")
+	}
+}
+
+func TestSignedBlockInvalid(t *testing.T) {
+	data := MarshalSignedBlockWithAttestation(testSignedBlock())
+
+	if _, err := UnmarshalSignedBlockWithAttestation(data[:6], 4096, 4096); err == nil {
+		t.Error("expected error for truncated input")
+	}
+	bad := append([]byte{}, data...)
+	bad[0] = 0xff
+	if _, err := UnmarshalSignedBlockWithAttestation(bad, 4096, 4096); err == nil {
+		t.Error("expected error for bad offset")
+	}
+	if _, err := UnmarshalSignedBlockWithAttestation(data, 1, 4096); err == nil {
+		t.Error("expected error for attestation limit")
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	justifiedSlots, _ := types.BitlistFromBits([]bool{true, false, true}, 262144)
+	justificationVotes, _ := types.BitlistFromBits([]bool{true, true, false, false, true, false, false, false, true}, 262144*4096)
+
+	state := &types.State{
+		Config: types.Config{GenesisTime: 1700000000},
+		Slot:   types.Slot(100),
+		LatestBlockHeader: types.BlockHeader{
+			Slot:          types.Slot(99),
+			ProposerIndex: types.ValidatorIndex(5),
+			ParentRoot:    types.Root{1},
+			StateRoot:     types.Root{2},
+			BodyRoot:      types.Root{3},
+		},
+		LatestJustified:    types.Checkpoint{Root: types.Root{10}, Slot: types.Slot(96)},
+		LatestFinalized:    types.Checkpoint{Root: types.Root{20}, Slot: types.Slot(64)},
+		HistoricalRoots:    []types.Root{{1}, {2}, {3}},
+		JustifiedSlots:     justifiedSlots,
+		Validators:         []types.Validator{{Pubkey: types.Bytes52{0xaa}, Index: 0}, {Pubkey: types.Bytes52{0xbb}, Index: 1}},
+		JustificationRoots: []types.Root{{9}},
+		JustificationVotes: justificationVotes,
+	}
+
+	data := MarshalState(state)
+	got, err := UnmarshalState(data, 262144, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if HashTreeRootState(got, 262144, 4096) != HashTreeRootState(state, 262144, 4096) {
+		t.Error("round trip changed the state root")
+	}
+	if !bytes.Equal(MarshalState(got), data) {
+		t.Error("re-encoding mismatch")
+	}
+	if _, err := UnmarshalState(data, 262144, 1); err == nil {
+		t.Error("expected error for validator limit")
+	}
+}
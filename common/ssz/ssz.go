@@ -3,6 +3,7 @@ package ssz
 import (
 	"crypto/sha256"
 	"encoding/binary"
+	"math/bits"
 
 	"github.com/devlongs/gean/common/types"
 )
@@ -63,29 +64,27 @@ func packBits(n int, get func(int) bool) []types.Root {
 	return chunks
 }
 
+// Merkleize computes the root of chunks padded with zero chunks to the next
+// power of two of limit (or of len(chunks) if limit is 0). Padding is
+// never materialized: each level is completed with the zero subtree root of
+// its depth, so large limits cost nothing beyond the actual chunks.
 func Merkleize(chunks []types.Root, limit int) types.Root {
 	n := len(chunks)
-	if n == 0 {
-		if limit > 0 {
-			return zeroTreeRoot(nextPowerOfTwo(limit))
-		}
-		return ZeroHash
-	}
-
 	width := nextPowerOfTwo(n)
 	if limit > 0 && limit >= n {
 		width = nextPowerOfTwo(limit)
 	}
-
-	if width == 1 {
-		return chunks[0]
+	depth := bits.TrailingZeros(uint(width))
+	if n == 0 {
+		return zeroHashes[depth]
 	}
 
-	level := make([]types.Root, width)
-	copy(level, chunks)
-
-	for len(level) > 1 {
-		next := make([]types.Root, len(level)/2)
+	level := append([]types.Root(nil), chunks...)
+	for d := 0; d < depth; d++ {
+		if len(level)%2 == 1 {
+			level = append(level, zeroHashes[d])
+		}
+		next := level[:len(level)/2]
 		for i := range next {
 			next[i] = HashNodes(level[i*2], level[i*2+1])
 		}
@@ -94,6 +93,15 @@ func Merkleize(chunks []types.Root, limit int) types.Root {
 	return level[0]
 }
 
+// zeroHashes[d] is the root of a tree of depth d whose leaves are all zero.
+var zeroHashes = func() [65]types.Root {
+	var z [65]types.Root
+	for d := 1; d < len(z); d++ {
+		z[d] = HashNodes(z[d-1], z[d-1])
+	}
+	return z
+}()
+
 func MixInLength(root types.Root, length uint64) types.Root {
 	var lenChunk types.Root
 	binary.LittleEndian.PutUint64(lenChunk[:8], length)
@@ -113,18 +121,6 @@ func nextPowerOfTwo(x int) int {
 	return n + 1
 }
 
-func zeroTreeRoot(width int) types.Root {
-	if width <= 1 {
-		return ZeroHash
-	}
-	h := ZeroHash
-	for width > 1 {
-		h = HashNodes(h, h)
-		width /= 2
-	}
-	return h
-}
-
 func HashTreeRootBytes(data []byte) types.Root {
 	if len(data) <= 32 {
 		var chunk types.Root
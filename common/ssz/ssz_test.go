@@ -50,6 +50,25 @@ func TestMerkleize(t *testing.T) {
 	}
 }
 
+func TestMerkleizePadsWithZeroSubtrees(t *testing.T) {
+	// Three chunks under a limit of 8 must equal the fully padded tree.
+	c := []types.Root{{1}, {2}, {3}}
+	z := ZeroHash
+	want := HashNodes(
+		HashNodes(HashNodes(c[0], c[1]), HashNodes(c[2], z)),
+		HashNodes(HashNodes(z, z), HashNodes(z, z)),
+	)
+	if Merkleize(c, 8) != want {
+		t.Error("padded tree mismatch")
+	}
+	if Merkleize(nil, 4) != HashNodes(HashNodes(z, z), HashNodes(z, z)) {
+		t.Error("empty tree with limit")
+	}
+	if c[2] != (types.Root{3}) {
+		t.Error("input modified")
+	}
+}
+
 func TestMixInLength(t *testing.T) {
 	root := types.Root{1}
 	mixed := MixInLength(root, 42)
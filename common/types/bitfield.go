@@ -1,6 +1,9 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"math/bits"
+)
 
 // Bitvector is a fixed-length bit array.
 type Bitvector struct {
@@ -77,6 +80,27 @@ func BitlistFromBits(bits []bool, limit int) (*Bitlist, error) {
 	return &Bitlist{data: data, len: len(bits), limit: limit}, nil
 }
 
+// BitlistFromBytes parses SSZ-encoded bytes with delimiter bit.
+func BitlistFromBytes(data []byte, limit int) (*Bitlist, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty bitlist encoding")
+	}
+	last := data[len(data)-1]
+	if last == 0 {
+		return nil, fmt.Errorf("bitlist missing delimiter bit")
+	}
+	n := (len(data)-1)*8 + bits.Len8(last) - 1
+	if n > limit {
+		return nil, fmt.Errorf("bitlist exceeds limit of %d, got %d", limit, n)
+	}
+	copied := make([]byte, (n+7)/8)
+	copy(copied, data)
+	if n%8 != 0 {
+		copied[n/8] &^= 1 << (n % 8)
+	}
+	return &Bitlist{data: copied, len: n, limit: limit}, nil
+}
+
 func (b *Bitlist) Len() int   { return b.len }
 func (b *Bitlist) Limit() int { return b.limit }
 
@@ -98,6 +122,23 @@ func (b *Bitlist) Set(index int, value bool) {
 	}
 }
 
+// Append adds a bit at the end. It fails once the limit is reached.
+func (b *Bitlist) Append(value bool) error {
+	if b.len >= b.limit {
+		return fmt.Errorf("bitlist at limit of %d", b.limit)
+	}
+	if b.len%8 == 0 {
+		b.data = append(b.data, 0)
+	}
+	b.len++
+	b.Set(b.len-1, value)
+	return nil
+}
+
+func (b *Bitlist) Copy() *Bitlist {
+	return &Bitlist{data: append([]byte(nil), b.data...), len: b.len, limit: b.limit}
+}
+
 // Bytes returns SSZ-encoded bytes with delimiter bit.
 func (b *Bitlist) Bytes() []byte {
 	if b.len == 0 {
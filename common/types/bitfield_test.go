@@ -59,3 +59,60 @@ func TestEmptyBitlist(t *testing.T) {
 		t.Error("empty bitlist should be 0x01")
 	}
 }
+
+func TestBitlistFromBytes(t *testing.T) {
+	for _, bits := range [][]bool{
+		{},
+		{true, false, true},
+		{true, true, true, true, true, true, true, true},
+		{false, false, false, false, false, false, false, false, true},
+	} {
+		bl, _ := BitlistFromBits(bits, 100)
+		got, err := BitlistFromBytes(bl.Bytes(), 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Len() != len(bits) {
+			t.Errorf("length: expected %d, got %d", len(bits), got.Len())
+		}
+		for i, bit := range bits {
+			if got.Get(i) != bit {
+				t.Errorf("bit %d: expected %v", i, bit)
+			}
+		}
+	}
+}
+
+func TestBitlistFromBytesInvalid(t *testing.T) {
+	if _, err := BitlistFromBytes(nil, 100); err == nil {
+		t.Error("empty encoding")
+	}
+	if _, err := BitlistFromBytes([]byte{0x01, 0x00}, 100); err == nil {
+		t.Error("missing delimiter")
+	}
+	if _, err := BitlistFromBytes([]byte{0xff, 0x01}, 4); err == nil {
+		t.Error("over limit")
+	}
+}
+
+func TestBitlistAppend(t *testing.T) {
+	bl := NewBitlist(10)
+	for i := 0; i < 10; i++ {
+		if err := bl.Append(i%3 == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bl.Append(true); err == nil {
+		t.Error("append past limit")
+	}
+	want, _ := BitlistFromBits([]bool{true, false, false, true, false, false, true, false, false, true}, 10)
+	if string(bl.Bytes()) != string(want.Bytes()) {
+		t.Errorf("got %x, want %x", bl.Bytes(), want.Bytes())
+	}
+
+	cp := bl.Copy()
+	cp.Set(1, true)
+	if bl.Get(1) {
+		t.Error("copy shares storage")
+	}
+}
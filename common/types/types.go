@@ -15,6 +15,26 @@ type Bytes3116 [3116]byte // XMSS signature size
 
 const SecondsPerSlot uint64 = 4
 
+// IntervalsPerSlot splits a slot into one-second intervals: blocks are
+// proposed in interval 0 and attestations are made in interval 1.
+const IntervalsPerSlot uint64 = 4
+
+// Intervals within a slot at which validator duties run.
+const (
+	ProposeInterval uint64 = 0
+	AttestInterval  uint64 = 1
+)
+
+// SSZ list limits.
+const (
+	HistoricalRootsLimit   = 262144
+	ValidatorRegistryLimit = 4096
+	// AttestationsLimit bounds the aggregated attestations in a block body.
+	// Every aggregate is backed by at least one of the block's signatures,
+	// of which there are at most ValidatorRegistryLimit.
+	AttestationsLimit = ValidatorRegistryLimit
+)
+
 func (r Root) IsZero() bool {
 	return r == Root{}
 }
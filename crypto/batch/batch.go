@@ -0,0 +1,91 @@
+// Package batch verifies many signatures concurrently.
+package batch
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+)
+
+// Job is a single signature to verify.
+type Job struct {
+	Pubkey    types.Bytes52
+	Message   types.Root
+	Signature *types.Bytes3116
+}
+
+// Error identifies the job that failed verification.
+type Error struct {
+	Index int
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("signature %d: %v", e.Index, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Verify checks all jobs across a pool of workers and stops at the first
+// failure, which is returned as an *Error. A non-positive worker count uses
+// GOMAXPROCS.
+func Verify(ctx context.Context, jobs []Job, workers int, verifier signature.Verifier) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indices := make(chan int)
+	var (
+		once     sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				job := &jobs[i]
+				if err := verifier.Verify(job.Pubkey, job.Message, job.Signature); err != nil {
+					fail(&Error{Index: i, Err: err})
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range jobs {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,80 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+var errBad = errors.New("bad signature")
+
+// firstByteVerifier accepts signatures whose first byte matches the message.
+type firstByteVerifier struct{}
+
+func (firstByteVerifier) Verify(_ types.Bytes52, msg types.Root, sig *types.Bytes3116) error {
+	if sig[0] != msg[0] {
+		return errBad
+	}
+	return nil
+}
+
+type countingVerifier struct{ calls atomic.Int32 }
+
+func (v *countingVerifier) Verify(types.Bytes52, types.Root, *types.Bytes3116) error {
+	v.calls.Add(1)
+	return errBad
+}
+
+func makeJobs(n int) []Job {
+	jobs := make([]Job, n)
+	for i := range jobs {
+		sig := &types.Bytes3116{byte(i)}
+		jobs[i] = Job{Message: types.Root{byte(i)}, Signature: sig}
+	}
+	return jobs
+}
+
+func TestVerifyAllValid(t *testing.T) {
+	if err := Verify(context.Background(), makeJobs(50), 4, firstByteVerifier{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(context.Background(), nil, 4, firstByteVerifier{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyReportsFailingIndex(t *testing.T) {
+	jobs := makeJobs(50)
+	jobs[17].Signature[0] = 0xff
+
+	err := Verify(context.Background(), jobs, 0, firstByteVerifier{})
+	var batchErr *Error
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if batchErr.Index != 17 || !errors.Is(err, errBad) {
+		t.Errorf("expected failure at 17, got %v", err)
+	}
+}
+
+func TestVerifyAbortsEarly(t *testing.T) {
+	jobs := makeJobs(200)
+	v := &countingVerifier{}
+	if err := Verify(context.Background(), jobs, 2, v); err == nil {
+		t.Fatal("expected failure")
+	}
+	if v.calls.Load() >= int32(len(jobs)) {
+		t.Errorf("expected early abort, verified %d of %d", v.calls.Load(), len(jobs))
+	}
+}
+
+func TestVerifyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Verify(ctx, makeJobs(10), 1, firstByteVerifier{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/xmss"
+)
+
+// Dir is a directory of keystores. Each key is kept in <pubkey>.json with
+// its leaf counter in <pubkey>.leaf.
+type Dir struct {
+	path string
+}
+
+// OpenDir opens the keystore directory at path, creating it if needed.
+func OpenDir(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, err
+	}
+	return &Dir{path: path}, nil
+}
+
+func (d *Dir) file(pubkey types.Bytes52, ext string) string {
+	return filepath.Join(d.path, hex.EncodeToString(pubkey[:])+ext)
+}
+
+// List returns the keystores in the directory ordered by public key.
+func (d *Dir) List() ([]*Keystore, error) {
+	matches, err := filepath.Glob(filepath.Join(d.path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	var out []*Keystore
+	for _, path := range matches {
+		ks, err := readKeystore(path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ks)
+	}
+	return out, nil
+}
+
+// Load reads the keystore of pubkey.
+func (d *Dir) Load(pubkey types.Bytes52) (*Keystore, error) {
+	return readKeystore(d.file(pubkey, ".json"))
+}
+
+// Store adds the keystore of a newly generated key, whose leaf counter
+// starts at 0. It refuses to replace an existing one.
+func (d *Dir) Store(ks *Keystore) error {
+	return d.store(ks, 0)
+}
+
+func (d *Dir) store(ks *Keystore, next uint64) error {
+	pubkey, err := ks.PublicKey()
+	if err != nil {
+		return err
+	}
+	path := d.file(pubkey, ".json")
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("keystore for %x already exists", pubkey[:8])
+	}
+	// The counter is created first: a keystore without one cannot sign,
+	// while a stray counter is harmless.
+	if _, err := xmss.CreateFileLeafStore(d.file(pubkey, ".leaf"), next); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(data, '\n'))
+}
+
+// Leaves returns the leaf counter of pubkey.
+func (d *Dir) Leaves(pubkey types.Bytes52) *xmss.FileLeafStore {
+	return xmss.NewFileLeafStore(d.file(pubkey, ".leaf"))
+}
+
+// Signer decrypts the key of pubkey and returns a signer that persists its
+// leaf counter in the directory.
+func (d *Dir) Signer(pubkey types.Bytes52, password string) (*xmss.Signer, error) {
+	ks, err := d.Load(pubkey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ks.Decrypt(password)
+	if err != nil {
+		return nil, err
+	}
+	return xmss.NewSigner(key, d.Leaves(pubkey))
+}
+
+// Export writes the keystore of pubkey with its leaf counter to path and
+// retires the key here: its counter is moved to the end of the tree, so it
+// cannot sign from this directory again once it is imported elsewhere.
+func (d *Dir) Export(pubkey types.Bytes52, path string) (*Keystore, error) {
+	ks, err := d.Load(pubkey)
+	if err != nil {
+		return nil, err
+	}
+	leaves := d.Leaves(pubkey)
+	if ks.NextLeaf, err = leaves.Load(); err != nil {
+		return nil, err
+	}
+	if ks.NextLeaf >= ks.Lifetime() {
+		return nil, fmt.Errorf("keystore for %x is exhausted or already exported", pubkey[:8])
+	}
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// The copy is written before the key is retired, so a failure never
+	// loses the key.
+	if err := writeFile(path, append(data, '\n')); err != nil {
+		return nil, err
+	}
+	if err := leaves.Store(ks.Lifetime()); err != nil {
+		return nil, fmt.Errorf("exported to %s but not retired here: %w", path, err)
+	}
+	return ks, nil
+}
+
+// Import adds an exported keystore. Importing a key that is already present
+// only moves its leaf counter forward, so leaves used on either side are
+// never reused.
+func (d *Dir) Import(ks *Keystore) error {
+	pubkey, err := ks.PublicKey()
+	if err != nil {
+		return err
+	}
+	if _, err := d.Load(pubkey); errors.Is(err, os.ErrNotExist) {
+		stored := *ks
+		stored.NextLeaf = 0
+		return d.store(&stored, ks.NextLeaf)
+	} else if err != nil {
+		return err
+	}
+	leaves := d.Leaves(pubkey)
+	next, err := leaves.Load()
+	if err != nil {
+		return err
+	}
+	if ks.NextLeaf > next {
+		return leaves.Store(ks.NextLeaf)
+	}
+	return nil
+}
+
+// ReadFile reads a keystore file, such as one written by Export.
+func ReadFile(path string) (*Keystore, error) {
+	return readKeystore(path)
+}
+
+func readKeystore(path string) (*Keystore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ks Keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if _, err := ks.PublicKey(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return &ks, nil
+}
+
+// writeFile replaces path atomically.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
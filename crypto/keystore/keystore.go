@@ -0,0 +1,224 @@
+// Package keystore stores XMSS secret keys encrypted with a password.
+//
+// A keystore is a JSON document in the spirit of EIP-2335: the encoded
+// private key is encrypted with AES-256-GCM under a key derived from the
+// password with PBKDF2-HMAC-SHA256. The public key is stored in the clear
+// and authenticated as additional data, so keys can be listed without the
+// password but not swapped.
+//
+// XMSS keys are stateful. A Dir keeps the index of the next unused leaf in
+// a separate file next to each keystore, so signing never rewrites the
+// encrypted key.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/xmss"
+)
+
+const (
+	Version = 1
+
+	kdfPBKDF2    = "pbkdf2"
+	prfSHA256    = "hmac-sha256"
+	cipherAESGCM = "aes-256-gcm"
+
+	// DefaultIterations is the PBKDF2 iteration count for new keystores.
+	DefaultIterations = 262144
+	// MaxIterations bounds the iteration count a keystore may ask for, so
+	// a crafted keystore cannot stall the node on decryption.
+	MaxIterations = 16 * DefaultIterations
+
+	keyLen   = 32
+	saltLen  = 32
+	nonceLen = 12
+)
+
+// ErrWrongPassword is returned when a keystore fails to decrypt.
+var ErrWrongPassword = errors.New("keystore: wrong password or corrupted keystore")
+
+// Keystore is the on-disk form of one encrypted key.
+type Keystore struct {
+	Version    int    `json:"version"`
+	Pubkey     string `json:"pubkey"`
+	TreeHeight int    `json:"tree_height"`
+	Crypto     Crypto `json:"crypto"`
+
+	// NextLeaf is only set in exported keystores: it carries the leaf
+	// counter to the importing side.
+	NextLeaf uint64 `json:"next_leaf,omitempty"`
+}
+
+type Crypto struct {
+	KDF    KDF    `json:"kdf"`
+	Cipher Cipher `json:"cipher"`
+}
+
+type KDF struct {
+	Function   string `json:"function"`
+	Iterations int    `json:"c"`
+	PRF        string `json:"prf"`
+	Salt       string `json:"salt"`
+}
+
+type Cipher struct {
+	Function string `json:"function"`
+	Nonce    string `json:"nonce"`
+	Message  string `json:"message"`
+}
+
+// Encrypt seals key under password using iterations rounds of PBKDF2.
+func Encrypt(key *xmss.PrivateKey, password string, iterations int) (*Keystore, error) {
+	if iterations < 1 || iterations > MaxIterations {
+		return nil, fmt.Errorf("keystore: invalid iteration count %d", iterations)
+	}
+	salt := make([]byte, saltLen)
+	nonce := make([]byte, nonceLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	pubkey := key.PublicKey()
+	aead, err := newAEAD(pbkdf2([]byte(password), salt, iterations, keyLen))
+	if err != nil {
+		return nil, err
+	}
+	return &Keystore{
+		Version:    Version,
+		Pubkey:     encodeHex(pubkey[:]),
+		TreeHeight: key.Params().TreeHeight,
+		Crypto: Crypto{
+			KDF: KDF{Function: kdfPBKDF2, Iterations: iterations, PRF: prfSHA256, Salt: encodeHex(salt)},
+			Cipher: Cipher{
+				Function: cipherAESGCM,
+				Nonce:    encodeHex(nonce),
+				Message:  encodeHex(aead.Seal(nil, nonce, key.Bytes(), pubkey[:])),
+			},
+		},
+	}, nil
+}
+
+// PublicKey returns the public key of the stored key.
+func (ks *Keystore) PublicKey() (types.Bytes52, error) {
+	return ParsePublicKey(ks.Pubkey)
+}
+
+// ParsePublicKey decodes a hex-encoded public key, with or without a 0x
+// prefix.
+func ParsePublicKey(s string) (types.Bytes52, error) {
+	var pk types.Bytes52
+	b, err := decodeHex(s)
+	if err != nil {
+		return pk, fmt.Errorf("keystore: pubkey: %w", err)
+	}
+	if len(b) != len(pk) {
+		return pk, fmt.Errorf("keystore: pubkey is %d bytes, want %d", len(b), len(pk))
+	}
+	copy(pk[:], b)
+	return pk, nil
+}
+
+// Lifetime returns how many signatures the stored key can make in total.
+func (ks *Keystore) Lifetime() uint64 {
+	return xmss.Params{TreeHeight: ks.TreeHeight}.Lifetime()
+}
+
+// Decrypt opens the keystore and rebuilds the key, which costs as much as
+// generating it.
+func (ks *Keystore) Decrypt(password string) (*xmss.PrivateKey, error) {
+	if ks.Version != Version {
+		return nil, fmt.Errorf("keystore: unsupported version %d", ks.Version)
+	}
+	kdf, c := ks.Crypto.KDF, ks.Crypto.Cipher
+	if kdf.Function != kdfPBKDF2 || kdf.PRF != prfSHA256 {
+		return nil, fmt.Errorf("keystore: unsupported kdf %s/%s", kdf.Function, kdf.PRF)
+	}
+	if kdf.Iterations < 1 || kdf.Iterations > MaxIterations {
+		return nil, fmt.Errorf("keystore: invalid iteration count %d", kdf.Iterations)
+	}
+	if c.Function != cipherAESGCM {
+		return nil, fmt.Errorf("keystore: unsupported cipher %s", c.Function)
+	}
+	pubkey, err := ks.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	salt, err := decodeHex(kdf.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: salt: %w", err)
+	}
+	nonce, err := decodeHex(c.Nonce)
+	if err != nil || len(nonce) != nonceLen {
+		return nil, fmt.Errorf("keystore: invalid nonce")
+	}
+	sealed, err := decodeHex(c.Message)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: message: %w", err)
+	}
+
+	aead, err := newAEAD(pbkdf2([]byte(password), salt, kdf.Iterations, keyLen))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, sealed, pubkey[:])
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	key, err := xmss.ParsePrivateKey(plain)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	if key.PublicKey() != pubkey {
+		return nil, errors.New("keystore: decrypted key does not match pubkey")
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 derives a key as specified in RFC 8018 with HMAC-SHA256.
+func pbkdf2(password, salt []byte, iterations, length int) []byte {
+	prf := hmac.New(sha256.New, password)
+	out := make([]byte, 0, length)
+	for block := uint32(1); len(out) < length; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:length]
+}
+
+func encodeHex(b []byte) string { return "0x" + hex.EncodeToString(b) }
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
@@ -0,0 +1,167 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/xmss"
+)
+
+var testParams = xmss.Params{TreeHeight: 4}
+
+func newKey(t *testing.T) *xmss.PrivateKey {
+	t.Helper()
+	k, err := xmss.GenerateKey(testParams, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestPBKDF2(t *testing.T) {
+	// Known-answer vectors for PBKDF2-HMAC-SHA256.
+	tests := []struct {
+		iterations int
+		want       string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2([]byte("password"), []byte("salt"), tt.iterations, 32))
+		if got != tt.want {
+			t.Errorf("c=%d: got %s, want %s", tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := newKey(t)
+	ks, err := Encrypt(key, "hunter2", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pk, _ := ks.PublicKey(); pk != key.PublicKey() {
+		t.Error("keystore pubkey does not match the key")
+	}
+	if ks.Lifetime() != testParams.Lifetime() {
+		t.Errorf("lifetime = %d, want %d", ks.Lifetime(), testParams.Lifetime())
+	}
+
+	got, err := ks.Decrypt("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PublicKey() != key.PublicKey() {
+		t.Error("decrypted key differs")
+	}
+	if _, err := ks.Decrypt("wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected ErrWrongPassword, got %v", err)
+	}
+
+	// The public key is authenticated.
+	other := newKey(t).PublicKey()
+	swapped := *ks
+	swapped.Pubkey = encodeHex(other[:])
+	if _, err := swapped.Decrypt("hunter2"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected a swapped pubkey to fail, got %v", err)
+	}
+
+	// A crafted iteration count must not stall decryption.
+	costly := *ks
+	costly.Crypto.KDF.Iterations = MaxIterations + 1
+	if _, err := costly.Decrypt("hunter2"); err == nil {
+		t.Error("expected an excessive iteration count to be refused")
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir, err := OpenDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newKey(t)
+	pubkey := key.PublicKey()
+	ks, _ := Encrypt(key, "pw", 16)
+	if err := dir.Store(ks); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.Store(ks); err == nil {
+		t.Error("expected an existing keystore to be kept")
+	}
+	list, err := dir.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Pubkey != ks.Pubkey {
+		t.Fatalf("list = %v", list)
+	}
+
+	signer, err := dir.Signer(pubkey, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := signer.Sign(types.Root{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if next, _ := dir.Leaves(pubkey).Load(); next != 3 {
+		t.Errorf("leaf counter = %d, want 3", next)
+	}
+
+	out := filepath.Join(t.TempDir(), "export.json")
+	if _, err := dir.Export(pubkey, out); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported.NextLeaf != 3 {
+		t.Errorf("exported leaf counter = %d, want 3", exported.NextLeaf)
+	}
+	if retired, err := dir.Signer(pubkey, "pw"); err != nil || retired.Remaining() != 0 {
+		t.Error("the exported key should no longer sign from the source directory")
+	}
+	if _, err := dir.Export(pubkey, out); err == nil {
+		t.Error("a retired key should not be exported again")
+	}
+
+	dst, _ := OpenDir(t.TempDir())
+	if err := dst.Import(exported); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := dst.Load(pubkey)
+	if stored.NextLeaf != 0 {
+		t.Error("the leaf counter belongs in the leaf file, not the keystore")
+	}
+	imported, err := dst.Signer(pubkey, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Remaining() != testParams.Lifetime()-3 {
+		t.Errorf("imported key has %d leaves left, want %d", imported.Remaining(), testParams.Lifetime()-3)
+	}
+
+	// Re-importing an older export never moves the counter back.
+	imported.Sign(types.Root{9})
+	if err := dst.Import(exported); err != nil {
+		t.Fatal(err)
+	}
+	if next, _ := dst.Leaves(pubkey).Load(); next != 4 {
+		t.Errorf("leaf counter = %d, want 4", next)
+	}
+
+	// A lost counter must not restart the key at leaf 0.
+	os.Remove(filepath.Join(dst.path, hex.EncodeToString(pubkey[:])+".leaf"))
+	if _, err := dst.Signer(pubkey, "pw"); !errors.Is(err, xmss.ErrNoLeafIndex) {
+		t.Errorf("expected ErrNoLeafIndex, got %v", err)
+	}
+}
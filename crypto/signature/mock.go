@@ -0,0 +1,67 @@
+package signature
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// ErrMockSignature is returned by MockVerifier for any mismatch.
+var ErrMockSignature = errors.New("mock signature mismatch")
+
+// MockSigner produces deterministic fake signatures: the public key is
+// derived from a seed and the signature is a hash expansion of the public key
+// and message. Anyone who knows the public key can forge signatures, so it
+// must never be used outside tests and local simulations.
+type MockSigner struct {
+	pubkey types.Bytes52
+}
+
+// NewMockSigner derives a mock key from seed; equal seeds give equal keys.
+func NewMockSigner(seed uint64) *MockSigner {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], seed)
+	s := &MockSigner{}
+	expand(s.pubkey[:], []byte("gean-mock-pubkey"), buf[:])
+	return s
+}
+
+func (s *MockSigner) PublicKey() types.Bytes52 { return s.pubkey }
+
+func (s *MockSigner) Sign(msg types.Root) (types.Bytes3116, error) {
+	return mockSignature(s.pubkey, msg), nil
+}
+
+// MockVerifier accepts signatures produced by MockSigner.
+type MockVerifier struct{}
+
+func (MockVerifier) Verify(pubkey types.Bytes52, msg types.Root, sig *types.Bytes3116) error {
+	if *sig != mockSignature(pubkey, msg) {
+		return ErrMockSignature
+	}
+	return nil
+}
+
+func mockSignature(pubkey types.Bytes52, msg types.Root) types.Bytes3116 {
+	var sig types.Bytes3116
+	expand(sig[:], []byte("gean-mock-signature"), pubkey[:], msg[:])
+	return sig
+}
+
+// expand fills out with SHA-256(domain || inputs || counter) blocks.
+func expand(out []byte, domain []byte, inputs ...[]byte) {
+	var counter [4]byte
+	for i := 0; len(out) > 0; i++ {
+		binary.LittleEndian.PutUint32(counter[:], uint32(i))
+		h := sha256.New()
+		h.Write(domain)
+		for _, in := range inputs {
+			h.Write(in)
+		}
+		h.Write(counter[:])
+		n := copy(out, h.Sum(nil))
+		out = out[n:]
+	}
+}
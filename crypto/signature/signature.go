@@ -0,0 +1,51 @@
+// Package signature defines the signing interfaces used by block
+// verification and the validator client, with an XMSS backend and a fast,
+// insecure mock backend for tests and local simulations.
+package signature
+
+import (
+	"fmt"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/xmss"
+)
+
+// Signer produces signatures for a single validator key.
+type Signer interface {
+	PublicKey() types.Bytes52
+	Sign(msg types.Root) (types.Bytes3116, error)
+}
+
+// Verifier checks signatures against a public key.
+type Verifier interface {
+	Verify(pubkey types.Bytes52, msg types.Root, sig *types.Bytes3116) error
+}
+
+// Scheme names accepted by NewVerifier.
+const (
+	SchemeXMSS = "xmss"
+	SchemeMock = "mock"
+)
+
+// NewVerifier returns the verifier for a configured scheme name.
+func NewVerifier(scheme string) (Verifier, error) {
+	switch scheme {
+	case SchemeXMSS:
+		return XMSSVerifier{Params: xmss.DefaultParams}, nil
+	case SchemeMock:
+		return MockVerifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown signature scheme %q", scheme)
+	}
+}
+
+// XMSSVerifier verifies XMSS signatures. *xmss.Signer is the matching Signer.
+type XMSSVerifier struct {
+	Params xmss.Params
+}
+
+func (v XMSSVerifier) Verify(pubkey types.Bytes52, msg types.Root, sig *types.Bytes3116) error {
+	return xmss.Verify(v.Params, pubkey, msg, sig)
+}
+
+var _ Signer = (*xmss.Signer)(nil)
@@ -0,0 +1,73 @@
+package signature
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/xmss"
+)
+
+func TestNewVerifier(t *testing.T) {
+	if v, err := NewVerifier(SchemeXMSS); err != nil || v == nil {
+		t.Errorf("xmss: %v", err)
+	}
+	if v, err := NewVerifier(SchemeMock); err != nil || v == nil {
+		t.Errorf("mock: %v", err)
+	}
+	if _, err := NewVerifier("bls"); err == nil {
+		t.Error("expected error for unknown scheme")
+	}
+}
+
+func TestMockSignAndVerify(t *testing.T) {
+	s := NewMockSigner(1)
+	if s.PublicKey() != NewMockSigner(1).PublicKey() {
+		t.Error("mock keys should be deterministic")
+	}
+	if s.PublicKey() == NewMockSigner(2).PublicKey() {
+		t.Error("different seeds should give different keys")
+	}
+
+	msg := types.Root{1, 2, 3}
+	sig, err := s.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (MockVerifier{}).Verify(s.PublicKey(), msg, &sig); err != nil {
+		t.Error(err)
+	}
+	if err := (MockVerifier{}).Verify(s.PublicKey(), types.Root{9}, &sig); !errors.Is(err, ErrMockSignature) {
+		t.Errorf("wrong message: %v", err)
+	}
+	if err := (MockVerifier{}).Verify(NewMockSigner(2).PublicKey(), msg, &sig); !errors.Is(err, ErrMockSignature) {
+		t.Errorf("wrong key: %v", err)
+	}
+}
+
+func TestXMSSBackend(t *testing.T) {
+	params := xmss.Params{TreeHeight: 2}
+	key, err := xmss.GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs, err := xmss.NewSigner(key, &xmss.MemoryLeafStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Signer = xs
+	var v Verifier = XMSSVerifier{Params: params}
+
+	msg := types.Root{7}
+	sig, err := s.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(s.PublicKey(), msg, &sig); err != nil {
+		t.Error(err)
+	}
+	if err := v.Verify(s.PublicKey(), types.Root{8}, &sig); err == nil {
+		t.Error("expected failure for wrong message")
+	}
+}
@@ -0,0 +1,98 @@
+package xmss
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+type hash [HashLen]byte
+
+// Domain separators for the tweakable hash.
+const (
+	tweakChain   = 0x00
+	tweakTree    = 0x01
+	tweakMessage = 0x02
+	tweakSecret  = 0x03
+	tweakRand    = 0x04
+)
+
+// tweakHash computes SHA-256(parameter || tweak || inputs...).
+func tweakHash(param *[ParameterLen]byte, tweak []byte, inputs ...[]byte) hash {
+	h := sha256.New()
+	h.Write(param[:])
+	h.Write(tweak)
+	for _, in := range inputs {
+		h.Write(in)
+	}
+	var out hash
+	h.Sum(out[:0])
+	return out
+}
+
+func chainTweak(leaf uint32, chain, pos int) []byte {
+	t := make([]byte, 7)
+	t[0] = tweakChain
+	binary.LittleEndian.PutUint32(t[1:], leaf)
+	t[5] = byte(chain)
+	t[6] = byte(pos)
+	return t
+}
+
+func treeTweak(level int, index uint32) []byte {
+	t := make([]byte, 6)
+	t[0] = tweakTree
+	t[1] = byte(level)
+	binary.LittleEndian.PutUint32(t[2:], index)
+	return t
+}
+
+func messageTweak(leaf uint32) []byte {
+	t := make([]byte, 5)
+	t[0] = tweakMessage
+	binary.LittleEndian.PutUint32(t[1:], leaf)
+	return t
+}
+
+// walkChain advances a chain value from position start to position end.
+func walkChain(param *[ParameterLen]byte, leaf uint32, chain int, value hash, start, end int) hash {
+	for pos := start + 1; pos <= end; pos++ {
+		value = tweakHash(param, chainTweak(leaf, chain, pos), value[:])
+	}
+	return value
+}
+
+// encodeMessage maps a message to one chain position per chain: the base-16
+// digits of the message digest followed by the digits of their checksum.
+func encodeMessage(param *[ParameterLen]byte, leaf uint32, rho *[RandLen]byte, msg []byte) [NumChains]int {
+	digest := tweakHash(param, messageTweak(leaf), rho[:], msg)
+
+	var steps [NumChains]int
+	checksum := 0
+	for i := 0; i < MessageChains; i++ {
+		b := digest[i/2]
+		if i%2 == 0 {
+			steps[i] = int(b & 0x0f)
+		} else {
+			steps[i] = int(b >> 4)
+		}
+		checksum += ChainLength - 1 - steps[i]
+	}
+	for i := 0; i < ChecksumChains; i++ {
+		steps[MessageChains+i] = checksum & (ChainLength - 1)
+		checksum >>= ChunkBits
+	}
+	return steps
+}
+
+// leafHash compresses the chain ends of a one-time key into a tree leaf.
+func leafHash(param *[ParameterLen]byte, leaf uint32, ends *[NumChains]hash) hash {
+	inputs := make([][]byte, NumChains)
+	for i := range ends {
+		inputs[i] = ends[i][:]
+	}
+	return tweakHash(param, treeTweak(0, leaf), inputs...)
+}
+
+func nodeHash(param *[ParameterLen]byte, level int, index uint32, left, right hash) hash {
+	return tweakHash(param, treeTweak(level, index), left[:], right[:])
+}
@@ -0,0 +1,156 @@
+package xmss
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// PrivateKey derives every one-time key from a secret seed and keeps the
+// full Merkle tree so that authentication paths are cheap to produce.
+//
+// A PrivateKey does not track which leaves have been used; sign through a
+// Signer to get that guarantee.
+type PrivateKey struct {
+	params Params
+	seed   [HashLen]byte
+	param  [ParameterLen]byte
+	tree   [][]hash // tree[level][index], tree[0] are the leaves
+}
+
+// GenerateKey draws a seed and public parameter from rand and builds the
+// key tree. Generation cost grows with 2^TreeHeight.
+func GenerateKey(p Params, rand io.Reader) (*PrivateKey, error) {
+	var seed [HashLen]byte
+	var param [ParameterLen]byte
+	if _, err := io.ReadFull(rand, seed[:]); err != nil {
+		return nil, fmt.Errorf("read seed: %w", err)
+	}
+	if _, err := io.ReadFull(rand, param[:]); err != nil {
+		return nil, fmt.Errorf("read parameter: %w", err)
+	}
+	return newPrivateKey(p, seed, param)
+}
+
+func newPrivateKey(p Params, seed [HashLen]byte, param [ParameterLen]byte) (*PrivateKey, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	k := &PrivateKey{params: p, seed: seed, param: param}
+	k.buildTree()
+	return k, nil
+}
+
+func (k *PrivateKey) Params() Params { return k.params }
+
+// PrivateKeySize is the length of an encoded private key: the tree height,
+// the seed and the public parameter.
+const PrivateKeySize = 1 + HashLen + ParameterLen
+
+// Bytes encodes the key. The tree is not included; ParsePrivateKey rebuilds
+// it.
+func (k *PrivateKey) Bytes() []byte {
+	out := make([]byte, 0, PrivateKeySize)
+	out = append(out, byte(k.params.TreeHeight))
+	out = append(out, k.seed[:]...)
+	return append(out, k.param[:]...)
+}
+
+// ParsePrivateKey decodes a key encoded with Bytes. It rebuilds the key
+// tree, which costs as much as GenerateKey.
+func ParsePrivateKey(data []byte) (*PrivateKey, error) {
+	if len(data) != PrivateKeySize {
+		return nil, fmt.Errorf("private key is %d bytes, want %d", len(data), PrivateKeySize)
+	}
+	var seed [HashLen]byte
+	var param [ParameterLen]byte
+	copy(seed[:], data[1:])
+	copy(param[:], data[1+HashLen:])
+	return newPrivateKey(Params{TreeHeight: int(data[0])}, seed, param)
+}
+
+func (k *PrivateKey) secret(leaf uint32, chain int) hash {
+	buf := make([]byte, 1+HashLen+5)
+	buf[0] = tweakSecret
+	copy(buf[1:], k.seed[:])
+	binary.LittleEndian.PutUint32(buf[1+HashLen:], leaf)
+	buf[1+HashLen+4] = byte(chain)
+	return sha256.Sum256(buf)
+}
+
+func (k *PrivateKey) chainEnds(leaf uint32) [NumChains]hash {
+	var ends [NumChains]hash
+	for i := range ends {
+		ends[i] = walkChain(&k.param, leaf, i, k.secret(leaf, i), 0, ChainLength-1)
+	}
+	return ends
+}
+
+func (k *PrivateKey) buildTree() {
+	n := k.params.Lifetime()
+	leaves := make([]hash, n)
+
+	// Leaves dominate generation time and are independent of each other.
+	workers := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := uint64(w); i < n; i += uint64(workers) {
+				ends := k.chainEnds(uint32(i))
+				leaves[i] = leafHash(&k.param, uint32(i), &ends)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	k.tree = [][]hash{leaves}
+	for level := 1; level <= k.params.TreeHeight; level++ {
+		prev := k.tree[level-1]
+		nodes := make([]hash, len(prev)/2)
+		for i := range nodes {
+			nodes[i] = nodeHash(&k.param, level, uint32(i), prev[2*i], prev[2*i+1])
+		}
+		k.tree = append(k.tree, nodes)
+	}
+}
+
+// PublicKey returns the Merkle root followed by the public parameter.
+func (k *PrivateKey) PublicKey() types.Bytes52 {
+	var pk types.Bytes52
+	copy(pk[:HashLen], k.tree[k.params.TreeHeight][0][:])
+	copy(pk[HashLen:], k.param[:])
+	return pk
+}
+
+// sign produces the one-time signature of msg at the given leaf. Callers are
+// responsible for never reusing a leaf.
+func (k *PrivateKey) sign(leaf uint32, msg types.Root) types.Bytes3116 {
+	s := &Signature{Leaf: leaf, Path: make([]hash, k.params.TreeHeight)}
+
+	buf := make([]byte, 1+HashLen+4+len(msg))
+	buf[0] = tweakRand
+	copy(buf[1:], k.seed[:])
+	binary.LittleEndian.PutUint32(buf[1+HashLen:], leaf)
+	copy(buf[1+HashLen+4:], msg[:])
+	rho := sha256.Sum256(buf)
+	copy(s.Rho[:], rho[:])
+
+	steps := encodeMessage(&k.param, leaf, &s.Rho, msg[:])
+	for i := range s.Chains {
+		s.Chains[i] = walkChain(&k.param, leaf, i, k.secret(leaf, i), 0, steps[i])
+	}
+
+	index := leaf
+	for level := range s.Path {
+		s.Path[level] = k.tree[level][index^1]
+		index /= 2
+	}
+	return s.Bytes()
+}
@@ -0,0 +1,54 @@
+// Package xmss implements a stateful hash-based signature scheme: a
+// Winternitz one-time signature per leaf and a Merkle authentication path to
+// the public root.
+//
+// Public keys are the 32-byte Merkle root followed by a 20-byte public
+// parameter (types.Bytes52). Signatures are padded to types.Bytes3116.
+//
+// The tweakable hash is SHA-256. This is not the leanSig instantiation and
+// does not interoperate with other lean clients: signatures only verify
+// between gean nodes.
+package xmss
+
+import "fmt"
+
+const (
+	HashLen      = 32
+	ParameterLen = 20
+	RandLen      = 28
+
+	ChunkBits      = 4
+	ChainLength    = 1 << ChunkBits
+	MessageChains  = HashLen * 8 / ChunkBits
+	ChecksumChains = 3
+	NumChains      = MessageChains + ChecksumChains
+
+	PublicKeySize = HashLen + ParameterLen
+	SignatureSize = 3116
+
+	// sigHeaderSize covers the leaf index and the encoding randomness.
+	sigHeaderSize = 4 + RandLen
+
+	// MaxTreeHeight is the tallest tree whose path still fits in SignatureSize.
+	MaxTreeHeight = (SignatureSize - sigHeaderSize - NumChains*HashLen) / HashLen
+)
+
+// Params selects the key lifetime. A key can sign 2^TreeHeight messages.
+type Params struct {
+	TreeHeight int
+}
+
+// DefaultParams is the lifetime used for validator keys.
+var DefaultParams = Params{TreeHeight: 18}
+
+func (p Params) Validate() error {
+	if p.TreeHeight < 1 || p.TreeHeight > MaxTreeHeight {
+		return fmt.Errorf("tree height %d outside [1, %d]", p.TreeHeight, MaxTreeHeight)
+	}
+	return nil
+}
+
+// Lifetime returns the number of one-time keys in the tree.
+func (p Params) Lifetime() uint64 {
+	return 1 << p.TreeHeight
+}
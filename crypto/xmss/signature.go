@@ -0,0 +1,72 @@
+package xmss
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+var ErrInvalidSignature = errors.New("xmss: invalid signature")
+
+// Signature is a parsed XMSS signature.
+//
+// Encoded layout, little-endian, zero padded to SignatureSize:
+//
+//	leaf index (4) | rho (28) | chain values (67 * 32) | auth path (height * 32)
+type Signature struct {
+	Leaf   uint32
+	Rho    [RandLen]byte
+	Chains [NumChains]hash
+	Path   []hash
+}
+
+// ParseSignature decodes sig for the given parameters. Non-zero padding and
+// out-of-range leaf indices are rejected.
+func ParseSignature(p Params, sig *types.Bytes3116) (*Signature, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Signature{
+		Leaf: binary.LittleEndian.Uint32(sig[0:4]),
+		Path: make([]hash, p.TreeHeight),
+	}
+	if uint64(s.Leaf) >= p.Lifetime() {
+		return nil, fmt.Errorf("%w: leaf %d outside lifetime %d", ErrInvalidSignature, s.Leaf, p.Lifetime())
+	}
+	copy(s.Rho[:], sig[4:sigHeaderSize])
+
+	off := sigHeaderSize
+	for i := range s.Chains {
+		copy(s.Chains[i][:], sig[off:off+HashLen])
+		off += HashLen
+	}
+	for i := range s.Path {
+		copy(s.Path[i][:], sig[off:off+HashLen])
+		off += HashLen
+	}
+	for _, b := range sig[off:] {
+		if b != 0 {
+			return nil, fmt.Errorf("%w: non-zero padding", ErrInvalidSignature)
+		}
+	}
+	return s, nil
+}
+
+// Bytes encodes the signature into its fixed-size wire form.
+func (s *Signature) Bytes() types.Bytes3116 {
+	var out types.Bytes3116
+	binary.LittleEndian.PutUint32(out[0:4], s.Leaf)
+	copy(out[4:sigHeaderSize], s.Rho[:])
+	off := sigHeaderSize
+	for i := range s.Chains {
+		copy(out[off:], s.Chains[i][:])
+		off += HashLen
+	}
+	for i := range s.Path {
+		copy(out[off:], s.Path[i][:])
+		off += HashLen
+	}
+	return out
+}
@@ -0,0 +1,182 @@
+package xmss
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+var ErrKeyExhausted = errors.New("xmss: all one-time keys used")
+
+// ErrNoLeafIndex is returned when a key's leaf index file is missing.
+// Starting over at leaf 0 could reuse one-time keys, so a missing index is
+// never treated as a fresh key.
+var ErrNoLeafIndex = errors.New("xmss: leaf index missing")
+
+// LeafStore persists the index of the next unused leaf.
+type LeafStore interface {
+	Load() (uint64, error)
+	Store(next uint64) error
+}
+
+// Signer signs with a PrivateKey while guaranteeing that no leaf is used
+// twice. The next leaf index is persisted before a signature is released, so
+// a crash can only skip leaves, never reuse them.
+type Signer struct {
+	mu    sync.Mutex
+	key   *PrivateKey
+	store LeafStore
+	next  uint64
+	// first and end bound the leaves the signer may use.
+	first, end uint64
+}
+
+func NewSigner(key *PrivateKey, store LeafStore) (*Signer, error) {
+	return NewRangeSigner(key, store, 0, key.params.Lifetime())
+}
+
+// NewRangeSigner returns a signer restricted to the leaves in [first, end).
+// Two signers sharing a key, such as a remote signer and a local fallback,
+// never reuse a leaf if their ranges are disjoint.
+func NewRangeSigner(key *PrivateKey, store LeafStore, first, end uint64) (*Signer, error) {
+	if first >= end || end > key.params.Lifetime() {
+		return nil, fmt.Errorf("xmss: invalid leaf range [%d, %d) for lifetime %d", first, end, key.params.Lifetime())
+	}
+	next, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("load leaf index: %w", err)
+	}
+	return &Signer{key: key, store: store, next: max(next, first), first: first, end: end}, nil
+}
+
+func (s *Signer) PublicKey() types.Bytes52 {
+	return s.key.PublicKey()
+}
+
+func (s *Signer) Params() Params { return s.key.params }
+
+// LeafRange returns the range [first, end) of leaves the signer may use.
+func (s *Signer) LeafRange() (first, end uint64) {
+	return s.first, s.end
+}
+
+// Remaining returns how many signatures the key can still produce.
+func (s *Signer) Remaining() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= s.end {
+		return 0
+	}
+	return s.end - s.next
+}
+
+// Sign consumes the next leaf and signs msg with it.
+func (s *Signer) Sign(msg types.Root) (types.Bytes3116, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next >= s.end {
+		return types.Bytes3116{}, ErrKeyExhausted
+	}
+	leaf := s.next
+	if err := s.store.Store(leaf + 1); err != nil {
+		return types.Bytes3116{}, fmt.Errorf("persist leaf index: %w", err)
+	}
+	s.next = leaf + 1
+	return s.key.sign(uint32(leaf), msg), nil
+}
+
+// MemoryLeafStore keeps the next leaf index in memory. It suits tests and
+// throwaway keys only: a restarted process starts over at leaf 0.
+type MemoryLeafStore struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+func (m *MemoryLeafStore) Load() (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.next, nil
+}
+
+func (m *MemoryLeafStore) Store(next uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next = next
+	return nil
+}
+
+// FileLeafStore keeps the next leaf index in a file, replaced atomically on
+// every update.
+type FileLeafStore struct {
+	path string
+}
+
+// NewFileLeafStore opens the leaf index of an existing key. Load fails with
+// ErrNoLeafIndex if the file does not exist.
+func NewFileLeafStore(path string) *FileLeafStore {
+	return &FileLeafStore{path: path}
+}
+
+// CreateFileLeafStore creates the leaf index of a new key at path, starting
+// at next. It fails if the file already exists.
+func CreateFileLeafStore(path string, next uint64) (*FileLeafStore, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	store := &FileLeafStore{path: path}
+	if err := store.Store(next); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (f *FileLeafStore) Load() (uint64, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("%w: %s", ErrNoLeafIndex, f.path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func (f *FileLeafStore) Store(next uint64) error {
+	dir := filepath.Dir(f.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strconv.FormatUint(next, 10) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
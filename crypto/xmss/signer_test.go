@@ -0,0 +1,167 @@
+package xmss
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// failingLeafStore cannot persist the leaf index.
+type failingLeafStore struct{ err error }
+
+func (f *failingLeafStore) Load() (uint64, error) { return 0, nil }
+func (f *failingLeafStore) Store(uint64) error    { return f.err }
+
+func TestGenerateKey(t *testing.T) {
+	k, err := GenerateKey(testParams, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateKey(testParams, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.PublicKey() == other.PublicKey() {
+		t.Error("independent keys should differ")
+	}
+	if _, err := GenerateKey(testParams, bytes.NewReader(make([]byte, 10))); err == nil {
+		t.Error("expected error for short randomness")
+	}
+	if _, err := GenerateKey(Params{TreeHeight: 0}, rand.Reader); err == nil {
+		t.Error("expected error for invalid params")
+	}
+}
+
+func TestPrivateKeyEncoding(t *testing.T) {
+	k, err := GenerateKey(testParams, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParsePrivateKey(k.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.PublicKey() != k.PublicKey() || parsed.Params() != k.Params() {
+		t.Error("parsed key differs from the original")
+	}
+	if _, err := ParsePrivateKey(k.Bytes()[1:]); err == nil {
+		t.Error("expected error for a truncated key")
+	}
+}
+
+func TestSignerUsesEachLeafOnce(t *testing.T) {
+	k := testKey(t)
+	s, err := NewSigner(k, &MemoryLeafStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[uint32]bool)
+	for i := uint64(0); i < testParams.Lifetime(); i++ {
+		msg := types.Root{byte(i)}
+		sig, err := s.Sign(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Verify(testParams, s.PublicKey(), msg, &sig); err != nil {
+			t.Fatal(err)
+		}
+		parsed, _ := ParseSignature(testParams, &sig)
+		if seen[parsed.Leaf] {
+			t.Fatalf("leaf %d reused", parsed.Leaf)
+		}
+		seen[parsed.Leaf] = true
+	}
+
+	if s.Remaining() != 0 {
+		t.Errorf("expected no remaining leaves, got %d", s.Remaining())
+	}
+	if _, err := s.Sign(types.Root{}); !errors.Is(err, ErrKeyExhausted) {
+		t.Errorf("expected ErrKeyExhausted, got %v", err)
+	}
+}
+
+func TestSignerPersistFailure(t *testing.T) {
+	store := &failingLeafStore{err: errors.New("disk full")}
+	s, err := NewSigner(testKey(t), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sign(types.Root{1}); err == nil {
+		t.Fatal("expected error when the leaf index cannot be persisted")
+	}
+	if s.Remaining() != testParams.Lifetime() {
+		t.Error("failed sign should not consume a leaf")
+	}
+}
+
+func TestSignerResumesFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leaf")
+	k := testKey(t)
+
+	if _, err := NewSigner(k, NewFileLeafStore(path)); !errors.Is(err, ErrNoLeafIndex) {
+		t.Fatalf("expected ErrNoLeafIndex for a missing index, got %v", err)
+	}
+	store, err := CreateFileLeafStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateFileLeafStore(path, 0); err == nil {
+		t.Error("expected an existing index not to be recreated")
+	}
+	s, err := NewSigner(k, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := s.Sign(types.Root{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Restart: the new signer must continue after the used leaves.
+	s, err = NewSigner(k, NewFileLeafStore(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := s.Sign(types.Root{9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := ParseSignature(testParams, &sig)
+	if parsed.Leaf != 3 {
+		t.Errorf("expected leaf 3 after restart, got %d", parsed.Leaf)
+	}
+}
+
+func TestRangeSigner(t *testing.T) {
+	k := testKey(t)
+	lifetime := testParams.Lifetime()
+	if _, err := NewRangeSigner(k, &MemoryLeafStore{}, 4, 4); err == nil {
+		t.Error("expected an error for an empty range")
+	}
+	if _, err := NewRangeSigner(k, &MemoryLeafStore{}, 0, lifetime+1); err == nil {
+		t.Error("expected an error for a range beyond the lifetime")
+	}
+
+	s, err := NewRangeSigner(k, &MemoryLeafStore{}, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := uint32(2); want < 4; want++ {
+		sig, err := s.Sign(types.Root{byte(want)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed, _ := ParseSignature(testParams, &sig); parsed.Leaf != want {
+			t.Errorf("signed with leaf %d, want %d", parsed.Leaf, want)
+		}
+	}
+	if _, err := s.Sign(types.Root{}); !errors.Is(err, ErrKeyExhausted) {
+		t.Errorf("expected ErrKeyExhausted at the end of the range, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package xmss
+
+import (
+	"fmt"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// Verify checks sig over msg against the public key (Merkle root followed by
+// the public parameter).
+func Verify(p Params, pubkey types.Bytes52, msg types.Root, sig *types.Bytes3116) error {
+	s, err := ParseSignature(p, sig)
+	if err != nil {
+		return err
+	}
+
+	var param [ParameterLen]byte
+	copy(param[:], pubkey[HashLen:])
+
+	steps := encodeMessage(&param, s.Leaf, &s.Rho, msg[:])
+	var ends [NumChains]hash
+	for i := range ends {
+		ends[i] = walkChain(&param, s.Leaf, i, s.Chains[i], steps[i], ChainLength-1)
+	}
+
+	node := leafHash(&param, s.Leaf, &ends)
+	index := s.Leaf
+	for level, sibling := range s.Path {
+		if index%2 == 0 {
+			node = nodeHash(&param, level+1, index/2, node, sibling)
+		} else {
+			node = nodeHash(&param, level+1, index/2, sibling, node)
+		}
+		index /= 2
+	}
+
+	var root hash
+	copy(root[:], pubkey[:HashLen])
+	if node != root {
+		return fmt.Errorf("%w: root mismatch", ErrInvalidSignature)
+	}
+	return nil
+}
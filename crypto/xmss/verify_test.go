@@ -0,0 +1,120 @@
+package xmss
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+var testParams = Params{TreeHeight: 3}
+
+func testKey(t *testing.T) *PrivateKey {
+	t.Helper()
+	var seed [HashLen]byte
+	var param [ParameterLen]byte
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	for i := range param {
+		param[i] = byte(0xa0 + i)
+	}
+	k, err := newPrivateKey(testParams, seed, param)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestVerifyAllLeaves(t *testing.T) {
+	k := testKey(t)
+	pk := k.PublicKey()
+	msg := types.Root{1, 2, 3}
+	for leaf := uint32(0); leaf < uint32(testParams.Lifetime()); leaf++ {
+		sig := k.sign(leaf, msg)
+		if err := Verify(testParams, pk, msg, &sig); err != nil {
+			t.Errorf("leaf %d: %v", leaf, err)
+		}
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	k := testKey(t)
+	pk := k.PublicKey()
+	msg := types.Root{1, 2, 3}
+	sig := k.sign(5, msg)
+
+	if err := Verify(testParams, pk, types.Root{9}, &sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong message: %v", err)
+	}
+
+	tests := map[string]int{
+		"leaf index": 0,
+		"rho":        4,
+		"chain":      sigHeaderSize + 10*HashLen,
+		"path":       sigHeaderSize + NumChains*HashLen + 1,
+		"padding":    SignatureSize - 1,
+	}
+	for name, pos := range tests {
+		bad := sig
+		bad[pos] ^= 0x01
+		if err := Verify(testParams, pk, msg, &bad); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected invalid signature, got %v", name, err)
+		}
+	}
+
+	otherPK := pk
+	otherPK[HashLen] ^= 0x01
+	if err := Verify(testParams, otherPK, msg, &sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong parameter: %v", err)
+	}
+	if err := Verify(Params{TreeHeight: 4}, pk, msg, &sig); err == nil {
+		t.Error("wrong tree height should fail")
+	}
+}
+
+func TestParseSignatureLeafRange(t *testing.T) {
+	var sig types.Bytes3116
+	sig[0] = 8 // lifetime of height 3 is 8 leaves
+	if _, err := ParseSignature(testParams, &sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected leaf out of range, got %v", err)
+	}
+	if _, err := ParseSignature(Params{TreeHeight: MaxTreeHeight + 1}, &sig); err == nil {
+		t.Error("expected error for oversized tree")
+	}
+}
+
+func TestSignatureBytesRoundTrip(t *testing.T) {
+	k := testKey(t)
+	sig := k.sign(3, types.Root{7})
+	parsed, err := ParseSignature(testParams, &sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Leaf != 3 || parsed.Bytes() != sig {
+		t.Error("signature round trip")
+	}
+}
+
+// Regression vectors for the fixed test key, produced by this package. They
+// pin the SHA-256 instantiation and the signature layout against accidental
+// changes; they say nothing about compatibility with other clients.
+func TestRegressionVectors(t *testing.T) {
+	k := testKey(t)
+	pk := k.PublicKey()
+	if got := hex.EncodeToString(pk[:]); got != knownPublicKey {
+		t.Errorf("public key:\n got %s\nwant %s", got, knownPublicKey)
+	}
+	sig := k.sign(6, types.Root{0xde, 0xad})
+	digest := sha256.Sum256(sig[:])
+	if got := hex.EncodeToString(digest[:]); got != knownSignatureDigest {
+		t.Errorf("signature digest:\n got %s\nwant %s", got, knownSignatureDigest)
+	}
+}
+
+const (
+	knownPublicKey       = "871a0ee109bab650936d80424f949d7fce276f1dfe8a0b27191873633ded3df7a0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3"
+	knownSignatureDigest = "d4e21af1a7f2a5dd02cb83dc8621254e5725f8b5b90ca842ed45db461211a0e3"
+)
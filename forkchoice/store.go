@@ -0,0 +1,220 @@
+// Package forkchoice implements the LMD-GHOST fork choice store.
+package forkchoice
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// Node is a block known to fork choice.
+type Node struct {
+	Root       types.Root
+	ParentRoot types.Root
+	Slot       types.Slot
+}
+
+// Store tracks the block tree, justification/finalization and the latest
+// vote of every validator.
+type Store struct {
+	mu        sync.RWMutex
+	nodes     map[types.Root]*Node
+	children  map[types.Root][]types.Root
+	votes     map[types.ValidatorIndex]types.Checkpoint
+	justified types.Checkpoint
+	finalized types.Checkpoint
+}
+
+// NewStore creates a store anchored at the given block. The anchor is both
+// the justified and finalized checkpoint.
+func NewStore(anchor types.Checkpoint, parentRoot types.Root) *Store {
+	s := &Store{
+		nodes:     make(map[types.Root]*Node),
+		children:  make(map[types.Root][]types.Root),
+		votes:     make(map[types.ValidatorIndex]types.Checkpoint),
+		justified: anchor,
+		finalized: anchor,
+	}
+	s.nodes[anchor.Root] = &Node{Root: anchor.Root, ParentRoot: parentRoot, Slot: anchor.Slot}
+	return s
+}
+
+// AddBlock inserts a block whose parent is already known.
+func (s *Store) AddBlock(root, parentRoot types.Root, slot types.Slot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.nodes[root]; ok {
+		return nil
+	}
+	parent, ok := s.nodes[parentRoot]
+	if !ok {
+		return fmt.Errorf("unknown parent %x", parentRoot[:4])
+	}
+	if slot <= parent.Slot {
+		return fmt.Errorf("block slot %d not after parent slot %d", slot, parent.Slot)
+	}
+	s.nodes[root] = &Node{Root: root, ParentRoot: parentRoot, Slot: slot}
+	s.children[parentRoot] = append(s.children[parentRoot], root)
+	return nil
+}
+
+func (s *Store) HasBlock(root types.Root) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.nodes[root]
+	return ok
+}
+
+func (s *Store) Node(root types.Root) (Node, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n, ok := s.nodes[root]
+	if !ok {
+		return Node{}, false
+	}
+	return *n, true
+}
+
+// Len returns the number of blocks in the tree.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.nodes)
+}
+
+func (s *Store) Justified() types.Checkpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.justified
+}
+
+func (s *Store) Finalized() types.Checkpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.finalized
+}
+
+// UpdateCheckpoints advances justified and finalized checkpoints. Checkpoints
+// that do not move forward are ignored.
+func (s *Store) UpdateCheckpoints(justified, finalized types.Checkpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if justified.Slot > s.justified.Slot {
+		s.justified = justified
+	}
+	if finalized.Slot > s.finalized.Slot {
+		s.finalized = finalized
+	}
+}
+
+// ProcessAttestation records a validator's head vote, keeping only the
+// latest one.
+func (s *Store) ProcessAttestation(validator types.ValidatorIndex, head types.Checkpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, ok := s.votes[validator]; ok && prev.Slot >= head.Slot {
+		return
+	}
+	s.votes[validator] = head
+}
+
+// Head runs LMD-GHOST from the justified checkpoint. Ties are broken by the
+// lexicographically highest root.
+func (s *Store) Head() types.Root {
+	return s.ghost(0)
+}
+
+// SafeTarget runs LMD-GHOST from the justified checkpoint, only descending
+// into blocks with at least minVotes votes. Validators pick attestation
+// targets no newer than it.
+func (s *Store) SafeTarget(minVotes uint64) types.Root {
+	return s.ghost(minVotes)
+}
+
+func (s *Store) ghost(minVotes uint64) types.Root {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	weights := make(map[types.Root]uint64)
+	for _, vote := range s.votes {
+		node, ok := s.nodes[vote.Root]
+		for ok {
+			weights[node.Root]++
+			node, ok = s.nodes[node.ParentRoot]
+		}
+	}
+
+	head := s.justified.Root
+	if _, ok := s.nodes[head]; !ok {
+		head = s.finalized.Root
+	}
+	for {
+		var best types.Root
+		found := false
+		for _, c := range s.children[head] {
+			if weights[c] < minVotes {
+				continue
+			}
+			if !found || weights[c] > weights[best] || (weights[c] == weights[best] && bytes.Compare(c[:], best[:]) > 0) {
+				best, found = c, true
+			}
+		}
+		if !found {
+			return head
+		}
+		head = best
+	}
+}
+
+// IsDescendant reports whether root is ancestor or one of its descendants.
+func (s *Store) IsDescendant(ancestor, root types.Root) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.isDescendant(ancestor, root)
+}
+
+func (s *Store) isDescendant(ancestor, root types.Root) bool {
+	anc, ok := s.nodes[ancestor]
+	if !ok {
+		return false
+	}
+	node, ok := s.nodes[root]
+	for ok && node.Slot >= anc.Slot {
+		if node.Root == ancestor {
+			return true
+		}
+		node, ok = s.nodes[node.ParentRoot]
+	}
+	return false
+}
+
+// Prune removes every node that does not descend from the finalized root,
+// which becomes the new tree root. It returns the removed roots.
+func (s *Store) Prune(finalizedRoot types.Root) ([]types.Root, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.nodes[finalizedRoot]; !ok {
+		return nil, fmt.Errorf("unknown finalized root %x", finalizedRoot[:4])
+	}
+
+	var removed []types.Root
+	for root := range s.nodes {
+		if !s.isDescendant(finalizedRoot, root) {
+			removed = append(removed, root)
+		}
+	}
+	for _, root := range removed {
+		delete(s.nodes, root)
+		delete(s.children, root)
+	}
+	for v, vote := range s.votes {
+		if _, ok := s.nodes[vote.Root]; !ok {
+			delete(s.votes, v)
+		}
+	}
+	return removed, nil
+}
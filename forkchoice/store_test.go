@@ -0,0 +1,110 @@
+package forkchoice
+
+import (
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// buildTree creates genesis(0) -> a(1) -> b(2) and a fork genesis -> c(2).
+func buildTree(t *testing.T) *Store {
+	t.Helper()
+	s := NewStore(types.Checkpoint{Root: types.Root{0xff}, Slot: 0}, types.Root{})
+	for _, b := range []struct {
+		root, parent types.Root
+		slot         types.Slot
+	}{
+		{types.Root{1}, types.Root{0xff}, 1},
+		{types.Root{2}, types.Root{1}, 2},
+		{types.Root{3}, types.Root{0xff}, 2},
+	} {
+		if err := s.AddBlock(b.root, b.parent, b.slot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestAddBlockUnknownParent(t *testing.T) {
+	s := buildTree(t)
+	if err := s.AddBlock(types.Root{9}, types.Root{8}, 5); err == nil {
+		t.Error("expected error for unknown parent")
+	}
+	if err := s.AddBlock(types.Root{9}, types.Root{2}, 2); err == nil {
+		t.Error("expected error for slot not after parent")
+	}
+}
+
+func TestHeadFollowsVotes(t *testing.T) {
+	s := buildTree(t)
+
+	// No votes: tie broken by highest root.
+	if s.Head() != (types.Root{3}) {
+		t.Errorf("expected fork tip 3, got %x", s.Head())
+	}
+
+	s.ProcessAttestation(0, types.Checkpoint{Root: types.Root{2}, Slot: 2})
+	s.ProcessAttestation(1, types.Checkpoint{Root: types.Root{2}, Slot: 2})
+	s.ProcessAttestation(2, types.Checkpoint{Root: types.Root{3}, Slot: 2})
+	if s.Head() != (types.Root{2}) {
+		t.Errorf("expected head 2, got %x", s.Head())
+	}
+
+	// Older votes do not replace newer ones.
+	s.ProcessAttestation(0, types.Checkpoint{Root: types.Root{3}, Slot: 1})
+	if s.Head() != (types.Root{2}) {
+		t.Errorf("stale vote changed head to %x", s.Head())
+	}
+}
+
+func TestSafeTarget(t *testing.T) {
+	s := buildTree(t)
+	if s.SafeTarget(1) != (types.Root{0xff}) {
+		t.Error("without votes the safe target is the justified root")
+	}
+
+	s.ProcessAttestation(0, types.Checkpoint{Root: types.Root{2}, Slot: 2})
+	s.ProcessAttestation(1, types.Checkpoint{Root: types.Root{1}, Slot: 1})
+	s.ProcessAttestation(2, types.Checkpoint{Root: types.Root{3}, Slot: 2})
+	if got := s.SafeTarget(2); got != (types.Root{1}) {
+		t.Errorf("expected safe target 1, got %x", got)
+	}
+	if got := s.SafeTarget(3); got != (types.Root{0xff}) {
+		t.Errorf("expected safe target at the justified root, got %x", got)
+	}
+}
+
+func TestIsDescendant(t *testing.T) {
+	s := buildTree(t)
+	if !s.IsDescendant(types.Root{1}, types.Root{2}) {
+		t.Error("2 descends from 1")
+	}
+	if s.IsDescendant(types.Root{1}, types.Root{3}) {
+		t.Error("3 does not descend from 1")
+	}
+	if !s.IsDescendant(types.Root{2}, types.Root{2}) {
+		t.Error("a block descends from itself")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s := buildTree(t)
+	s.ProcessAttestation(0, types.Checkpoint{Root: types.Root{3}, Slot: 2})
+
+	removed, err := s.Prune(types.Root{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("expected 2 removed nodes, got %d", len(removed))
+	}
+	if s.HasBlock(types.Root{3}) || s.HasBlock(types.Root{0xff}) {
+		t.Error("fork and old root should be pruned")
+	}
+	if s.Len() != 2 {
+		t.Errorf("expected 2 nodes, got %d", s.Len())
+	}
+	if _, err := s.Prune(types.Root{3}); err == nil {
+		t.Error("expected error pruning to unknown root")
+	}
+}
@@ -0,0 +1,138 @@
+// Package codec implements the ssz_snappy wire encoding shared by gossip
+// and req/resp.
+//
+// Gossip payloads are SSZ compressed with the snappy block format. Stream
+// payloads are the uncompressed SSZ length as a varint followed by the SSZ
+// bytes in the snappy framing format. In both cases the declared length is
+// checked against a limit before anything is decompressed.
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/devlongs/gean/common/snappy"
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+)
+
+// MaxBlockSize bounds an uncompressed SignedBlockWithAttestation.
+const MaxBlockSize = 16 * 1024 * 1024
+
+var ErrTooLarge = errors.New("codec: payload exceeds size limit")
+
+// Reader is what ReadPayload needs: the varint prefix is read byte by byte
+// so nothing past the payload is consumed.
+type Reader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// Compress encodes a gossip payload.
+func Compress(payload []byte) []byte {
+	return snappy.Encode(payload)
+}
+
+// MaxCompressedLen bounds the gossip encoding of an n byte payload.
+func MaxCompressedLen(n int) int {
+	return snappy.MaxEncodedLen(n)
+}
+
+// Decompress decodes a gossip payload of at most maxSize bytes.
+func Decompress(data []byte, maxSize int) ([]byte, error) {
+	payload, err := snappy.Decode(data, maxSize)
+	if err == snappy.ErrTooLarge {
+		err = ErrTooLarge
+	}
+	return payload, err
+}
+
+// WritePayload writes a stream payload. An empty payload is just the zero
+// length.
+func WritePayload(w io.Writer, payload []byte) error {
+	if _, err := w.Write(binary.AppendUvarint(nil, uint64(len(payload)))); err != nil {
+		return err
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	_, err := snappy.NewWriter(w).Write(payload)
+	return err
+}
+
+// ReadPayload reads a stream payload of at most maxSize bytes.
+func ReadPayload(r Reader, maxSize int) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(maxSize) {
+		return nil, ErrTooLarge
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(snappy.NewReader(r), payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+func EncodeBlock(b *types.SignedBlockWithAttestation) []byte {
+	return Compress(ssz.MarshalSignedBlockWithAttestation(b))
+}
+
+func DecodeBlock(data []byte) (*types.SignedBlockWithAttestation, error) {
+	payload, err := Decompress(data, MaxBlockSize)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalBlock(payload)
+}
+
+func WriteBlock(w io.Writer, b *types.SignedBlockWithAttestation) error {
+	return WritePayload(w, ssz.MarshalSignedBlockWithAttestation(b))
+}
+
+func ReadBlock(r Reader) (*types.SignedBlockWithAttestation, error) {
+	payload, err := ReadPayload(r, MaxBlockSize)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalBlock(payload)
+}
+
+func EncodeAttestation(a *types.SignedAttestation) []byte {
+	return Compress(ssz.MarshalSignedAttestation(a))
+}
+
+func DecodeAttestation(data []byte) (*types.SignedAttestation, error) {
+	payload, err := Decompress(data, ssz.SignedAttestationSize)
+	if err != nil {
+		return nil, err
+	}
+	return ssz.UnmarshalSignedAttestation(payload)
+}
+
+func WriteAttestation(w io.Writer, a *types.SignedAttestation) error {
+	return WritePayload(w, ssz.MarshalSignedAttestation(a))
+}
+
+func ReadAttestation(r Reader) (*types.SignedAttestation, error) {
+	payload, err := ReadPayload(r, ssz.SignedAttestationSize)
+	if err != nil {
+		return nil, err
+	}
+	return ssz.UnmarshalSignedAttestation(payload)
+}
+
+func unmarshalBlock(payload []byte) (*types.SignedBlockWithAttestation, error) {
+	b, err := ssz.UnmarshalSignedBlockWithAttestation(payload, types.AttestationsLimit, types.ValidatorRegistryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("decode block: %w", err)
+	}
+	return b, nil
+}
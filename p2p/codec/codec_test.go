@@ -0,0 +1,101 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/devlongs/gean/common/snappy"
+	"github.com/devlongs/gean/common/types"
+)
+
+func testBlock() *types.SignedBlockWithAttestation {
+	return &types.SignedBlockWithAttestation{
+		Message: types.BlockWithAttestation{
+			Block: types.Block{Slot: 7, ProposerIndex: 2, ParentRoot: types.Root{1}},
+		},
+		Signatures: []types.Bytes3116{{1}, {2}},
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	b := testBlock()
+
+	got, err := DecodeBlock(EncodeBlock(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Message.Block.Slot != 7 || len(got.Signatures) != 2 || got.Signatures[1] != b.Signatures[1] {
+		t.Error("gossip round trip mismatch")
+	}
+
+	var buf bytes.Buffer
+	WriteBlock(&buf, b)
+	WriteBlock(&buf, b)
+	r := bufio.NewReader(&buf)
+	for i := 0; i < 2; i++ {
+		got, err := ReadBlock(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Message.Block.ProposerIndex != 2 {
+			t.Error("stream round trip mismatch")
+		}
+	}
+	if _, err := ReadBlock(r); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestAttestationRoundTrip(t *testing.T) {
+	a := &types.SignedAttestation{ValidatorID: 3}
+	got, err := DecodeAttestation(EncodeAttestation(a))
+	if err != nil || got.ValidatorID != 3 {
+		t.Errorf("gossip round trip: %+v, %v", got, err)
+	}
+
+	var buf bytes.Buffer
+	WriteAttestation(&buf, a)
+	got, err = ReadAttestation(bufio.NewReader(&buf))
+	if err != nil || got.ValidatorID != 3 {
+		t.Errorf("stream round trip: %+v, %v", got, err)
+	}
+}
+
+func TestSizeLimitBeforeDecompression(t *testing.T) {
+	// A 1MB run of zeros compresses to a few KB.
+	bomb := snappy.Encode(make([]byte, 1<<20))
+	if _, err := DecodeAttestation(bomb); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+
+	// Only the length prefix is present, so the limit must trip first.
+	prefix := binary.AppendUvarint(nil, MaxBlockSize+1)
+	if _, err := ReadBlock(bytes.NewReader(prefix)); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestEmptyPayload(t *testing.T) {
+	var buf bytes.Buffer
+	WritePayload(&buf, nil)
+	WritePayload(&buf, []byte("next"))
+	r := bufio.NewReader(&buf)
+	if got, err := ReadPayload(r, 16); err != nil || len(got) != 0 {
+		t.Errorf("empty payload: %q, %v", got, err)
+	}
+	if got, err := ReadPayload(r, 16); err != nil || string(got) != "next" {
+		t.Errorf("following payload: %q, %v", got, err)
+	}
+}
+
+func TestReadPayloadTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	WritePayload(&buf, []byte("some payload"))
+	data := buf.Bytes()[:buf.Len()-3]
+	if _, err := ReadPayload(bytes.NewReader(data), 100); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+}
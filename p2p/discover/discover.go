@@ -0,0 +1,508 @@
+// Package discover implements discv5-style peer discovery: signed node
+// records, a Kademlia routing table and PING/PONG/FINDNODE/NODES over UDP.
+//
+// Packets are individually signed with the node's ed25519 key rather than
+// using discv5 sessions and handshakes.
+package discover
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTimeout = errors.New("discover: request timed out")
+	ErrClosed  = errors.New("discover: closed")
+)
+
+// alpha is the lookup concurrency.
+const alpha = 3
+
+// bondExpiry is how long a PING/PONG round-trip proves an endpoint. FINDNODE
+// is only answered for proven endpoints, so that a spoofed source address
+// cannot turn us into a traffic amplifier.
+const bondExpiry = 12 * time.Hour
+
+type Config struct {
+	PrivateKey ed25519.PrivateKey
+	// IP is the address advertised in our record. It defaults to the
+	// listening address, or loopback if that is unspecified.
+	IP net.IP
+	// TCPPort is the host port advertised in our record.
+	TCPPort uint16
+	// Bootnodes are contacted on start to join the network.
+	Bootnodes []*Record
+
+	RequestTimeout  time.Duration
+	RefreshInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		RequestTimeout:  500 * time.Millisecond,
+		RefreshInterval: 30 * time.Second,
+	}
+}
+
+type pendingRequest struct {
+	from NodeID
+	addr string
+	kind byte
+	ch   chan *packet
+}
+
+// bond records an endpoint that answered our PING.
+type bond struct {
+	addr string
+	at   time.Time
+}
+
+// Discovery runs the protocol on a UDP socket.
+type Discovery struct {
+	cfg  Config
+	conn *net.UDPConn
+	key  ed25519.PrivateKey
+	self *Record
+	tab  *Table
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]*pendingRequest
+
+	// verified holds the endpoints that answered our PING; we answer their
+	// FINDNODE. pingedBy holds when nodes last pinged us, after which they
+	// answer ours. pingWait is closed when the node pings us.
+	verified map[NodeID]bond
+	pingedBy map[NodeID]time.Time
+	pingWait map[NodeID]chan struct{}
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Listen starts discovery on conn. It contacts the bootnodes and then
+// refreshes the table in the background until Close.
+func Listen(conn *net.UDPConn, cfg Config) *Discovery {
+	laddr := conn.LocalAddr().(*net.UDPAddr)
+	ip := cfg.IP
+	if ip == nil {
+		ip = laddr.IP
+		if ip.IsUnspecified() {
+			ip = net.IPv4(127, 0, 0, 1)
+		}
+	}
+	self := NewRecord(cfg.PrivateKey, 1, ip, uint16(laddr.Port), cfg.TCPPort)
+
+	d := &Discovery{
+		cfg:      cfg,
+		conn:     conn,
+		key:      cfg.PrivateKey,
+		self:     self,
+		tab:      NewTable(self.ID()),
+		pending:  make(map[uint64]*pendingRequest),
+		verified: make(map[NodeID]bond),
+		pingedBy: make(map[NodeID]time.Time),
+		pingWait: make(map[NodeID]chan struct{}),
+		closing:  make(chan struct{}),
+	}
+	d.wg.Add(2)
+	go d.readLoop()
+	go d.refreshLoop()
+	return d
+}
+
+// Self returns our signed record.
+func (d *Discovery) Self() *Record { return d.self }
+
+// Nodes returns every node in the routing table.
+func (d *Discovery) Nodes() []*Record { return d.tab.Nodes() }
+
+func (d *Discovery) Close() error {
+	select {
+	case <-d.closing:
+		return nil
+	default:
+	}
+	close(d.closing)
+	err := d.conn.Close()
+	d.wg.Wait()
+	return err
+}
+
+func (d *Discovery) refreshLoop() {
+	defer d.wg.Done()
+	for _, r := range d.cfg.Bootnodes {
+		d.Ping(r)
+	}
+	d.Lookup(d.self.ID())
+
+	ticker := time.NewTicker(d.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.expireBonds()
+			var target NodeID
+			rand.Read(target[:])
+			d.Lookup(target)
+		case <-d.closing:
+			return
+		}
+	}
+}
+
+// Ping checks that r is alive and adds its current record to the table.
+// The answer proves r's endpoint, so its FINDNODE requests are served.
+func (d *Discovery) Ping(r *Record) error {
+	replies, err := d.request(r, kindPing, d.self.Marshal(), kindPong, func([]*packet) bool { return true })
+	if err != nil {
+		return err
+	}
+	rec, err := ParseRecord(replies[0].body)
+	if err != nil || rec.ID() != r.ID() {
+		return errBadPacket
+	}
+	d.addNode(rec)
+	return nil
+}
+
+// isVerified reports whether id recently answered our PING from addr.
+func (d *Discovery) isVerified(id NodeID, addr *net.UDPAddr) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b, ok := d.verified[id]
+	return ok && b.addr == addr.String() && time.Since(b.at) < bondExpiry
+}
+
+// ensureBond makes sure r has proven our endpoint before we send it a
+// FINDNODE: unless r pinged us recently, we ping it, which makes it ping
+// us back, and wait for that ping.
+func (d *Discovery) ensureBond(r *Record) error {
+	id := r.ID()
+	d.mu.Lock()
+	if at, ok := d.pingedBy[id]; ok && time.Since(at) < bondExpiry {
+		d.mu.Unlock()
+		return nil
+	}
+	wait, ok := d.pingWait[id]
+	if !ok {
+		wait = make(chan struct{})
+		d.pingWait[id] = wait
+	}
+	d.mu.Unlock()
+
+	err := d.Ping(r)
+	if err == nil {
+		// r may already know our endpoint and not ping back.
+		timeout := time.NewTimer(d.cfg.RequestTimeout)
+		defer timeout.Stop()
+		select {
+		case <-wait:
+		case <-timeout.C:
+		case <-d.closing:
+			err = ErrClosed
+		}
+	}
+	d.mu.Lock()
+	if d.pingWait[id] == wait {
+		delete(d.pingWait, id)
+	}
+	d.mu.Unlock()
+	return err
+}
+
+// expireBonds forgets endpoint proofs older than bondExpiry.
+func (d *Discovery) expireBonds() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, b := range d.verified {
+		if time.Since(b.at) >= bondExpiry {
+			delete(d.verified, id)
+		}
+	}
+	for id, at := range d.pingedBy {
+		if time.Since(at) >= bondExpiry {
+			delete(d.pingedBy, id)
+		}
+	}
+}
+
+// FindNode asks r for the nodes at the given log distances from r, after
+// proving our endpoint to it if needed. A response cut short by the timeout
+// returns what arrived.
+func (d *Discovery) FindNode(r *Record, distances []int) ([]*Record, error) {
+	if err := d.ensureBond(r); err != nil {
+		return nil, err
+	}
+	replies, err := d.request(r, kindFindNode, encodeDistances(distances), kindNodes, func(replies []*packet) bool {
+		total, _, err := decodeNodes(replies[0].body)
+		return err != nil || len(replies) >= min(total, maxNodesResponse/maxNodesPerPacket)
+	})
+	if len(replies) == 0 {
+		return nil, err
+	}
+
+	want := make(map[int]bool, len(distances))
+	for _, dist := range distances {
+		want[dist] = true
+	}
+	var nodes []*Record
+	for _, p := range replies {
+		_, records, err := decodeNodes(p.body)
+		if err != nil {
+			continue
+		}
+		for _, rec := range records {
+			// Only accept what was asked for.
+			if want[LogDistance(r.ID(), rec.ID())] && len(nodes) < maxNodesResponse {
+				nodes = append(nodes, rec)
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// Lookup finds the nodes closest to target with an iterative Kademlia
+// search, querying alpha nodes at a time. Nodes that answer are added to
+// the table.
+func (d *Discovery) Lookup(target NodeID) []*Record {
+	seen := map[NodeID]bool{d.self.ID(): true}
+	asked := make(map[NodeID]bool)
+	var result []*Record
+	for _, n := range d.tab.Closest(target, bucketSize) {
+		seen[n.ID()] = true
+		result = append(result, n)
+	}
+
+	for {
+		var batch []*Record
+		for _, n := range result {
+			if !asked[n.ID()] {
+				asked[n.ID()] = true
+				batch = append(batch, n)
+				if len(batch) == alpha {
+					break
+				}
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		found := make([][]*Record, len(batch))
+		var wg sync.WaitGroup
+		for i, n := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Unresponsive nodes stay in the table; they are only
+				// evicted when a replacement shows up in addNode.
+				nodes, err := d.FindNode(n, lookupDistances(target, n.ID()))
+				if err != nil {
+					return
+				}
+				d.addNode(n)
+				found[i] = nodes
+			}()
+		}
+		wg.Wait()
+
+		for _, nodes := range found {
+			for _, n := range nodes {
+				if !seen[n.ID()] {
+					seen[n.ID()] = true
+					result = append(result, n)
+				}
+			}
+		}
+		sortByDistance(target, result)
+		if len(result) > bucketSize {
+			result = result[:bucketSize]
+		}
+	}
+
+	// Only return nodes that were reached.
+	var live []*Record
+	for _, n := range result {
+		if d.tab.Get(n.ID()) != nil {
+			live = append(live, n)
+		}
+	}
+	return live
+}
+
+// lookupDistances asks for the bucket target falls in and its neighbours.
+func lookupDistances(target, dest NodeID) []int {
+	d := LogDistance(target, dest)
+	distances := []int{d}
+	if d < numBuckets {
+		distances = append(distances, d+1)
+	}
+	if d > 1 {
+		distances = append(distances, d-1)
+	}
+	return distances
+}
+
+// addNode adds r to the table. If its bucket is full, the least recently
+// seen node is pinged and replaced by r if it does not answer.
+func (d *Discovery) addNode(r *Record) {
+	added, oldest := d.tab.Add(r)
+	if added || oldest == nil {
+		return
+	}
+	go func() {
+		if d.Ping(oldest) != nil {
+			d.tab.Remove(oldest.ID())
+			d.tab.Add(r)
+		}
+	}()
+}
+
+// request sends a request to r and collects replies of replyKind until done
+// returns true or the request times out.
+func (d *Discovery) request(r *Record, kind byte, body []byte, replyKind byte, done func([]*packet) bool) ([]*packet, error) {
+	req := &pendingRequest{from: r.ID(), addr: r.UDPAddr().String(), kind: replyKind, ch: make(chan *packet, 4)}
+	d.mu.Lock()
+	d.nextID++
+	id := d.nextID
+	d.pending[id] = req
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+	}()
+
+	if err := d.send(r.ID(), r.UDPAddr(), kind, id, body); err != nil {
+		return nil, err
+	}
+
+	timeout := time.NewTimer(d.cfg.RequestTimeout)
+	defer timeout.Stop()
+	var replies []*packet
+	for {
+		select {
+		case p := <-req.ch:
+			replies = append(replies, p)
+			if done(replies) {
+				return replies, nil
+			}
+		case <-timeout.C:
+			return replies, ErrTimeout
+		case <-d.closing:
+			return replies, ErrClosed
+		}
+	}
+}
+
+func (d *Discovery) send(to NodeID, addr *net.UDPAddr, kind byte, reqID uint64, body []byte) error {
+	_, err := d.conn.WriteToUDP(encodePacket(d.key, to, kind, reqID, body), addr)
+	return err
+}
+
+func (d *Discovery) readLoop() {
+	defer d.wg.Done()
+	buf := make([]byte, maxPacketSize+1)
+	for {
+		n, from, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-d.closing:
+				return
+			default:
+				continue
+			}
+		}
+		p, err := decodePacket(d.self.ID(), buf[:n])
+		if err != nil {
+			continue
+		}
+		switch p.kind {
+		case kindPing:
+			d.handlePing(p, from)
+		case kindFindNode:
+			d.handleFindNode(p, from)
+		case kindPong, kindNodes:
+			d.deliver(p, from)
+		}
+	}
+}
+
+// deliver hands a reply to its request. Replies must come from the address
+// the request was sent to. A PONG proves the endpoint right away, before a
+// FINDNODE sent just after it is read.
+func (d *Discovery) deliver(p *packet, from *net.UDPAddr) {
+	d.mu.Lock()
+	req, ok := d.pending[p.reqID]
+	ok = ok && req.from == p.from && req.addr == from.String() && req.kind == p.kind
+	if ok && p.kind == kindPong {
+		d.verified[p.from] = bond{addr: req.addr, at: time.Now()}
+	}
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case req.ch <- p:
+	default:
+	}
+}
+
+// handlePing answers with a PONG. A sender whose endpoint we have not
+// proven yet is pinged back, and only added to the table once it answers.
+func (d *Discovery) handlePing(p *packet, from *net.UDPAddr) {
+	d.send(p.from, from, kindPong, p.reqID, d.self.Marshal())
+
+	d.mu.Lock()
+	d.pingedBy[p.from] = time.Now()
+	if wait, ok := d.pingWait[p.from]; ok {
+		close(wait)
+		delete(d.pingWait, p.from)
+	}
+	d.mu.Unlock()
+
+	// Only trust the sender's record if it matches where the packet came
+	// from.
+	rec, err := ParseRecord(p.body)
+	if err != nil || rec.ID() != p.from || !rec.IP.Equal(from.IP) || int(rec.UDP) != from.Port {
+		return
+	}
+	if d.isVerified(p.from, from) {
+		d.addNode(rec)
+		return
+	}
+	go d.Ping(rec)
+}
+
+// handleFindNode answers FINDNODE from proven endpoints only.
+func (d *Discovery) handleFindNode(p *packet, from *net.UDPAddr) {
+	if !d.isVerified(p.from, from) {
+		return
+	}
+	distances, err := decodeDistances(p.body)
+	if err != nil {
+		return
+	}
+	var nodes []*Record
+	for _, dist := range distances {
+		if dist == 0 {
+			nodes = append(nodes, d.self)
+		} else {
+			nodes = append(nodes, d.tab.AtDistance(dist)...)
+		}
+	}
+	if len(nodes) > maxNodesResponse {
+		nodes = nodes[:maxNodesResponse]
+	}
+
+	total := max((len(nodes)+maxNodesPerPacket-1)/maxNodesPerPacket, 1)
+	for i := 0; i < total; i++ {
+		chunk := nodes[min(i*maxNodesPerPacket, len(nodes)):min((i+1)*maxNodesPerPacket, len(nodes))]
+		d.send(p.from, from, kindNodes, p.reqID, encodeNodes(total, chunk))
+	}
+}
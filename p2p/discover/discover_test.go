@@ -0,0 +1,148 @@
+package discover
+
+import (
+	"crypto/ed25519"
+	"net"
+	"testing"
+	"time"
+)
+
+func testKey(seed byte) ed25519.PrivateKey {
+	s := make([]byte, ed25519.SeedSize)
+	s[0] = seed
+	return ed25519.NewKeyFromSeed(s)
+}
+
+func startNode(t *testing.T, key ed25519.PrivateKey, bootnodes []*Record) *Discovery {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.PrivateKey = key
+	cfg.TCPPort = 9000
+	cfg.Bootnodes = bootnodes
+	cfg.RequestTimeout = 200 * time.Millisecond
+	cfg.RefreshInterval = time.Minute
+	d := Listen(conn, cfg)
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestPingAndFindNode(t *testing.T) {
+	a := startNode(t, testKey(1), nil)
+	b := startNode(t, testKey(2), nil)
+
+	if err := a.Ping(b.Self()); err != nil {
+		t.Fatal(err)
+	}
+	if a.tab.Get(b.Self().ID()) == nil {
+		t.Error("pinged node not added")
+	}
+	// b learned a from the ping.
+	deadline := time.Now().Add(time.Second)
+	for b.tab.Get(a.Self().ID()) == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if b.tab.Get(a.Self().ID()) == nil {
+		t.Fatal("pinging node not added")
+	}
+
+	dist := LogDistance(b.Self().ID(), a.Self().ID())
+	nodes, err := a.FindNode(b.Self(), []int{0, dist})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("expected self and a, got %d nodes", len(nodes))
+	}
+
+	// Nodes at unrequested distances are filtered out.
+	other := dist%numBuckets + 1
+	if nodes, _ := a.FindNode(b.Self(), []int{other}); len(nodes) != 0 {
+		t.Errorf("expected no nodes at distance %d, got %d", other, len(nodes))
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	a := startNode(t, testKey(1), nil)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	silent := NewRecord(testKey(2), 1, net.IPv4(127, 0, 0, 1), uint16(conn.LocalAddr().(*net.UDPAddr).Port), 0)
+	if err := a.Ping(silent); err != ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+}
+
+func TestLocalNetworkDiscovery(t *testing.T) {
+	const n = 10
+	boot := startNode(t, testKey(100), nil)
+	nodes := []*Discovery{boot}
+	for i := 1; i < n; i++ {
+		nodes = append(nodes, startNode(t, testKey(byte(i)), []*Record{boot.Self()}))
+	}
+
+	// Every node must be able to find every other node through the
+	// bootnode alone.
+	deadline := time.Now().Add(10 * time.Second)
+	for _, d := range nodes {
+		for _, target := range nodes {
+			if d == target {
+				continue
+			}
+			for {
+				found := d.Lookup(target.Self().ID())
+				if len(found) > 0 && found[0].ID() == target.Self().ID() {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("node %s cannot find %s (table %d, found %d)", d.Self().ID().String()[:8], target.Self().ID().String()[:8], d.tab.Len(), len(found))
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+	}
+	for _, d := range nodes {
+		if d.tab.Len() < 3 {
+			t.Errorf("node %s only knows %d nodes", d.Self().ID().String()[:8], d.tab.Len())
+		}
+	}
+}
+
+func TestFindNodeRequiresBond(t *testing.T) {
+	a := startNode(t, testKey(1), nil)
+	b := startNode(t, testKey(2), nil)
+	findSelf := func() int {
+		replies, _ := b.request(a.Self(), kindFindNode, encodeDistances([]int{0}), kindNodes, func([]*packet) bool { return true })
+		return len(replies)
+	}
+
+	// b has not answered a PING from a, so a ignores it.
+	if n := findSelf(); n != 0 {
+		t.Fatalf("unbonded FINDNODE answered with %d packets", n)
+	}
+	if err := a.Ping(b.Self()); err != nil {
+		t.Fatal(err)
+	}
+	if n := findSelf(); n != 1 {
+		t.Fatalf("bonded FINDNODE answered with %d packets", n)
+	}
+
+	// The same node from another address is not answered.
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.WriteToUDP(encodePacket(testKey(2), a.Self().ID(), kindFindNode, 1, encodeDistances([]int{0})), a.Self().UDPAddr()); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, _, err := conn.ReadFromUDP(make([]byte, maxPacketSize)); err == nil {
+		t.Errorf("FINDNODE from a spoofed address answered with %d bytes", n)
+	}
+}
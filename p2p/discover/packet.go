@@ -0,0 +1,132 @@
+package discover
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+)
+
+// Packets are signed by the sender over the recipient's node ID, so a
+// captured packet cannot be replayed to another node:
+//
+//	pubkey (32) | signature (64) | kind (1) | request id (8) | body
+//
+// The signature covers recipient ID | kind | request id | body.
+const (
+	kindPing byte = iota + 1
+	kindPong
+	kindFindNode
+	kindNodes
+)
+
+const (
+	maxPacketSize = 1280
+	headerSize    = ed25519.PublicKeySize + ed25519.SignatureSize + 1 + 8
+
+	// maxNodesPerPacket keeps NODES packets under maxPacketSize even for
+	// IPv6 records.
+	maxNodesPerPacket = 8
+	// maxNodesResponse bounds the records returned for one FINDNODE.
+	maxNodesResponse = bucketSize
+	// maxDistances bounds the distances asked for in one FINDNODE.
+	maxDistances = 8
+)
+
+var errBadPacket = errors.New("discover: malformed packet")
+
+type packet struct {
+	from  NodeID
+	kind  byte
+	reqID uint64
+	body  []byte
+}
+
+func encodePacket(key ed25519.PrivateKey, to NodeID, kind byte, reqID uint64, body []byte) []byte {
+	signed := make([]byte, 0, len(to)+1+8+len(body))
+	signed = append(signed, to[:]...)
+	signed = append(signed, kind)
+	signed = binary.BigEndian.AppendUint64(signed, reqID)
+	signed = append(signed, body...)
+
+	buf := make([]byte, 0, headerSize+len(body))
+	buf = append(buf, key.Public().(ed25519.PublicKey)...)
+	buf = append(buf, ed25519.Sign(key, signed)...)
+	return append(buf, signed[len(to):]...)
+}
+
+func decodePacket(self NodeID, data []byte) (*packet, error) {
+	if len(data) < headerSize || len(data) > maxPacketSize {
+		return nil, errBadPacket
+	}
+	pub := ed25519.PublicKey(data[:ed25519.PublicKeySize])
+	sig := data[ed25519.PublicKeySize : ed25519.PublicKeySize+ed25519.SignatureSize]
+	rest := data[ed25519.PublicKeySize+ed25519.SignatureSize:]
+
+	// signed is a copy, so the packet does not alias the read buffer.
+	signed := append(append([]byte(nil), self[:]...), rest...)
+	if !ed25519.Verify(pub, signed, sig) {
+		return nil, errBadPacket
+	}
+	rest = signed[len(self):]
+	return &packet{
+		from:  PubkeyToID(pub),
+		kind:  rest[0],
+		reqID: binary.BigEndian.Uint64(rest[1:]),
+		body:  rest[9:],
+	}, nil
+}
+
+// FINDNODE body: one uint16 per distance.
+func encodeDistances(distances []int) []byte {
+	buf := make([]byte, 0, 2*len(distances))
+	for _, d := range distances {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(d))
+	}
+	return buf
+}
+
+func decodeDistances(body []byte) ([]int, error) {
+	if len(body)%2 != 0 || len(body)/2 > maxDistances {
+		return nil, errBadPacket
+	}
+	distances := make([]int, len(body)/2)
+	for i := range distances {
+		distances[i] = int(binary.BigEndian.Uint16(body[2*i:]))
+	}
+	return distances, nil
+}
+
+// NODES body: total packets in the response (1), then each record prefixed
+// with its uint16 length.
+func encodeNodes(total int, records []*Record) []byte {
+	buf := []byte{byte(total)}
+	for _, r := range records {
+		enc := r.Marshal()
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(enc)))
+		buf = append(buf, enc...)
+	}
+	return buf
+}
+
+func decodeNodes(body []byte) (total int, records []*Record, err error) {
+	if len(body) < 1 {
+		return 0, nil, errBadPacket
+	}
+	total, body = int(body[0]), body[1:]
+	for len(body) > 0 {
+		if len(body) < 2 {
+			return 0, nil, errBadPacket
+		}
+		n := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+n {
+			return 0, nil, errBadPacket
+		}
+		r, err := ParseRecord(body[2 : 2+n])
+		if err != nil {
+			return 0, nil, err
+		}
+		records = append(records, r)
+		body = body[2+n:]
+	}
+	return total, records, nil
+}
@@ -0,0 +1,154 @@
+package discover
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+// NodeID identifies a node: the SHA-256 of its ed25519 public key.
+type NodeID [32]byte
+
+func (id NodeID) String() string { return hex.EncodeToString(id[:]) }
+
+// PeerID is the transport identity of the node, the one proven by
+// transport.NewAuthenticatedTCP.
+func (id NodeID) PeerID() transport.PeerID { return transport.PeerID(id.String()) }
+
+func PubkeyToID(pub ed25519.PublicKey) NodeID {
+	return sha256.Sum256(pub)
+}
+
+var ErrInvalidRecord = errors.New("discover: invalid record")
+
+const (
+	recordPrefix = "enr:"
+	// maxRecordSize is an IPv6 record.
+	maxRecordSize = 8 + ed25519.PublicKeySize + 1 + net.IPv6len + 2 + 2 + ed25519.SignatureSize
+)
+
+// Record is a signed node record, similar to an ENR: it carries the node's
+// public key and where to reach it. A higher Seq replaces an older record.
+type Record struct {
+	Seq       uint64
+	PublicKey ed25519.PublicKey
+	IP        net.IP
+	UDP       uint16
+	TCP       uint16
+	Signature []byte
+}
+
+// NewRecord creates a record signed by key.
+func NewRecord(key ed25519.PrivateKey, seq uint64, ip net.IP, udp, tcp uint16) *Record {
+	r := &Record{
+		Seq:       seq,
+		PublicKey: key.Public().(ed25519.PublicKey),
+		IP:        normalizeIP(ip),
+		UDP:       udp,
+		TCP:       tcp,
+	}
+	r.Signature = ed25519.Sign(key, r.content())
+	return r
+}
+
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+func (r *Record) ID() NodeID { return PubkeyToID(r.PublicKey) }
+
+func (r *Record) PeerID() transport.PeerID { return r.ID().PeerID() }
+
+func (r *Record) UDPAddr() *net.UDPAddr {
+	return &net.UDPAddr{IP: r.IP, Port: int(r.UDP)}
+}
+
+// TCPAddr is the address the node's host listens on.
+func (r *Record) TCPAddr() string {
+	return net.JoinHostPort(r.IP.String(), strconv.Itoa(int(r.TCP)))
+}
+
+// content is the signed part of the encoding:
+// seq | pubkey | ip length | ip | udp | tcp
+func (r *Record) content() []byte {
+	buf := make([]byte, 0, maxRecordSize)
+	buf = binary.BigEndian.AppendUint64(buf, r.Seq)
+	buf = append(buf, r.PublicKey...)
+	buf = append(buf, byte(len(r.IP)))
+	buf = append(buf, r.IP...)
+	buf = binary.BigEndian.AppendUint16(buf, r.UDP)
+	return binary.BigEndian.AppendUint16(buf, r.TCP)
+}
+
+func (r *Record) Verify() error {
+	if len(r.PublicKey) != ed25519.PublicKeySize || (len(r.IP) != net.IPv4len && len(r.IP) != net.IPv6len) {
+		return ErrInvalidRecord
+	}
+	if !ed25519.Verify(r.PublicKey, r.content(), r.Signature) {
+		return fmt.Errorf("%w: bad signature", ErrInvalidRecord)
+	}
+	return nil
+}
+
+// Marshal encodes the record followed by its signature.
+func (r *Record) Marshal() []byte {
+	return append(r.content(), r.Signature...)
+}
+
+// ParseRecord decodes and verifies a record.
+func ParseRecord(data []byte) (*Record, error) {
+	const fixed = 8 + ed25519.PublicKeySize + 1
+	if len(data) < fixed {
+		return nil, ErrInvalidRecord
+	}
+	ipLen := int(data[fixed-1])
+	if ipLen != net.IPv4len && ipLen != net.IPv6len {
+		return nil, ErrInvalidRecord
+	}
+	if len(data) != fixed+ipLen+4+ed25519.SignatureSize {
+		return nil, ErrInvalidRecord
+	}
+	r := &Record{
+		Seq:       binary.BigEndian.Uint64(data),
+		PublicKey: ed25519.PublicKey(append([]byte(nil), data[8:8+ed25519.PublicKeySize]...)),
+		IP:        net.IP(append([]byte(nil), data[fixed:fixed+ipLen]...)),
+	}
+	rest := data[fixed+ipLen:]
+	r.UDP = binary.BigEndian.Uint16(rest)
+	r.TCP = binary.BigEndian.Uint16(rest[2:])
+	r.Signature = append([]byte(nil), rest[4:]...)
+	if err := r.Verify(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// String returns the text form used on the command line: "enr:" followed
+// by the base64url encoding.
+func (r *Record) String() string {
+	return recordPrefix + base64.RawURLEncoding.EncodeToString(r.Marshal())
+}
+
+// ParseENR parses the text form of a record.
+func ParseENR(s string) (*Record, error) {
+	if !strings.HasPrefix(s, recordPrefix) {
+		return nil, fmt.Errorf("%w: missing %q prefix", ErrInvalidRecord, recordPrefix)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s[len(recordPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+	return ParseRecord(data)
+}
@@ -0,0 +1,100 @@
+package discover
+
+import (
+	"net"
+	"testing"
+
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	r := NewRecord(testKey(1), 3, net.ParseIP("127.0.0.1"), 9000, 9001)
+	if len(r.IP) != net.IPv4len {
+		t.Error("IPv4 address not normalized")
+	}
+
+	got, err := ParseENR(r.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID() != r.ID() || got.Seq != 3 || got.UDP != 9000 || got.TCP != 9001 || !got.IP.Equal(r.IP) {
+		t.Errorf("round trip mismatch: %+v", got)
+	}
+	if got.TCPAddr() != "127.0.0.1:9001" {
+		t.Errorf("unexpected TCP address %s", got.TCPAddr())
+	}
+	if got.ID().PeerID() != transport.PubkeyToPeerID(got.PublicKey) {
+		t.Error("peer ID differs from the one the transport authenticates")
+	}
+
+	v6 := NewRecord(testKey(1), 1, net.ParseIP("::1"), 1, 2)
+	if _, err := ParseRecord(v6.Marshal()); err != nil {
+		t.Errorf("IPv6 record: %v", err)
+	}
+}
+
+func TestRecordRejectsTampering(t *testing.T) {
+	data := NewRecord(testKey(1), 1, net.ParseIP("127.0.0.1"), 9000, 9001).Marshal()
+	data[len(data)-70]++ // the TCP port
+	if _, err := ParseRecord(data); err == nil {
+		t.Error("expected signature failure")
+	}
+	if _, err := ParseRecord(data[:10]); err == nil {
+		t.Error("expected error for truncated record")
+	}
+	if _, err := ParseENR("bogus"); err == nil {
+		t.Error("expected error for missing prefix")
+	}
+}
+
+func TestLogDistance(t *testing.T) {
+	var a, b NodeID
+	if LogDistance(a, b) != 0 {
+		t.Error("expected 0 for equal IDs")
+	}
+	b[0] = 0x80
+	if LogDistance(a, b) != 256 {
+		t.Errorf("expected 256, got %d", LogDistance(a, b))
+	}
+	b = NodeID{}
+	b[31] = 0x01
+	if LogDistance(a, b) != 1 {
+		t.Errorf("expected 1, got %d", LogDistance(a, b))
+	}
+}
+
+func TestTableBuckets(t *testing.T) {
+	tab := NewTable(NodeID{})
+	var first *Record
+	added := 0
+	for seed := byte(1); added <= bucketSize; seed++ {
+		r := NewRecord(testKey(seed), 1, net.ParseIP("127.0.0.1"), uint16(seed), 0)
+		if LogDistance(NodeID{}, r.ID()) != 256 {
+			continue
+		}
+		ok, oldest := tab.Add(r)
+		if added == 0 {
+			first = r
+		}
+		if added < bucketSize && !ok {
+			t.Fatal("add failed before bucket was full")
+		}
+		if added == bucketSize && (ok || oldest.ID() != first.ID()) {
+			t.Fatal("full bucket should return the least recently seen node")
+		}
+		added++
+	}
+	if len(tab.AtDistance(256)) != bucketSize {
+		t.Errorf("expected full bucket, got %d", len(tab.AtDistance(256)))
+	}
+
+	// Refreshing moves a node to the back.
+	tab.Add(first)
+	if b := tab.AtDistance(256); b[len(b)-1].ID() != first.ID() {
+		t.Error("refreshed node not moved to the back")
+	}
+	tab.Remove(first.ID())
+	if tab.Get(first.ID()) != nil || tab.Len() != bucketSize-1 {
+		t.Error("remove failed")
+	}
+}
@@ -0,0 +1,157 @@
+package discover
+
+import (
+	"bytes"
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+const (
+	bucketSize = 16
+	numBuckets = 256
+)
+
+// LogDistance is the Kademlia distance between two IDs: the bit length of
+// a XOR b, so 0 for equal IDs and 256 for IDs differing in the first bit.
+func LogDistance(a, b NodeID) int {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			return (len(a)-i)*8 - bits.LeadingZeros8(x)
+		}
+	}
+	return 0
+}
+
+// closer reports whether a is closer to target than b.
+func closer(target, a, b NodeID) bool {
+	for i := range target {
+		da, db := a[i]^target[i], b[i]^target[i]
+		if da != db {
+			return da < db
+		}
+	}
+	return false
+}
+
+// Table is a Kademlia routing table. Bucket i holds nodes at log distance
+// i+1, least recently seen first.
+type Table struct {
+	self NodeID
+
+	mu      sync.Mutex
+	buckets [numBuckets][]*Record
+}
+
+func NewTable(self NodeID) *Table {
+	return &Table{self: self}
+}
+
+func (t *Table) bucket(id NodeID) int {
+	return LogDistance(t.self, id) - 1
+}
+
+// Add inserts r or refreshes it, moving it to the most recently seen end of
+// its bucket. If the bucket is full, r is not added and the least recently
+// seen node is returned so the caller can check whether it is still alive.
+func (t *Table) Add(r *Record) (added bool, oldest *Record) {
+	id := r.ID()
+	if id == t.self {
+		return false, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[t.bucket(id)]
+	for i, n := range *b {
+		if n.ID() == id {
+			if r.Seq >= n.Seq {
+				n = r
+			}
+			*b = append(append((*b)[:i:i], (*b)[i+1:]...), n)
+			return true, nil
+		}
+	}
+	if len(*b) >= bucketSize {
+		return false, (*b)[0]
+	}
+	*b = append(*b, r)
+	return true, nil
+}
+
+func (t *Table) Remove(id NodeID) {
+	if id == t.self {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[t.bucket(id)]
+	for i, n := range *b {
+		if n.ID() == id {
+			*b = append((*b)[:i:i], (*b)[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *Table) Get(id NodeID) *Record {
+	if id == t.self {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, n := range t.buckets[t.bucket(id)] {
+		if n.ID() == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// AtDistance returns the nodes at log distance d from us.
+func (t *Table) AtDistance(d int) []*Record {
+	if d < 1 || d > numBuckets {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Record(nil), t.buckets[d-1]...)
+}
+
+// Closest returns up to n nodes closest to target.
+func (t *Table) Closest(target NodeID, n int) []*Record {
+	nodes := t.Nodes()
+	sortByDistance(target, nodes)
+	if len(nodes) > n {
+		nodes = nodes[:n]
+	}
+	return nodes
+}
+
+// Nodes returns every node in the table, ordered by ID.
+func (t *Table) Nodes() []*Record {
+	t.mu.Lock()
+	var nodes []*Record
+	for _, b := range t.buckets {
+		nodes = append(nodes, b...)
+	}
+	t.mu.Unlock()
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i].ID(), nodes[j].ID()
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	return nodes
+}
+
+func (t *Table) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, b := range t.buckets {
+		n += len(b)
+	}
+	return n
+}
+
+func sortByDistance(target NodeID, nodes []*Record) {
+	sort.Slice(nodes, func(i, j int) bool { return closer(target, nodes[i].ID(), nodes[j].ID()) })
+}
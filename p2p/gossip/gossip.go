@@ -0,0 +1,460 @@
+// Package gossip implements topic-based publish/subscribe with mesh
+// forwarding, message deduplication and validation before propagation.
+package gossip
+
+import (
+	"bufio"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/p2p/codec"
+	"github.com/devlongs/gean/p2p/host"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+// ProtocolID is the stream protocol carrying gossip frames.
+const ProtocolID = "/meshsub/1.0.0"
+
+// MessageID identifies a message: the first 20 bytes of ssz.Hash over the
+// compressed payload.
+type MessageID [20]byte
+
+func messageID(compressed []byte) MessageID {
+	h := ssz.Hash(compressed)
+	var id MessageID
+	copy(id[:], h[:])
+	return id
+}
+
+// Message is a received gossip message with its payload decompressed.
+type Message struct {
+	ID    MessageID
+	Topic string
+	From  transport.PeerID
+	Data  []byte
+}
+
+// ValidationResult decides whether a message is delivered and forwarded.
+type ValidationResult int
+
+const (
+	// ValidationAccept delivers and forwards the message.
+	ValidationAccept ValidationResult = iota
+	// ValidationIgnore drops the message without blaming the sender.
+	ValidationIgnore
+	// ValidationReject drops the message and marks the sender as misbehaving.
+	ValidationReject
+)
+
+func (r ValidationResult) String() string {
+	switch r {
+	case ValidationAccept:
+		return "accept"
+	case ValidationIgnore:
+		return "ignore"
+	case ValidationReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// Validator inspects a message before it is delivered or forwarded.
+type Validator func(msg *Message) ValidationResult
+
+// Handler receives accepted messages on a subscribed topic.
+type Handler func(msg *Message)
+
+// ValidationObserver is told the outcome of every validated message, e.g. to
+// feed peer scoring.
+type ValidationObserver func(peer transport.PeerID, topic string, result ValidationResult)
+
+type Config struct {
+	// MeshDegree is the number of peers a message is forwarded to per topic.
+	MeshDegree int
+	// SeenTTL is how long message IDs are remembered for deduplication.
+	SeenTTL time.Duration
+	// MaxMessageSize bounds the decompressed payload.
+	MaxMessageSize int
+	// OutboundQueueSize bounds the frames waiting to be written to a peer.
+	// Frames for a peer whose queue is full are dropped, so a slow peer
+	// cannot hold up the others.
+	OutboundQueueSize int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MeshDegree:        8,
+		SeenTTL:           2 * time.Minute,
+		MaxMessageSize:    10 * 1024 * 1024,
+		OutboundQueueSize: 256,
+	}
+}
+
+// peerState holds what we know of a peer and the queue of frames to write
+// to it. Frames are written by writeLoop once the outbound stream is open.
+type peerState struct {
+	queue     chan *frame
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	topics map[string]bool
+}
+
+func newPeerState(queueSize int) *peerState {
+	return &peerState{
+		queue:  make(chan *frame, queueSize),
+		done:   make(chan struct{}),
+		topics: make(map[string]bool),
+	}
+}
+
+// send queues f without blocking. It reports false if the frame was dropped
+// because the queue is full or the peer is gone.
+func (p *peerState) send(f *frame) bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
+	select {
+	case p.queue <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeLoop writes queued frames to s until the peer is closed or a write
+// fails. Closing the peer resets s, which also ends a blocked write.
+func (p *peerState) writeLoop(s transport.Stream) {
+	go func() {
+		<-p.done
+		s.Reset()
+	}()
+	for {
+		select {
+		case <-p.done:
+			return
+		case f := <-p.queue:
+			if err := writeFrame(s, f); err != nil {
+				p.close()
+				return
+			}
+		}
+	}
+}
+
+// close stops the writer and drops any further frames.
+func (p *peerState) close() {
+	p.closeOnce.Do(func() { close(p.done) })
+}
+
+type subscription struct {
+	handler Handler
+	mesh    map[transport.PeerID]bool
+}
+
+// Router is a gossip node attached to a host.
+type Router struct {
+	cfg  Config
+	host *host.Host
+	seen *seenCache
+
+	mu         sync.Mutex
+	peers      map[transport.PeerID]*peerState
+	subs       map[string]*subscription
+	validators map[string]Validator
+	observer   ValidationObserver
+	rng        *rand.Rand
+}
+
+func NewRouter(h *host.Host, cfg Config) *Router {
+	r := &Router{
+		cfg:        cfg,
+		host:       h,
+		seen:       newSeenCache(cfg.SeenTTL),
+		peers:      make(map[transport.PeerID]*peerState),
+		subs:       make(map[string]*subscription),
+		validators: make(map[string]Validator),
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	h.SetStreamHandler(ProtocolID, r.handleStream)
+	h.Notify(r)
+	return r
+}
+
+// SetValidator installs the validator for a topic. Topics without one accept
+// every well-formed message.
+func (r *Router) SetValidator(topic string, v Validator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.validators[topic] = v
+}
+
+func (r *Router) SetValidationObserver(o ValidationObserver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observer = o
+}
+
+// Subscribe joins a topic and delivers accepted messages to handler.
+func (r *Router) Subscribe(topic string, handler Handler) {
+	r.mu.Lock()
+	sub := &subscription{handler: handler, mesh: make(map[transport.PeerID]bool)}
+	r.subs[topic] = sub
+	r.fillMesh(topic, sub)
+	peers := r.allPeers()
+	r.mu.Unlock()
+
+	for _, p := range peers {
+		p.send(&frame{kind: kindSubscribe, topic: topic})
+	}
+}
+
+func (r *Router) Unsubscribe(topic string) {
+	r.mu.Lock()
+	delete(r.subs, topic)
+	peers := r.allPeers()
+	r.mu.Unlock()
+
+	for _, p := range peers {
+		p.send(&frame{kind: kindUnsubscribe, topic: topic})
+	}
+}
+
+// MeshPeers returns the current mesh of a subscribed topic.
+func (r *Router) MeshPeers(topic string) []transport.PeerID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub, ok := r.subs[topic]
+	if !ok {
+		return nil
+	}
+	peers := make([]transport.PeerID, 0, len(sub.mesh))
+	for p := range sub.mesh {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// Publish compresses and sends an SSZ payload to the topic. Publishing to a
+// topic we are not subscribed to sends to a random set of subscribed peers.
+func (r *Router) Publish(topic string, data []byte) MessageID {
+	return r.publish(topic, codec.Compress(data))
+}
+
+func (r *Router) publish(topic string, compressed []byte) MessageID {
+	id := messageID(compressed)
+	r.seen.add(id)
+
+	r.mu.Lock()
+	var targets []*peerState
+	if sub, ok := r.subs[topic]; ok {
+		targets = r.meshTargets(sub, "")
+	} else {
+		targets = r.fanout(topic)
+	}
+	r.mu.Unlock()
+
+	f := &frame{kind: kindMessage, topic: topic, payload: compressed}
+	for _, p := range targets {
+		p.send(f)
+	}
+	return id
+}
+
+// Connected opens our outbound gossip stream and announces subscriptions.
+func (r *Router) Connected(peer transport.PeerID) {
+	go func() {
+		s, err := r.host.NewStream(peer, ProtocolID)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		if !r.host.IsConnected(peer) {
+			r.mu.Unlock()
+			s.Reset()
+			return
+		}
+		p := r.peerLocked(peer)
+		topics := make([]string, 0, len(r.subs))
+		for t := range r.subs {
+			topics = append(topics, t)
+		}
+		r.mu.Unlock()
+
+		for _, t := range topics {
+			p.send(&frame{kind: kindSubscribe, topic: t})
+		}
+		p.writeLoop(s)
+	}()
+}
+
+func (r *Router) Disconnected(peer transport.PeerID) {
+	r.mu.Lock()
+	p, ok := r.peers[peer]
+	delete(r.peers, peer)
+	for topic, sub := range r.subs {
+		if sub.mesh[peer] {
+			delete(sub.mesh, peer)
+			r.fillMesh(topic, sub)
+		}
+	}
+	r.mu.Unlock()
+
+	if ok {
+		p.close()
+	}
+}
+
+func (r *Router) handleStream(peer transport.PeerID, s transport.Stream) {
+	defer s.Close()
+	br := bufio.NewReader(s)
+	maxPayload := codec.MaxCompressedLen(r.cfg.MaxMessageSize)
+	for {
+		f, err := readFrame(br, maxPayload)
+		if err != nil {
+			return
+		}
+		switch f.kind {
+		case kindSubscribe, kindUnsubscribe:
+			r.handleSubscription(peer, f.topic, f.kind == kindSubscribe)
+		case kindMessage:
+			r.handleMessage(peer, f.topic, f.payload)
+		}
+	}
+}
+
+func (r *Router) handleSubscription(peer transport.PeerID, topic string, subscribed bool) {
+	if !r.host.IsConnected(peer) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.peerLocked(peer)
+	p.mu.Lock()
+	if subscribed {
+		p.topics[topic] = true
+	} else {
+		delete(p.topics, topic)
+	}
+	p.mu.Unlock()
+
+	if sub, ok := r.subs[topic]; ok {
+		if !subscribed && sub.mesh[peer] {
+			delete(sub.mesh, peer)
+		}
+		r.fillMesh(topic, sub)
+	}
+}
+
+func (r *Router) handleMessage(from transport.PeerID, topic string, compressed []byte) {
+	id := messageID(compressed)
+	if !r.seen.add(id) {
+		return
+	}
+
+	r.mu.Lock()
+	sub, subscribed := r.subs[topic]
+	validator := r.validators[topic]
+	observer := r.observer
+	r.mu.Unlock()
+	if !subscribed {
+		return
+	}
+
+	msg := &Message{ID: id, Topic: topic, From: from}
+	result := ValidationAccept
+	data, err := codec.Decompress(compressed, r.cfg.MaxMessageSize)
+	if err != nil {
+		result = ValidationReject
+	} else {
+		msg.Data = data
+		if validator != nil {
+			result = validator(msg)
+		}
+	}
+	if observer != nil {
+		observer(from, topic, result)
+	}
+	if result != ValidationAccept {
+		return
+	}
+
+	r.mu.Lock()
+	targets := r.meshTargets(sub, from)
+	r.mu.Unlock()
+	f := &frame{kind: kindMessage, topic: topic, payload: compressed}
+	for _, p := range targets {
+		p.send(f)
+	}
+	sub.handler(msg)
+}
+
+func (r *Router) peerLocked(id transport.PeerID) *peerState {
+	p, ok := r.peers[id]
+	if !ok {
+		p = newPeerState(r.cfg.OutboundQueueSize)
+		r.peers[id] = p
+	}
+	return p
+}
+
+func (r *Router) allPeers() []*peerState {
+	peers := make([]*peerState, 0, len(r.peers))
+	for _, p := range r.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+func (r *Router) meshTargets(sub *subscription, exclude transport.PeerID) []*peerState {
+	targets := make([]*peerState, 0, len(sub.mesh))
+	for id := range sub.mesh {
+		if id != exclude {
+			targets = append(targets, r.peers[id])
+		}
+	}
+	return targets
+}
+
+// subscribedPeers returns peers that announced the topic, in random order.
+func (r *Router) subscribedPeers(topic string) []transport.PeerID {
+	var ids []transport.PeerID
+	for id, p := range r.peers {
+		p.mu.Lock()
+		ok := p.topics[topic]
+		p.mu.Unlock()
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	r.rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	return ids
+}
+
+// fillMesh tops the mesh of a topic up to MeshDegree peers.
+func (r *Router) fillMesh(topic string, sub *subscription) {
+	for _, id := range r.subscribedPeers(topic) {
+		if len(sub.mesh) >= r.cfg.MeshDegree {
+			return
+		}
+		sub.mesh[id] = true
+	}
+}
+
+func (r *Router) fanout(topic string) []*peerState {
+	ids := r.subscribedPeers(topic)
+	if len(ids) > r.cfg.MeshDegree {
+		ids = ids[:r.cfg.MeshDegree]
+	}
+	targets := make([]*peerState, len(ids))
+	for i, id := range ids {
+		targets[i] = r.peers[id]
+	}
+	return targets
+}
@@ -0,0 +1,215 @@
+package gossip
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/host"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+func TestPropagationAcrossLine(t *testing.T) {
+	nodes := newTestNetwork(t, 5, DefaultConfig(), TopicBlock, TopicAttestation)
+	connectLine(t, nodes)
+	waitForMeshes(t, nodes, TopicAttestation, lineDegree(len(nodes)))
+
+	att := &types.SignedAttestation{ValidatorID: 3, Message: types.AttestationData{Slot: 9}}
+	nodes[0].router.PublishAttestation(att)
+
+	waitFor(t, "delivery", func() bool { return nodes[4].count(TopicAttestation) == 1 })
+	for i, n := range nodes[1:] {
+		if n.count(TopicAttestation) != 1 {
+			t.Errorf("node %d received %d messages", i+1, n.count(TopicAttestation))
+		}
+	}
+	if nodes[0].count(TopicAttestation) != 0 {
+		t.Error("publisher should not deliver to itself")
+	}
+	if nodes[0].count(TopicBlock) != 0 || nodes[4].count(TopicBlock) != 0 {
+		t.Error("messages leaked to another topic")
+	}
+
+	got, err := DecodeAttestation(nodes[4].received[TopicAttestation][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *att {
+		t.Error("decoded attestation mismatch")
+	}
+	if nodes[4].received[TopicAttestation][0].From != "node-3" {
+		t.Error("message should arrive from the neighbour")
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	// A triangle gives every node two paths to each message.
+	nodes := newTestNetwork(t, 3, DefaultConfig(), TopicBlock)
+	connectNodes(t, nodes[0], nodes[1])
+	connectNodes(t, nodes[1], nodes[2])
+	connectNodes(t, nodes[2], nodes[0])
+	waitForMeshes(t, nodes, TopicBlock, func(int) int { return 2 })
+
+	block := &types.SignedBlockWithAttestation{}
+	block.Message.Block.Slot = 4
+	nodes[0].router.PublishBlock(block)
+	nodes[0].router.PublishBlock(block)
+
+	waitFor(t, "delivery", func() bool { return nodes[1].count(TopicBlock) == 1 && nodes[2].count(TopicBlock) == 1 })
+	time.Sleep(100 * time.Millisecond)
+	for i, n := range nodes[1:] {
+		if n.count(TopicBlock) != 1 {
+			t.Errorf("node %d received %d copies", i+1, n.count(TopicBlock))
+		}
+	}
+	decoded, err := DecodeBlock(nodes[2].received[TopicBlock][0])
+	if err != nil || decoded.Message.Block.Slot != 4 {
+		t.Errorf("decoded block: %v", err)
+	}
+}
+
+func TestValidationStopsPropagation(t *testing.T) {
+	for _, result := range []ValidationResult{ValidationReject, ValidationIgnore} {
+		t.Run(result.String(), func(t *testing.T) {
+			nodes := newTestNetwork(t, 3, DefaultConfig(), TopicBlock)
+
+			var mu sync.Mutex
+			var observed []ValidationResult
+			var blamed transport.PeerID
+			nodes[1].router.SetValidator(TopicBlock, func(msg *Message) ValidationResult { return result })
+			nodes[1].router.SetValidationObserver(func(peer transport.PeerID, topic string, r ValidationResult) {
+				mu.Lock()
+				defer mu.Unlock()
+				observed = append(observed, r)
+				blamed = peer
+			})
+
+			connectLine(t, nodes)
+			waitForMeshes(t, nodes, TopicBlock, lineDegree(3))
+			nodes[0].router.Publish(TopicBlock, []byte("bad block"))
+
+			waitFor(t, "validation", func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(observed) == 1
+			})
+			time.Sleep(100 * time.Millisecond)
+			if nodes[1].count(TopicBlock) != 0 || nodes[2].count(TopicBlock) != 0 {
+				t.Error("invalid message must not be delivered or forwarded")
+			}
+			if observed[0] != result || blamed != "node-0" {
+				t.Errorf("observed %v from %s", observed, blamed)
+			}
+		})
+	}
+}
+
+func TestMeshDegree(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MeshDegree = 2
+	nodes := newTestNetwork(t, 6, cfg, TopicBlock)
+	for _, n := range nodes[1:] {
+		connectNodes(t, nodes[0], n)
+	}
+	waitFor(t, "subscriptions", func() bool {
+		return len(nodes[0].router.subscribedPeersSnapshot(TopicBlock)) == 5
+	})
+	if got := len(nodes[0].router.MeshPeers(TopicBlock)); got != 2 {
+		t.Errorf("expected mesh of 2, got %d", got)
+	}
+
+	nodes[0].router.Publish(TopicBlock, []byte("hello"))
+	time.Sleep(100 * time.Millisecond)
+	total := 0
+	for _, n := range nodes[1:] {
+		total += n.count(TopicBlock)
+	}
+	if total != 2 {
+		t.Errorf("expected delivery to the 2 mesh peers, got %d", total)
+	}
+}
+
+func TestMeshRefillsOnDisconnect(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MeshDegree = 1
+	nodes := newTestNetwork(t, 3, cfg, TopicBlock)
+	connectNodes(t, nodes[0], nodes[1])
+	connectNodes(t, nodes[0], nodes[2])
+	waitFor(t, "subscriptions", func() bool {
+		return len(nodes[0].router.subscribedPeersSnapshot(TopicBlock)) == 2
+	})
+
+	mesh := nodes[0].router.MeshPeers(TopicBlock)
+	if len(mesh) != 1 {
+		t.Fatalf("mesh: %v", mesh)
+	}
+	nodes[0].host.Disconnect(mesh[0])
+	waitFor(t, "mesh refill", func() bool {
+		m := nodes[0].router.MeshPeers(TopicBlock)
+		return len(m) == 1 && m[0] != mesh[0]
+	})
+}
+
+func TestSeenCacheExpiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newSeenCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	id := MessageID{1}
+	if !c.add(id) || c.add(id) {
+		t.Fatal("second add should report duplicate")
+	}
+	now = now.Add(2 * time.Minute)
+	if !c.add(MessageID{2}) {
+		t.Fatal("new id")
+	}
+	if c.len() != 1 {
+		t.Errorf("expired entries should be pruned, have %d", c.len())
+	}
+	if !c.add(id) {
+		t.Error("expired id should be accepted again")
+	}
+}
+
+func TestMessageIDUsesCompressedPayload(t *testing.T) {
+	if messageID([]byte{1}) == messageID([]byte{2}) {
+		t.Error("different payloads should have different IDs")
+	}
+}
+
+// TestSlowPeerDoesNotStall publishes far more than a peer that never reads
+// can take: its frames are dropped while the other peer gets every message.
+func TestSlowPeerDoesNotStall(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.OutboundQueueSize = 8
+	nodes := newTestNetwork(t, 2, cfg, "test")
+	connectNodes(t, nodes[0], nodes[1])
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	slow := host.New("slow", transport.NewTCP("slow"))
+	t.Cleanup(func() { slow.Close() })
+	slow.SetStreamHandler(ProtocolID, func(transport.PeerID, transport.Stream) { <-stuck })
+	if _, err := slow.Connect(context.Background(), nodes[0].host.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	s, err := slow.NewStream(nodes[0].host.ID(), ProtocolID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(s, &frame{kind: kindSubscribe, topic: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "mesh formation", func() bool { return len(nodes[0].router.MeshPeers("test")) == 2 })
+
+	// Incompressible payloads fill the slow peer's stream window quickly.
+	payload := make([]byte, 64*1024)
+	for i := 0; i < 40; i++ {
+		rand.Read(payload)
+		nodes[0].router.Publish("test", payload)
+		waitFor(t, "delivery", func() bool { return nodes[1].count("test") == i+1 })
+	}
+}
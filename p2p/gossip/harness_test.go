@@ -0,0 +1,109 @@
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/p2p/host"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+// testNode is one in-process gossip participant recording what it receives.
+type testNode struct {
+	host   *host.Host
+	router *Router
+
+	mu       sync.Mutex
+	received map[string][]*Message
+}
+
+func (n *testNode) handler(topic string) Handler {
+	return func(msg *Message) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.received[topic] = append(n.received[topic], msg)
+	}
+}
+
+func (n *testNode) count(topic string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.received[topic])
+}
+
+// newTestNetwork starts n nodes on loopback, all subscribed to topics.
+func newTestNetwork(t *testing.T, n int, cfg Config, topics ...string) []*testNode {
+	t.Helper()
+	nodes := make([]*testNode, n)
+	for i := range nodes {
+		id := transport.PeerID(fmt.Sprintf("node-%d", i))
+		h := host.New(id, transport.NewTCP(id))
+		if err := h.Listen("127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		node := &testNode{host: h, router: NewRouter(h, cfg), received: make(map[string][]*Message)}
+		for _, topic := range topics {
+			node.router.Subscribe(topic, node.handler(topic))
+		}
+		nodes[i] = node
+	}
+	return nodes
+}
+
+func connectNodes(t *testing.T, a, b *testNode) {
+	t.Helper()
+	if _, err := a.host.Connect(context.Background(), b.host.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// connectLine links nodes as 0 - 1 - 2 - ... so messages must be forwarded.
+func connectLine(t *testing.T, nodes []*testNode) {
+	t.Helper()
+	for i := 1; i < len(nodes); i++ {
+		connectNodes(t, nodes[i-1], nodes[i])
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitForMeshes waits until every node has the expected number of mesh peers.
+func waitForMeshes(t *testing.T, nodes []*testNode, topic string, want func(i int) int) {
+	t.Helper()
+	waitFor(t, "mesh formation", func() bool {
+		for i, n := range nodes {
+			if len(n.router.MeshPeers(topic)) != want(i) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func lineDegree(n int) func(int) int {
+	return func(i int) int {
+		if i == 0 || i == n-1 {
+			return 1
+		}
+		return 2
+	}
+}
+
+func (r *Router) subscribedPeersSnapshot(topic string) []transport.PeerID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.subscribedPeers(topic)
+}
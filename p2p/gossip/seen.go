@@ -0,0 +1,51 @@
+package gossip
+
+import (
+	"sync"
+	"time"
+)
+
+// seenCache remembers message IDs for a fixed time to drop duplicates.
+type seenCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[MessageID]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newSeenCache(ttl time.Duration) *seenCache {
+	return &seenCache{
+		ttl:     ttl,
+		entries: make(map[MessageID]time.Time),
+		now:     time.Now,
+	}
+}
+
+// add records id and reports whether it was new.
+func (c *seenCache) add(id MessageID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastPrune) >= c.ttl {
+		for k, expiry := range c.entries {
+			if !now.Before(expiry) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	if expiry, ok := c.entries[id]; ok && now.Before(expiry) {
+		return false
+	}
+	c.entries[id] = now.Add(c.ttl)
+	return true
+}
+
+func (c *seenCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
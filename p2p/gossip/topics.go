@@ -0,0 +1,31 @@
+package gossip
+
+import (
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/codec"
+)
+
+// Consensus topics. Payloads are snappy-compressed SSZ.
+const (
+	TopicBlock       = "/leanconsensus/block/ssz_snappy"
+	TopicAttestation = "/leanconsensus/attestation/ssz_snappy"
+)
+
+func (r *Router) PublishBlock(block *types.SignedBlockWithAttestation) MessageID {
+	return r.publish(TopicBlock, codec.EncodeBlock(block))
+}
+
+func (r *Router) PublishAttestation(att *types.SignedAttestation) MessageID {
+	return r.publish(TopicAttestation, codec.EncodeAttestation(att))
+}
+
+// DecodeBlock decodes the payload of a TopicBlock message.
+func DecodeBlock(msg *Message) (*types.SignedBlockWithAttestation, error) {
+	return ssz.UnmarshalSignedBlockWithAttestation(msg.Data, types.AttestationsLimit, types.ValidatorRegistryLimit)
+}
+
+// DecodeAttestation decodes the payload of a TopicAttestation message.
+func DecodeAttestation(msg *Message) (*types.SignedAttestation, error) {
+	return ssz.UnmarshalSignedAttestation(msg.Data)
+}
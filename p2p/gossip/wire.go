@@ -0,0 +1,65 @@
+package gossip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Frames exchanged on the gossip stream, each:
+// kind (1 byte) | topic length (uvarint) | topic | payload length (uvarint) | payload
+const (
+	kindSubscribe byte = iota
+	kindUnsubscribe
+	kindMessage
+)
+
+const maxTopicLen = 256
+
+type frame struct {
+	kind    byte
+	topic   string
+	payload []byte
+}
+
+func writeFrame(w io.Writer, f *frame) error {
+	buf := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(f.topic)+len(f.payload))
+	buf = append(buf, f.kind)
+	buf = binary.AppendUvarint(buf, uint64(len(f.topic)))
+	buf = append(buf, f.topic...)
+	buf = binary.AppendUvarint(buf, uint64(len(f.payload)))
+	buf = append(buf, f.payload...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r *bufio.Reader, maxPayload int) (*frame, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	topicLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if topicLen > maxTopicLen {
+		return nil, fmt.Errorf("topic length %d exceeds %d", topicLen, maxTopicLen)
+	}
+	topic := make([]byte, topicLen)
+	if _, err := io.ReadFull(r, topic); err != nil {
+		return nil, err
+	}
+	payloadLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if payloadLen > uint64(maxPayload) {
+		return nil, fmt.Errorf("payload length %d exceeds %d", payloadLen, maxPayload)
+	}
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return &frame{kind: kind, topic: string(topic), payload: payload}, nil
+}
@@ -0,0 +1,226 @@
+// Package host manages connections to peers and routes incoming streams to
+// protocol handlers.
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+var ErrNotConnected = errors.New("host: peer not connected")
+
+// StreamHandler serves a stream opened by a remote peer. It owns the stream.
+type StreamHandler func(peer transport.PeerID, s transport.Stream)
+
+// Notifiee is told about connections being established and lost.
+type Notifiee interface {
+	Connected(peer transport.PeerID)
+	Disconnected(peer transport.PeerID)
+}
+
+type Host struct {
+	id        transport.PeerID
+	transport transport.Transport
+
+	mu        sync.RWMutex
+	listener  transport.Listener
+	conns     map[transport.PeerID]transport.Conn
+	handlers  map[string]StreamHandler
+	notifiees []Notifiee
+	closed    bool
+}
+
+func New(id transport.PeerID, tr transport.Transport) *Host {
+	return &Host{
+		id:        id,
+		transport: tr,
+		conns:     make(map[transport.PeerID]transport.Conn),
+		handlers:  make(map[string]StreamHandler),
+	}
+}
+
+func (h *Host) ID() transport.PeerID { return h.id }
+
+// Listen starts accepting connections on addr.
+func (h *Host) Listen(addr string) error {
+	l, err := h.transport.Listen(addr)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.listener = l
+	h.mu.Unlock()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			h.addConn(c)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the listening address, or nil before Listen.
+func (h *Host) Addr() net.Addr {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.listener == nil {
+		return nil
+	}
+	return h.listener.Addr()
+}
+
+// Connect dials addr and returns the remote peer ID.
+func (h *Host) Connect(ctx context.Context, addr string) (transport.PeerID, error) {
+	c, err := h.transport.Dial(ctx, addr)
+	if err != nil {
+		return "", err
+	}
+	if !h.addConn(c) {
+		return c.RemotePeer(), fmt.Errorf("duplicate connection to %s", c.RemotePeer())
+	}
+	return c.RemotePeer(), nil
+}
+
+// SetStreamHandler registers the handler for a protocol ID. Streams for
+// protocols without a handler are reset.
+func (h *Host) SetStreamHandler(protocol string, handler StreamHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[protocol] = handler
+}
+
+// Notify registers n for connection events. Peers that are already connected
+// are reported immediately.
+func (h *Host) Notify(n Notifiee) {
+	h.mu.Lock()
+	h.notifiees = append(h.notifiees, n)
+	peers := h.peersLocked()
+	h.mu.Unlock()
+	for _, p := range peers {
+		n.Connected(p)
+	}
+}
+
+// NewStream opens a stream to a connected peer.
+func (h *Host) NewStream(peer transport.PeerID, protocol string) (transport.Stream, error) {
+	h.mu.RLock()
+	c, ok := h.conns[peer]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotConnected
+	}
+	return c.OpenStream(protocol)
+}
+
+// Peers returns the connected peers sorted by ID.
+func (h *Host) Peers() []transport.PeerID {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.peersLocked()
+}
+
+func (h *Host) peersLocked() []transport.PeerID {
+	peers := make([]transport.PeerID, 0, len(h.conns))
+	for p := range h.conns {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i] < peers[j] })
+	return peers
+}
+
+func (h *Host) IsConnected(peer transport.PeerID) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.conns[peer]
+	return ok
+}
+
+// Disconnect closes the connection to peer, if any.
+func (h *Host) Disconnect(peer transport.PeerID) {
+	h.mu.RLock()
+	c, ok := h.conns[peer]
+	h.mu.RUnlock()
+	if ok {
+		c.Close()
+	}
+}
+
+// Close stops listening and drops every connection.
+func (h *Host) Close() error {
+	h.mu.Lock()
+	h.closed = true
+	l := h.listener
+	conns := make([]transport.Conn, 0, len(h.conns))
+	for _, c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+
+	if l != nil {
+		l.Close()
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+	return nil
+}
+
+// addConn registers a new connection and serves its streams. Connections to
+// ourselves, to peers we are already connected to, or after Close are
+// dropped.
+func (h *Host) addConn(c transport.Conn) bool {
+	peer := c.RemotePeer()
+	h.mu.Lock()
+	if _, dup := h.conns[peer]; dup || h.closed || peer == h.id {
+		h.mu.Unlock()
+		c.Close()
+		return false
+	}
+	h.conns[peer] = c
+	notifiees := append([]Notifiee(nil), h.notifiees...)
+	h.mu.Unlock()
+
+	for _, n := range notifiees {
+		n.Connected(peer)
+	}
+	go h.serve(c)
+	return true
+}
+
+func (h *Host) serve(c transport.Conn) {
+	peer := c.RemotePeer()
+	for {
+		s, err := c.AcceptStream()
+		if err != nil {
+			break
+		}
+		h.mu.RLock()
+		handler, ok := h.handlers[s.Protocol()]
+		h.mu.RUnlock()
+		if !ok {
+			s.Reset()
+			continue
+		}
+		go handler(peer, s)
+	}
+
+	h.mu.Lock()
+	if h.conns[peer] == c {
+		delete(h.conns, peer)
+	}
+	notifiees := append([]Notifiee(nil), h.notifiees...)
+	h.mu.Unlock()
+	for _, n := range notifiees {
+		n.Disconnected(peer)
+	}
+}
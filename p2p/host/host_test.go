@@ -0,0 +1,113 @@
+package host
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+func newHost(t *testing.T, id transport.PeerID) *Host {
+	t.Helper()
+	h := New(id, transport.NewTCP(id))
+	if err := h.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+type events struct {
+	mu           sync.Mutex
+	connected    []transport.PeerID
+	disconnected chan transport.PeerID
+}
+
+func (e *events) Connected(p transport.PeerID) {
+	e.mu.Lock()
+	e.connected = append(e.connected, p)
+	e.mu.Unlock()
+}
+
+func (e *events) Disconnected(p transport.PeerID) { e.disconnected <- p }
+
+func TestHostRoutesStreams(t *testing.T) {
+	a, b := newHost(t, "a"), newHost(t, "b")
+	b.SetStreamHandler("/ping/1", func(peer transport.PeerID, s transport.Stream) {
+		defer s.Close()
+		s.Write([]byte("pong from b to " + string(peer)))
+	})
+
+	peer, err := a.Connect(context.Background(), b.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer != "b" {
+		t.Errorf("expected peer b, got %s", peer)
+	}
+
+	s, err := a.NewStream("b", "/ping/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CloseWrite()
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "pong from b to a" {
+		t.Errorf("got %q", got)
+	}
+
+	s, err = a.NewStream("b", "/unknown/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(s); err == nil {
+		t.Error("expected reset for unknown protocol")
+	}
+
+	if _, err := a.NewStream("c", "/ping/1"); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestHostNotifiesAndRejectsDuplicates(t *testing.T) {
+	a, b := newHost(t, "a"), newHost(t, "b")
+	ev := &events{disconnected: make(chan transport.PeerID, 1)}
+	a.Notify(ev)
+
+	if _, err := a.Connect(context.Background(), b.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	// b finishes its side of the handshake on its own; until then it could
+	// keep the second connection and drop the first.
+	deadline := time.Now().Add(5 * time.Second)
+	for !b.IsConnected("a") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := a.Connect(context.Background(), b.Addr().String()); err == nil {
+		t.Error("expected duplicate connection error")
+	}
+	if len(a.Peers()) != 1 || !a.IsConnected("b") {
+		t.Errorf("peers: %v", a.Peers())
+	}
+
+	b.Disconnect("a")
+	select {
+	case p := <-ev.disconnected:
+		if p != "b" {
+			t.Errorf("disconnected %s", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no disconnect event")
+	}
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if len(ev.connected) != 1 || ev.connected[0] != "b" {
+		t.Errorf("connected events: %v", ev.connected)
+	}
+}
@@ -0,0 +1,248 @@
+// Package peers tracks connected peers, their chain status and score, and
+// enforces bans and connection limits.
+package peers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/devlongs/gean/p2p/reqresp"
+	"github.com/devlongs/gean/p2p/transport"
+	"github.com/devlongs/gean/p2p/validation"
+)
+
+type Config struct {
+	// TargetPeers is how many peers we try to keep.
+	TargetPeers int
+	// MaxPeers is the hard limit; connections above it are dropped.
+	MaxPeers int
+	// BanDuration is how long a peer stays banned after its score falls to
+	// BanThreshold.
+	BanDuration time.Duration
+
+	// StaticPeers are always dialed and redialed with backoff when the
+	// connection drops. They are admitted above MaxPeers.
+	StaticPeers []StaticPeer
+	// TrustedPeers are never banned or disconnected for their score and are
+	// admitted above MaxPeers.
+	TrustedPeers []transport.PeerID
+	// DialBackoff is the first redial delay for static peers. It doubles on
+	// every failure up to MaxDialBackoff.
+	DialBackoff    time.Duration
+	MaxDialBackoff time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		TargetPeers:    8,
+		MaxPeers:       16,
+		BanDuration:    10 * time.Minute,
+		DialBackoff:    time.Second,
+		MaxDialBackoff: time.Minute,
+	}
+}
+
+// Disconnecter drops connections. *host.Host implements it.
+type Disconnecter interface {
+	Disconnect(peer transport.PeerID)
+}
+
+type peerInfo struct {
+	score     int
+	status    reqresp.Status
+	hasStatus bool
+}
+
+// Manager tracks peers. Register it with host.Notify to follow connections.
+type Manager struct {
+	cfg  Config
+	conn Disconnecter
+	now  func() time.Time
+
+	trusted map[transport.PeerID]bool
+	// static holds a wake-up channel per static peer, signalled when it
+	// disconnects.
+	static map[transport.PeerID]chan struct{}
+
+	mu    sync.Mutex
+	peers map[transport.PeerID]*peerInfo
+	bans  map[transport.PeerID]time.Time
+}
+
+func NewManager(cfg Config, conn Disconnecter) *Manager {
+	m := &Manager{
+		cfg:     cfg,
+		conn:    conn,
+		now:     time.Now,
+		trusted: make(map[transport.PeerID]bool),
+		static:  make(map[transport.PeerID]chan struct{}),
+		peers:   make(map[transport.PeerID]*peerInfo),
+		bans:    make(map[transport.PeerID]time.Time),
+	}
+	for _, p := range cfg.TrustedPeers {
+		m.trusted[p] = true
+	}
+	for _, p := range cfg.StaticPeers {
+		m.static[p.ID] = make(chan struct{}, 1)
+	}
+	return m
+}
+
+func (m *Manager) IsTrusted(peer transport.PeerID) bool { return m.trusted[peer] }
+
+func (m *Manager) IsStatic(peer transport.PeerID) bool {
+	_, ok := m.static[peer]
+	return ok
+}
+
+// Connected admits a new peer, dropping it if it is banned or we are at
+// MaxPeers. Trusted and static peers bypass the limit.
+func (m *Manager) Connected(peer transport.PeerID) {
+	m.mu.Lock()
+	admit := !m.bannedLocked(peer) && (len(m.peers) < m.cfg.MaxPeers || m.trusted[peer] || m.IsStatic(peer))
+	if admit {
+		m.peers[peer] = &peerInfo{}
+	}
+	m.mu.Unlock()
+
+	if !admit {
+		m.conn.Disconnect(peer)
+	}
+}
+
+func (m *Manager) Disconnected(peer transport.PeerID) {
+	m.mu.Lock()
+	delete(m.peers, peer)
+	m.mu.Unlock()
+
+	if wake, ok := m.static[peer]; ok {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// UpdateStatus records the status a peer sent us.
+func (m *Manager) UpdateStatus(peer transport.PeerID, status reqresp.Status) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.peers[peer]; ok {
+		p.status, p.hasStatus = status, true
+	}
+}
+
+// Status returns the last status received from peer.
+func (m *Manager) Status(peer transport.PeerID) (reqresp.Status, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.peers[peer]
+	if !ok || !p.hasStatus {
+		return reqresp.Status{}, false
+	}
+	return p.status, true
+}
+
+// ReportValidation adjusts the score for a gossip validation result. It has
+// the validation.Reporter signature.
+func (m *Manager) ReportValidation(peer transport.PeerID, r validation.Result) {
+	m.adjust(peer, validationScores[r])
+}
+
+// ReportAction adjusts the score for req/resp behaviour.
+func (m *Manager) ReportAction(peer transport.PeerID, a Action) {
+	m.adjust(peer, actionScores[a])
+}
+
+// ReportResponse adjusts the score for the result of a request to peer.
+func (m *Manager) ReportResponse(peer transport.PeerID, err error) {
+	if a, ok := ResponseAction(err); ok {
+		m.ReportAction(peer, a)
+	}
+}
+
+func (m *Manager) adjust(peer transport.PeerID, delta int) {
+	m.mu.Lock()
+	p, ok := m.peers[peer]
+	if !ok || delta == 0 {
+		m.mu.Unlock()
+		return
+	}
+	p.score = min(p.score+delta, MaxScore)
+	ban := p.score <= BanThreshold && !m.trusted[peer]
+	if ban {
+		m.bans[peer] = m.now().Add(m.cfg.BanDuration)
+		delete(m.peers, peer)
+	}
+	m.mu.Unlock()
+
+	if ban {
+		m.conn.Disconnect(peer)
+	}
+}
+
+// Score returns the score of a connected peer.
+func (m *Manager) Score(peer transport.PeerID) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.peers[peer]; ok {
+		return p.score
+	}
+	return 0
+}
+
+func (m *Manager) IsBanned(peer transport.PeerID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bannedLocked(peer)
+}
+
+func (m *Manager) bannedLocked(peer transport.PeerID) bool {
+	if m.trusted[peer] {
+		return false
+	}
+	until, ok := m.bans[peer]
+	if !ok {
+		return false
+	}
+	if !m.now().Before(until) {
+		delete(m.bans, peer)
+		return false
+	}
+	return true
+}
+
+// Peers returns the connected peers, sorted.
+func (m *Manager) Peers() []transport.PeerID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peers := make([]transport.PeerID, 0, len(m.peers))
+	for p := range m.peers {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i] < peers[j] })
+	return peers
+}
+
+func (m *Manager) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.peers)
+}
+
+// Wanted is how many more peers we should dial to reach TargetPeers.
+func (m *Manager) Wanted() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return max(m.cfg.TargetPeers-len(m.peers), 0)
+}
+
+// CanDial reports whether dialing peer is allowed: it is not banned, not
+// already connected and we are below MaxPeers or it is trusted or static.
+func (m *Manager) CanDial(peer transport.PeerID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, connected := m.peers[peer]
+	return !connected && !m.bannedLocked(peer) && (len(m.peers) < m.cfg.MaxPeers || m.trusted[peer] || m.IsStatic(peer))
+}
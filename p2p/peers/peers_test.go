@@ -0,0 +1,195 @@
+package peers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/reqresp"
+	"github.com/devlongs/gean/p2p/transport"
+	"github.com/devlongs/gean/p2p/validation"
+)
+
+type fakeConn struct {
+	mu      sync.Mutex
+	dropped []transport.PeerID
+}
+
+func (c *fakeConn) Disconnect(peer transport.PeerID) {
+	c.mu.Lock()
+	c.dropped = append(c.dropped, peer)
+	c.mu.Unlock()
+}
+
+func newTestManager(cfg Config) (*Manager, *fakeConn, *time.Time) {
+	conn := &fakeConn{}
+	m := NewManager(cfg, conn)
+	now := time.Unix(1000, 0)
+	m.now = func() time.Time { return now }
+	return m, conn, &now
+}
+
+func TestInvalidBlocksBanPeer(t *testing.T) {
+	m, conn, now := newTestManager(DefaultConfig())
+	m.Connected("a")
+
+	m.ReportValidation("a", validation.Accept)
+	m.ReportValidation("a", validation.IgnoreUnknownParent)
+	if m.Score("a") != 1 {
+		t.Errorf("expected score 1, got %d", m.Score("a"))
+	}
+
+	// From zero, exactly two invalid blocks are needed; the accepted block
+	// above means a third is required.
+	m.ReportValidation("a", validation.RejectWrongProposer)
+	m.ReportValidation("a", validation.RejectWrongProposer)
+	if m.IsBanned("a") {
+		t.Fatal("banned too early")
+	}
+	m.ReportValidation("a", validation.RejectMalformed)
+	if !m.IsBanned("a") {
+		t.Fatal("expected ban")
+	}
+	if len(conn.dropped) != 1 || conn.dropped[0] != "a" {
+		t.Errorf("expected disconnect of a, got %v", conn.dropped)
+	}
+	if m.Count() != 0 {
+		t.Error("banned peer still tracked")
+	}
+
+	// Reconnecting during the ban is refused.
+	m.Connected("a")
+	if m.Count() != 0 || len(conn.dropped) != 2 {
+		t.Error("banned peer readmitted")
+	}
+	if m.CanDial("a") {
+		t.Error("banned peer dialable")
+	}
+
+	*now = now.Add(DefaultConfig().BanDuration)
+	if m.IsBanned("a") {
+		t.Error("ban did not expire")
+	}
+	m.Connected("a")
+	if m.Count() != 1 || m.Score("a") != 0 {
+		t.Error("expected fresh admission after ban")
+	}
+}
+
+func TestScoreIsCapped(t *testing.T) {
+	m, _, _ := newTestManager(DefaultConfig())
+	m.Connected("a")
+	for i := 0; i < 500; i++ {
+		m.ReportAction("a", ActionValidResponse)
+	}
+	if m.Score("a") != MaxScore {
+		t.Errorf("expected score %d, got %d", MaxScore, m.Score("a"))
+	}
+	for i := 0; i < 4; i++ {
+		m.ReportAction("a", ActionInvalidResponse)
+	}
+	if !m.IsBanned("a") {
+		t.Error("four invalid responses from the cap should ban")
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	m, conn, _ := newTestManager(Config{TargetPeers: 2, MaxPeers: 3, BanDuration: time.Minute})
+	if m.Wanted() != 2 {
+		t.Errorf("expected 2 wanted, got %d", m.Wanted())
+	}
+	for i := 0; i < 4; i++ {
+		m.Connected(transport.PeerID(fmt.Sprintf("p%d", i)))
+	}
+	if m.Count() != 3 || m.Wanted() != 0 {
+		t.Errorf("expected 3 peers and none wanted, got %d and %d", m.Count(), m.Wanted())
+	}
+	if len(conn.dropped) != 1 || conn.dropped[0] != "p3" {
+		t.Errorf("expected p3 dropped, got %v", conn.dropped)
+	}
+	if m.CanDial("p9") || m.CanDial("p0") {
+		t.Error("dial allowed at max peers")
+	}
+
+	m.Disconnected("p1")
+	if got := m.Peers(); len(got) != 2 || got[0] != "p0" || got[1] != "p2" {
+		t.Errorf("unexpected peers %v", got)
+	}
+	if !m.CanDial("p9") {
+		t.Error("dial refused below max peers")
+	}
+}
+
+func TestTrustedPeersAreNotBanned(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxPeers = 1
+	cfg.TrustedPeers = []transport.PeerID{"trusted"}
+	m, conn, _ := newTestManager(cfg)
+
+	m.Connected("other")
+	m.Connected("trusted")
+	if m.Count() != 2 {
+		t.Fatal("trusted peer not admitted above MaxPeers")
+	}
+	for i := 0; i < 10; i++ {
+		m.ReportValidation("trusted", validation.RejectMalformed)
+	}
+	if m.IsBanned("trusted") || len(conn.dropped) != 0 {
+		t.Error("trusted peer banned")
+	}
+	if m.Score("trusted") > BanThreshold {
+		t.Error("trusted peer score should still be tracked")
+	}
+
+	m.Disconnected("trusted")
+	if !m.CanDial("trusted") || m.CanDial("stranger") {
+		t.Error("only trusted peers may be dialed at MaxPeers")
+	}
+}
+
+func TestStatusTracking(t *testing.T) {
+	m, _, _ := newTestManager(DefaultConfig())
+	status := reqresp.Status{Head: types.Checkpoint{Root: types.Root{1}, Slot: 12}}
+
+	m.UpdateStatus("a", status)
+	if _, ok := m.Status("a"); ok {
+		t.Error("status recorded for unknown peer")
+	}
+	m.Connected("a")
+	if _, ok := m.Status("a"); ok {
+		t.Error("status before handshake")
+	}
+	m.UpdateStatus("a", status)
+	if got, ok := m.Status("a"); !ok || got != status {
+		t.Errorf("got %+v", got)
+	}
+	m.Disconnected("a")
+	if _, ok := m.Status("a"); ok {
+		t.Error("status kept after disconnect")
+	}
+}
+
+func TestResponseAction(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Action
+		ok   bool
+	}{
+		{nil, ActionValidResponse, true},
+		{reqresp.ErrTimeout, ActionTimeout, true},
+		{fmt.Errorf("%w: bad slot", reqresp.ErrInvalidResponse), ActionInvalidResponse, true},
+		{&reqresp.ResponseError{Code: reqresp.CodeResourceUnavailable}, ActionResourceUnavailable, true},
+		{&reqresp.ResponseError{Code: reqresp.CodeServerError}, ActionErrorResponse, true},
+		{transport.ErrStreamReset, 0, false},
+		{errors.New("context canceled"), 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ResponseAction(tt.err)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ResponseAction(%v) = %v, %v; want %v, %v", tt.err, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package peers
+
+import (
+	"errors"
+
+	"github.com/devlongs/gean/p2p/reqresp"
+	"github.com/devlongs/gean/p2p/validation"
+)
+
+// Score bounds. A peer at or below BanThreshold is disconnected and banned.
+// Good behaviour is capped at MaxScore so that a peer cannot bank credit
+// and then serve a run of invalid blocks.
+const (
+	MaxScore     = 100
+	BanThreshold = -100
+)
+
+// validationScores is the score change for each gossip validation result.
+// Ignored messages are not the sender's fault and cost nothing. Two invalid
+// blocks or attestations from a peer at zero get it banned.
+var validationScores = map[validation.Result]int{
+	validation.Accept:                        1,
+	validation.RejectMalformed:               -50,
+	validation.RejectWrongProposer:           -50,
+	validation.RejectUnknownValidator:        -50,
+	validation.RejectInconsistentCheckpoints: -50,
+	validation.RejectInvalidSignature:        -50,
+}
+
+// Action is req/resp behaviour observed from a peer.
+type Action int
+
+const (
+	// ActionValidResponse is a response that passed all checks.
+	ActionValidResponse Action = iota
+	// ActionResourceUnavailable is a peer that could not serve a request.
+	ActionResourceUnavailable
+	// ActionTimeout is a request that did not complete in time.
+	ActionTimeout
+	// ActionErrorResponse is a server or invalid request error returned by
+	// the peer.
+	ActionErrorResponse
+	// ActionInvalidRequest is a malformed request the peer sent us.
+	ActionInvalidRequest
+	// ActionInvalidResponse is a response breaking the protocol or carrying
+	// invalid blocks.
+	ActionInvalidResponse
+)
+
+var actionScores = map[Action]int{
+	ActionValidResponse:       1,
+	ActionResourceUnavailable: -2,
+	ActionTimeout:             -10,
+	ActionErrorResponse:       -10,
+	ActionInvalidRequest:      -20,
+	ActionInvalidResponse:     -50,
+}
+
+var actionNames = map[Action]string{
+	ActionValidResponse:       "valid_response",
+	ActionResourceUnavailable: "resource_unavailable",
+	ActionTimeout:             "timeout",
+	ActionErrorResponse:       "error_response",
+	ActionInvalidRequest:      "invalid_request",
+	ActionInvalidResponse:     "invalid_response",
+}
+
+func (a Action) String() string {
+	if name, ok := actionNames[a]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ResponseAction classifies the outcome of a request made with
+// reqresp.Client. The second result is false for failures that say nothing
+// about the peer, such as our own context being cancelled or the connection
+// dropping.
+func ResponseAction(err error) (Action, bool) {
+	var respErr *reqresp.ResponseError
+	switch {
+	case err == nil:
+		return ActionValidResponse, true
+	case errors.Is(err, reqresp.ErrTimeout):
+		return ActionTimeout, true
+	case errors.Is(err, reqresp.ErrInvalidResponse):
+		return ActionInvalidResponse, true
+	case errors.As(err, &respErr):
+		if respErr.Code == reqresp.CodeResourceUnavailable {
+			return ActionResourceUnavailable, true
+		}
+		return ActionErrorResponse, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,90 @@
+package peers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devlongs/gean/p2p/discover"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+// StaticPeer is a peer we always keep a connection to.
+type StaticPeer struct {
+	ID   transport.PeerID
+	Addr string
+}
+
+// ParsePeer parses "<peer id>@<host:port>" or a node record in its "enr:"
+// text form.
+func ParsePeer(s string) (StaticPeer, error) {
+	if strings.HasPrefix(s, "enr:") {
+		r, err := discover.ParseENR(s)
+		if err != nil {
+			return StaticPeer{}, err
+		}
+		return StaticPeer{ID: r.PeerID(), Addr: r.TCPAddr()}, nil
+	}
+	id, addr, ok := strings.Cut(s, "@")
+	if !ok || id == "" || addr == "" {
+		return StaticPeer{}, fmt.Errorf("peer %q: expected <peer id>@<host:port> or enr:...", s)
+	}
+	return StaticPeer{ID: transport.PeerID(id), Addr: addr}, nil
+}
+
+// Connector dials peers. *host.Host implements it.
+type Connector interface {
+	Connect(ctx context.Context, addr string) (transport.PeerID, error)
+	IsConnected(peer transport.PeerID) bool
+}
+
+// MaintainStatic keeps the static peers connected until ctx is done,
+// redialing with exponential backoff. Banned static peers are retried once
+// their ban expires.
+func (m *Manager) MaintainStatic(ctx context.Context, h Connector) {
+	var wg sync.WaitGroup
+	for _, p := range m.cfg.StaticPeers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.maintain(ctx, h, p)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *Manager) maintain(ctx context.Context, h Connector, p StaticPeer) {
+	wake := m.static[p.ID]
+	backoff := m.cfg.DialBackoff
+	for {
+		if h.IsConnected(p.ID) {
+			// Wait for the connection to drop.
+			select {
+			case <-wake:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		if !m.IsBanned(p.ID) {
+			id, err := h.Connect(ctx, p.Addr)
+			if err == nil && id != p.ID {
+				m.conn.Disconnect(id)
+			}
+			if h.IsConnected(p.ID) {
+				backoff = m.cfg.DialBackoff
+				continue
+			}
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, m.cfg.MaxDialBackoff)
+	}
+}
@@ -0,0 +1,122 @@
+package peers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/p2p/discover"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+// fakeHost connects to "good" after failing the first failures dials.
+type fakeHost struct {
+	mu        sync.Mutex
+	m         *Manager
+	failures  int
+	dials     []time.Time
+	connected map[transport.PeerID]bool
+}
+
+func (h *fakeHost) Connect(ctx context.Context, addr string) (transport.PeerID, error) {
+	h.mu.Lock()
+	h.dials = append(h.dials, time.Now())
+	if h.failures > 0 {
+		h.failures--
+		h.mu.Unlock()
+		return "", errors.New("connection refused")
+	}
+	h.connected["good"] = true
+	h.mu.Unlock()
+	h.m.Connected("good")
+	return "good", nil
+}
+
+func (h *fakeHost) IsConnected(peer transport.PeerID) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.connected[peer]
+}
+
+func (h *fakeHost) drop(peer transport.PeerID) {
+	h.mu.Lock()
+	delete(h.connected, peer)
+	h.mu.Unlock()
+	h.m.Disconnected(peer)
+}
+
+func (h *fakeHost) dialCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.dials)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStaticPeerRedialsWithBackoff(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxPeers = 0
+	cfg.StaticPeers = []StaticPeer{{ID: "good", Addr: "127.0.0.1:1"}}
+	cfg.DialBackoff = 20 * time.Millisecond
+	cfg.MaxDialBackoff = 40 * time.Millisecond
+	m := NewManager(cfg, &fakeConn{})
+	h := &fakeHost{m: m, failures: 3, connected: make(map[transport.PeerID]bool)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.MaintainStatic(ctx, h)
+		close(done)
+	}()
+
+	waitFor(t, func() bool { return m.Count() == 1 })
+	h.mu.Lock()
+	dials := append([]time.Time(nil), h.dials...)
+	h.mu.Unlock()
+	if len(dials) != 4 {
+		t.Fatalf("expected 4 dials, got %d", len(dials))
+	}
+	// Delays double from 20ms and are capped at 40ms.
+	for i, want := range []time.Duration{20, 40, 40} {
+		if gap := dials[i+1].Sub(dials[i]); gap < want*time.Millisecond {
+			t.Errorf("dial %d after %v, want at least %vms", i+1, gap, want)
+		}
+	}
+
+	// Static peers are admitted above MaxPeers and redialed on disconnect.
+	h.drop("good")
+	waitFor(t, func() bool { return h.dialCount() == 5 && m.Count() == 1 })
+
+	cancel()
+	<-done
+}
+
+func TestParsePeer(t *testing.T) {
+	p, err := ParsePeer("abc@127.0.0.1:9000")
+	if err != nil || p.ID != "abc" || p.Addr != "127.0.0.1:9000" {
+		t.Errorf("got %+v, %v", p, err)
+	}
+	if _, err := ParsePeer("127.0.0.1:9000"); err == nil {
+		t.Error("expected error without peer id")
+	}
+
+	key := make([]byte, 32)
+	rec := discover.NewRecord(ed25519.NewKeyFromSeed(key), 1, net.IPv4(127, 0, 0, 1), 9000, 9001)
+	p, err = ParsePeer(rec.String())
+	if err != nil || p.ID != rec.PeerID() || p.Addr != "127.0.0.1:9001" {
+		t.Errorf("got %+v, %v", p, err)
+	}
+}
@@ -0,0 +1,181 @@
+package reqresp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/codec"
+	"github.com/devlongs/gean/p2p/host"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+var (
+	ErrTimeout         = errors.New("reqresp: request timed out")
+	ErrInvalidResponse = errors.New("reqresp: invalid response")
+)
+
+func blockRoot(b *types.Block) types.Root {
+	return ssz.HashTreeRootBlock(b, types.AttestationsLimit)
+}
+
+// Client sends requests to peers.
+type Client struct {
+	host *host.Host
+	cfg  Config
+}
+
+func NewClient(h *host.Host, cfg Config) *Client {
+	return &Client{host: h, cfg: cfg}
+}
+
+// Status sends our status and returns the peer's.
+func (c *Client) Status(ctx context.Context, peer transport.PeerID, ours Status) (*Status, error) {
+	var remote Status
+	err := c.request(ctx, peer, ProtocolStatus, ours.MarshalSSZ(), func(r *bufio.Reader) error {
+		payload, err := readChunk(r, statusSize)
+		if err != nil {
+			return err
+		}
+		if err := remote.UnmarshalSSZ(payload); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &remote, nil
+}
+
+// BlocksByRoot fetches the requested blocks. Blocks the peer does not have
+// are simply missing from the result.
+func (c *Client) BlocksByRoot(ctx context.Context, peer transport.PeerID, roots []types.Root) ([]*types.SignedBlockWithAttestation, error) {
+	if len(roots) > MaxRequestBlocks {
+		return nil, fmt.Errorf("requesting %d blocks, limit %d", len(roots), MaxRequestBlocks)
+	}
+	wanted := make(map[types.Root]bool, len(roots))
+	for _, r := range roots {
+		wanted[r] = true
+	}
+
+	var blocks []*types.SignedBlockWithAttestation
+	err := c.request(ctx, peer, ProtocolBlocksByRoot, marshalRoots(roots), func(r *bufio.Reader) error {
+		return readBlocks(r, len(roots), func(b *types.SignedBlockWithAttestation) error {
+			root := blockRoot(&b.Message.Block)
+			if !wanted[root] {
+				return fmt.Errorf("%w: unrequested block %x", ErrInvalidResponse, root[:4])
+			}
+			delete(wanted, root)
+			blocks = append(blocks, b)
+			return nil
+		})
+	})
+	return blocks, err
+}
+
+// BlocksByRange fetches canonical blocks in [start, start+count). Responses
+// must be in ascending slot order and inside the range.
+func (c *Client) BlocksByRange(ctx context.Context, peer transport.PeerID, start types.Slot, count uint64) ([]*types.SignedBlockWithAttestation, error) {
+	if count == 0 || count > MaxRequestBlocks {
+		return nil, fmt.Errorf("count %d outside [1, %d]", count, MaxRequestBlocks)
+	}
+	req := BlocksByRangeRequest{StartSlot: start, Count: count}
+
+	var blocks []*types.SignedBlockWithAttestation
+	err := c.request(ctx, peer, ProtocolBlocksByRange, req.MarshalSSZ(), func(r *bufio.Reader) error {
+		return readBlocks(r, int(count), func(b *types.SignedBlockWithAttestation) error {
+			slot := b.Message.Block.Slot
+			if slot < start || uint64(slot-start) >= count {
+				return fmt.Errorf("%w: block slot %d outside requested range", ErrInvalidResponse, slot)
+			}
+			if n := len(blocks); n > 0 && slot <= blocks[n-1].Message.Block.Slot {
+				return fmt.Errorf("%w: block slots not ascending", ErrInvalidResponse)
+			}
+			blocks = append(blocks, b)
+			return nil
+		})
+	})
+	return blocks, err
+}
+
+func readBlocks(r *bufio.Reader, limit int, accept func(*types.SignedBlockWithAttestation) error) error {
+	for n := 0; ; n++ {
+		block, err := readBlock(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n >= limit {
+			return fmt.Errorf("%w: more than %d blocks", ErrInvalidResponse, limit)
+		}
+		if err := accept(block); err != nil {
+			return err
+		}
+	}
+}
+
+// request opens a stream, sends req and lets handle read the response while
+// enforcing the TTFB and response timeouts.
+func (c *Client) request(ctx context.Context, peer transport.PeerID, protocol string, req []byte, handle func(*bufio.Reader) error) error {
+	s, err := c.host.NewStream(peer, protocol)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var timedOut atomic.Bool
+	abort := func() {
+		timedOut.Store(true)
+		s.Reset()
+	}
+	ttfb := time.AfterFunc(c.cfg.TTFBTimeout, abort)
+	defer ttfb.Stop()
+	total := time.AfterFunc(c.cfg.RespTimeout, abort)
+	defer total.Stop()
+	stop := context.AfterFunc(ctx, func() { s.Reset() })
+	defer stop()
+
+	err = codec.WritePayload(s, req)
+	if err == nil {
+		err = s.CloseWrite()
+	}
+	if err == nil {
+		err = handle(bufio.NewReader(&firstByteReader{r: s, onFirst: func() { ttfb.Stop() }}))
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case timedOut.Load():
+		return ErrTimeout
+	default:
+		return err
+	}
+}
+
+// firstByteReader calls onFirst once data starts arriving.
+type firstByteReader struct {
+	r       io.Reader
+	onFirst func()
+	seen    bool
+}
+
+func (f *firstByteReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if n > 0 && !f.seen {
+		f.seen = true
+		f.onFirst()
+	}
+	return n, err
+}
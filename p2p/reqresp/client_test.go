@@ -0,0 +1,203 @@
+package reqresp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/codec"
+	"github.com/devlongs/gean/p2p/host"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+type testProvider struct {
+	status Status
+	blocks []*types.SignedBlockWithAttestation
+}
+
+func (p *testProvider) Status() Status { return p.status }
+
+func (p *testProvider) BlockByRoot(root types.Root) (*types.SignedBlockWithAttestation, bool) {
+	for _, b := range p.blocks {
+		if blockRoot(&b.Message.Block) == root {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+func (p *testProvider) BlocksByRange(start types.Slot, count uint64) []*types.SignedBlockWithAttestation {
+	var out []*types.SignedBlockWithAttestation
+	for _, b := range p.blocks {
+		if s := b.Message.Block.Slot; s >= start && uint64(s-start) < count {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func newBlock(slot types.Slot) *types.SignedBlockWithAttestation {
+	return &types.SignedBlockWithAttestation{
+		Message: types.BlockWithAttestation{
+			Block: types.Block{Slot: slot, ParentRoot: types.Root{byte(slot)}},
+		},
+		Signatures: []types.Bytes3116{{byte(slot)}},
+	}
+}
+
+func newHostPair(t *testing.T) (*host.Host, *host.Host) {
+	t.Helper()
+	var hosts []*host.Host
+	for _, id := range []transport.PeerID{"client", "server"} {
+		h := host.New(id, transport.NewTCP(id))
+		if err := h.Listen("127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		hosts = append(hosts, h)
+	}
+	if _, err := hosts[0].Connect(context.Background(), hosts[1].Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	return hosts[0], hosts[1]
+}
+
+func setup(t *testing.T) (*Client, *Server, *testProvider) {
+	t.Helper()
+	c, s := newHostPair(t)
+	p := &testProvider{
+		status: Status{
+			Finalized: types.Checkpoint{Root: types.Root{1}, Slot: 1},
+			Head:      types.Checkpoint{Root: types.Root{5}, Slot: 5},
+		},
+		blocks: []*types.SignedBlockWithAttestation{newBlock(1), newBlock(2), newBlock(4), newBlock(5)},
+	}
+	return NewClient(c, DefaultConfig()), NewServer(s, p, DefaultConfig()), p
+}
+
+func TestStatusExchange(t *testing.T) {
+	client, server, p := setup(t)
+	received := make(chan Status, 1)
+	server.OnStatus(func(peer transport.PeerID, s Status) {
+		if peer == "client" {
+			received <- s
+		}
+	})
+
+	ours := Status{Head: types.Checkpoint{Root: types.Root{9}, Slot: 2}}
+	got, err := client.Status(context.Background(), "server", ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != p.status {
+		t.Errorf("got status %+v, want %+v", *got, p.status)
+	}
+	if s := <-received; s != ours {
+		t.Errorf("server saw %+v, want %+v", s, ours)
+	}
+}
+
+func TestBlocksByRange(t *testing.T) {
+	client, _, _ := setup(t)
+
+	blocks, err := client.BlocksByRange(context.Background(), "server", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0].Message.Block.Slot != 2 || blocks[1].Message.Block.Slot != 4 {
+		t.Errorf("unexpected blocks %v", blocks)
+	}
+	if blocks[1].Signatures[0] != (types.Bytes3116{4}) {
+		t.Error("signature not preserved")
+	}
+
+	if _, err := client.BlocksByRange(context.Background(), "server", 0, MaxRequestBlocks+1); err == nil {
+		t.Error("expected error for oversized request")
+	}
+}
+
+func TestBlocksByRoot(t *testing.T) {
+	client, _, p := setup(t)
+
+	want := blockRoot(&p.blocks[2].Message.Block)
+	blocks, err := client.BlocksByRoot(context.Background(), "server", []types.Root{want, {0xff}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0].Message.Block.Slot != 4 {
+		t.Errorf("unexpected blocks %v", blocks)
+	}
+}
+
+func TestServerRejectsInvalidRequest(t *testing.T) {
+	c, s := newHostPair(t)
+	server := NewServer(s, &testProvider{}, DefaultConfig())
+	reported := make(chan transport.PeerID, 1)
+	server.OnInvalidRequest(func(peer transport.PeerID) { reported <- peer })
+
+	st, err := c.NewStream("server", ProtocolBlocksByRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := BlocksByRangeRequest{StartSlot: 0, Count: MaxRequestBlocks + 1}
+	codec.WritePayload(st, req.MarshalSSZ())
+	st.CloseWrite()
+
+	_, err = readChunk(bufio.NewReader(st), maxErrorMessageSize)
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.Code != CodeInvalidRequest {
+		t.Errorf("expected invalid request, got %v", err)
+	}
+	if peer := <-reported; peer != "client" {
+		t.Errorf("invalid request reported for %s", peer)
+	}
+}
+
+func TestClientRejectsBadResponses(t *testing.T) {
+	c, s := newHostPair(t)
+	client := NewClient(c, DefaultConfig())
+
+	// Out of range and unrequested blocks.
+	s.SetStreamHandler(ProtocolBlocksByRange, func(_ transport.PeerID, st transport.Stream) {
+		defer st.Close()
+		codec.ReadPayload(bufio.NewReader(st), blocksByRangeRequestSize)
+		writeBlock(st, newBlock(9))
+	})
+	if _, err := client.BlocksByRange(context.Background(), "server", 1, 4); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected invalid response for out of range block, got %v", err)
+	}
+
+	s.SetStreamHandler(ProtocolBlocksByRoot, func(_ transport.PeerID, st transport.Stream) {
+		defer st.Close()
+		codec.ReadPayload(bufio.NewReader(st), MaxRequestBlocks*32)
+		writeBlock(st, newBlock(3))
+	})
+	if _, err := client.BlocksByRoot(context.Background(), "server", []types.Root{{1}}); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected invalid response for unrequested block, got %v", err)
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	c, s := newHostPair(t)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	s.SetStreamHandler(ProtocolStatus, func(_ transport.PeerID, st transport.Stream) {
+		<-release
+		st.Close()
+	})
+
+	client := NewClient(c, Config{TTFBTimeout: 50 * time.Millisecond, RespTimeout: time.Second})
+	if _, err := client.Status(context.Background(), "server", Status{}); err != ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+
+	client = NewClient(c, DefaultConfig())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Status(ctx, "server", Status{}); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
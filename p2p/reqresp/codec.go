@@ -0,0 +1,115 @@
+package reqresp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/p2p/codec"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+// ResponseCode is the result byte preceding every response chunk.
+type ResponseCode byte
+
+const (
+	CodeSuccess             ResponseCode = 0
+	CodeInvalidRequest      ResponseCode = 1
+	CodeServerError         ResponseCode = 2
+	CodeResourceUnavailable ResponseCode = 3
+)
+
+func (c ResponseCode) String() string {
+	switch c {
+	case CodeSuccess:
+		return "success"
+	case CodeInvalidRequest:
+		return "invalid request"
+	case CodeServerError:
+		return "server error"
+	case CodeResourceUnavailable:
+		return "resource unavailable"
+	default:
+		return fmt.Sprintf("code %d", byte(c))
+	}
+}
+
+// maxErrorMessageSize bounds the error string sent with a non-success code.
+const maxErrorMessageSize = 256
+
+// ResponseError is a non-success response from a peer.
+type ResponseError struct {
+	Code    ResponseCode
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func writeChunk(w io.Writer, code ResponseCode, payload []byte) error {
+	if _, err := w.Write([]byte{byte(code)}); err != nil {
+		return err
+	}
+	return codec.WritePayload(w, payload)
+}
+
+func writeBlock(w io.Writer, b *types.SignedBlockWithAttestation) error {
+	if _, err := w.Write([]byte{byte(CodeSuccess)}); err != nil {
+		return err
+	}
+	return codec.WriteBlock(w, b)
+}
+
+func writeError(w io.Writer, code ResponseCode, msg string) error {
+	if len(msg) > maxErrorMessageSize {
+		msg = msg[:maxErrorMessageSize]
+	}
+	return writeChunk(w, code, []byte(msg))
+}
+
+// readResult reads the result byte of the next response chunk. It returns
+// io.EOF when the responder closed the stream cleanly between chunks, and a
+// *ResponseError for non-success codes.
+func readResult(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if ResponseCode(code) != CodeSuccess {
+		msg, err := codec.ReadPayload(r, maxErrorMessageSize)
+		if err != nil {
+			return fmt.Errorf("read error message: %w", err)
+		}
+		return &ResponseError{Code: ResponseCode(code), Message: string(msg)}
+	}
+	return nil
+}
+
+// readChunk reads a response chunk with readResult semantics.
+func readChunk(r *bufio.Reader, maxSize int) ([]byte, error) {
+	if err := readResult(r); err != nil {
+		return nil, err
+	}
+	payload, err := codec.ReadPayload(r, maxSize)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return payload, err
+}
+
+func readBlock(r *bufio.Reader) (*types.SignedBlockWithAttestation, error) {
+	if err := readResult(r); err != nil {
+		return nil, err
+	}
+	b, err := codec.ReadBlock(r)
+	switch {
+	case err == io.EOF:
+		err = io.ErrUnexpectedEOF
+	case err != nil && err != io.ErrUnexpectedEOF && !errors.Is(err, transport.ErrStreamReset):
+		err = fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return b, err
+}
@@ -0,0 +1,74 @@
+package reqresp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	big := bytes.Repeat([]byte("lean"), 50000)
+	writeChunk(&buf, CodeSuccess, []byte("first"))
+	writeChunk(&buf, CodeSuccess, nil)
+	writeChunk(&buf, CodeSuccess, big)
+	writeError(&buf, CodeResourceUnavailable, "no blocks")
+
+	r := bufio.NewReader(&buf)
+	for _, want := range [][]byte{[]byte("first"), {}, big} {
+		got, err := readChunk(r, len(big))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("chunk mismatch: got %d bytes, want %d", len(got), len(want))
+		}
+	}
+
+	_, err := readChunk(r, len(big))
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.Code != CodeResourceUnavailable || respErr.Message != "no blocks" {
+		t.Errorf("expected resource unavailable error, got %v", err)
+	}
+	if _, err := readChunk(r, len(big)); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestReadChunkTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	writeChunk(&buf, CodeSuccess, []byte("some payload"))
+	data := buf.Bytes()[:buf.Len()-3]
+	if _, err := readChunk(bufio.NewReader(bytes.NewReader(data)), 100); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+}
+
+func TestMessagesRoundTrip(t *testing.T) {
+	s := Status{
+		Finalized: types.Checkpoint{Root: types.Root{1}, Slot: 3},
+		Head:      types.Checkpoint{Root: types.Root{2}, Slot: 9},
+	}
+	var got Status
+	if err := got.UnmarshalSSZ(s.MarshalSSZ()); err != nil || got != s {
+		t.Errorf("status round trip: %+v, %v", got, err)
+	}
+
+	req := BlocksByRangeRequest{StartSlot: 5, Count: 64}
+	var gotReq BlocksByRangeRequest
+	if err := gotReq.UnmarshalSSZ(req.MarshalSSZ()); err != nil || gotReq != req {
+		t.Errorf("range request round trip: %+v, %v", gotReq, err)
+	}
+
+	roots := []types.Root{{1}, {2}, {3}}
+	if _, err := unmarshalRoots(marshalRoots(roots), 2); err == nil {
+		t.Error("expected error above root limit")
+	}
+	if _, err := unmarshalRoots(marshalRoots(roots)[:40], 8); err == nil {
+		t.Error("expected error for partial root")
+	}
+}
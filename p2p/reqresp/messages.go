@@ -0,0 +1,76 @@
+package reqresp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+)
+
+// Status is exchanged on connect so peers can decide whether to sync.
+type Status struct {
+	Finalized types.Checkpoint
+	Head      types.Checkpoint
+}
+
+const statusSize = 2 * ssz.CheckpointSize
+
+func (s *Status) MarshalSSZ() []byte {
+	return append(ssz.MarshalCheckpoint(&s.Finalized), ssz.MarshalCheckpoint(&s.Head)...)
+}
+
+func (s *Status) UnmarshalSSZ(data []byte) error {
+	if len(data) != statusSize {
+		return fmt.Errorf("status: expected %d bytes, got %d", statusSize, len(data))
+	}
+	finalized, _ := ssz.UnmarshalCheckpoint(data[:ssz.CheckpointSize])
+	head, _ := ssz.UnmarshalCheckpoint(data[ssz.CheckpointSize:])
+	s.Finalized, s.Head = *finalized, *head
+	return nil
+}
+
+// BlocksByRangeRequest asks for canonical blocks in [StartSlot, StartSlot+Count).
+type BlocksByRangeRequest struct {
+	StartSlot types.Slot
+	Count     uint64
+}
+
+const blocksByRangeRequestSize = 16
+
+func (r *BlocksByRangeRequest) MarshalSSZ() []byte {
+	buf := binary.LittleEndian.AppendUint64(nil, uint64(r.StartSlot))
+	return binary.LittleEndian.AppendUint64(buf, r.Count)
+}
+
+func (r *BlocksByRangeRequest) UnmarshalSSZ(data []byte) error {
+	if len(data) != blocksByRangeRequestSize {
+		return fmt.Errorf("blocks by range request: expected %d bytes, got %d", blocksByRangeRequestSize, len(data))
+	}
+	r.StartSlot = types.Slot(binary.LittleEndian.Uint64(data))
+	r.Count = binary.LittleEndian.Uint64(data[8:])
+	return nil
+}
+
+// marshalRoots encodes a BlocksByRoot request: a list of roots.
+func marshalRoots(roots []types.Root) []byte {
+	buf := make([]byte, 0, len(roots)*32)
+	for _, r := range roots {
+		buf = append(buf, r[:]...)
+	}
+	return buf
+}
+
+func unmarshalRoots(data []byte, limit int) ([]types.Root, error) {
+	if len(data)%32 != 0 {
+		return nil, fmt.Errorf("roots: length %d not a multiple of 32", len(data))
+	}
+	if len(data)/32 > limit {
+		return nil, fmt.Errorf("roots: %d requested, limit %d", len(data)/32, limit)
+	}
+	roots := make([]types.Root, len(data)/32)
+	for i := range roots {
+		copy(roots[i][:], data[i*32:])
+	}
+	return roots, nil
+}
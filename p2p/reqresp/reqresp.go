@@ -0,0 +1,45 @@
+// Package reqresp implements the request/response protocols: Status,
+// BlocksByRoot and BlocksByRange.
+//
+// A request is a varint SSZ length followed by the snappy framed payload.
+// The response is a sequence of chunks, each a result byte followed by a
+// payload encoded the same way. Non-success chunks carry an error message.
+package reqresp
+
+import (
+	"time"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+const (
+	ProtocolStatus        = "/leanconsensus/req/status/1/ssz_snappy"
+	ProtocolBlocksByRoot  = "/leanconsensus/req/blocks_by_root/1/ssz_snappy"
+	ProtocolBlocksByRange = "/leanconsensus/req/blocks_by_range/1/ssz_snappy"
+)
+
+// MaxRequestBlocks bounds the blocks requested or returned at once.
+const MaxRequestBlocks = 1024
+
+type Config struct {
+	// TTFBTimeout is how long to wait for the first response byte.
+	TTFBTimeout time.Duration
+	// RespTimeout bounds a whole request, including all response chunks.
+	RespTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		TTFBTimeout: 5 * time.Second,
+		RespTimeout: 10 * time.Second,
+	}
+}
+
+// Provider serves the data peers request from us.
+type Provider interface {
+	Status() Status
+	BlockByRoot(root types.Root) (*types.SignedBlockWithAttestation, bool)
+	// BlocksByRange returns canonical blocks with slots in
+	// [start, start+count) in ascending slot order, skipping empty slots.
+	BlocksByRange(start types.Slot, count uint64) []*types.SignedBlockWithAttestation
+}
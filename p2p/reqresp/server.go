@@ -0,0 +1,125 @@
+package reqresp
+
+import (
+	"bufio"
+	"sync"
+	"time"
+
+	"github.com/devlongs/gean/p2p/codec"
+	"github.com/devlongs/gean/p2p/host"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+// Server answers requests from peers using a Provider.
+type Server struct {
+	provider Provider
+	cfg      Config
+
+	mu        sync.Mutex
+	onStatus  func(peer transport.PeerID, status Status)
+	onInvalid func(peer transport.PeerID)
+}
+
+// NewServer registers the protocol handlers on h.
+func NewServer(h *host.Host, p Provider, cfg Config) *Server {
+	s := &Server{provider: p, cfg: cfg}
+	h.SetStreamHandler(ProtocolStatus, s.handleStatus)
+	h.SetStreamHandler(ProtocolBlocksByRoot, s.handleBlocksByRoot)
+	h.SetStreamHandler(ProtocolBlocksByRange, s.handleBlocksByRange)
+	return s
+}
+
+// OnStatus registers a callback for the statuses peers send us.
+func (s *Server) OnStatus(fn func(peer transport.PeerID, status Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onStatus = fn
+}
+
+// OnInvalidRequest registers a callback for peers sending invalid requests.
+func (s *Server) OnInvalidRequest(fn func(peer transport.PeerID)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onInvalid = fn
+}
+
+func (s *Server) invalid(peer transport.PeerID, st transport.Stream, msg string) {
+	writeError(st, CodeInvalidRequest, msg)
+	s.mu.Lock()
+	onInvalid := s.onInvalid
+	s.mu.Unlock()
+	if onInvalid != nil {
+		onInvalid(peer)
+	}
+}
+
+// serve reads the request with the response timeout armed and hands it to
+// respond. The stream is closed afterwards.
+func (s *Server) serve(peer transport.PeerID, st transport.Stream, maxRequest int, respond func(req []byte)) {
+	timer := time.AfterFunc(s.cfg.RespTimeout, func() { st.Reset() })
+	defer timer.Stop()
+	defer st.Close()
+
+	req, err := codec.ReadPayload(bufio.NewReader(st), maxRequest)
+	if err != nil {
+		s.invalid(peer, st, err.Error())
+		return
+	}
+	respond(req)
+}
+
+func (s *Server) handleStatus(peer transport.PeerID, st transport.Stream) {
+	s.serve(peer, st, statusSize, func(req []byte) {
+		var remote Status
+		if err := remote.UnmarshalSSZ(req); err != nil {
+			s.invalid(peer, st, err.Error())
+			return
+		}
+		s.mu.Lock()
+		onStatus := s.onStatus
+		s.mu.Unlock()
+		if onStatus != nil {
+			onStatus(peer, remote)
+		}
+		ours := s.provider.Status()
+		writeChunk(st, CodeSuccess, ours.MarshalSSZ())
+	})
+}
+
+func (s *Server) handleBlocksByRoot(peer transport.PeerID, st transport.Stream) {
+	s.serve(peer, st, MaxRequestBlocks*32, func(req []byte) {
+		roots, err := unmarshalRoots(req, MaxRequestBlocks)
+		if err != nil {
+			s.invalid(peer, st, err.Error())
+			return
+		}
+		for _, root := range roots {
+			block, ok := s.provider.BlockByRoot(root)
+			if !ok {
+				continue
+			}
+			if err := writeBlock(st, block); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func (s *Server) handleBlocksByRange(peer transport.PeerID, st transport.Stream) {
+	s.serve(peer, st, blocksByRangeRequestSize, func(req []byte) {
+		var r BlocksByRangeRequest
+		if err := r.UnmarshalSSZ(req); err != nil {
+			s.invalid(peer, st, err.Error())
+			return
+		}
+		if r.Count == 0 || r.Count > MaxRequestBlocks {
+			s.invalid(peer, st, "count must be between 1 and 1024")
+			return
+		}
+		for _, block := range s.provider.BlocksByRange(r.StartSlot, r.Count) {
+			if err := writeBlock(st, block); err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrHandshake is returned when a peer fails to prove its peer ID.
+var ErrHandshake = errors.New("transport: handshake failed")
+
+const (
+	nonceLen = 32
+
+	// handshakeDomain separates handshake signatures from anything else
+	// signed with the node key.
+	handshakeDomain = "gean-handshake-v1"
+)
+
+// PubkeyToPeerID returns the peer ID of a node key: the hex-encoded SHA-256
+// of the public key, as used by node records.
+func PubkeyToPeerID(pub ed25519.PublicKey) PeerID {
+	h := sha256.Sum256(pub)
+	return PeerID(hex.EncodeToString(h[:]))
+}
+
+// hello exchanges self-declared peer IDs.
+func (c *conn) hello() (PeerID, error) {
+	if err := c.writeFrame(frameHello, 0, []byte(c.local)); err != nil {
+		return "", err
+	}
+	payload, err := c.expect(frameHello)
+	if err != nil {
+		return "", err
+	}
+	if len(payload) == 0 {
+		return "", fmt.Errorf("%w: empty peer ID", ErrHandshake)
+	}
+	return PeerID(payload), nil
+}
+
+// authHandshake proves the peer IDs of both sides. Each side sends a random
+// challenge in its hello frame and answers the other's challenge with its
+// public key and a signature over it, which also covers the signer's role
+// so a signature cannot be reflected back on another connection. The peer
+// ID is derived from the public key.
+//
+// The handshake authenticates peers but does not encrypt or bind the
+// connection; an active man in the middle can still take over after it.
+func (c *conn) authHandshake(key ed25519.PrivateKey, dialer bool) (PeerID, error) {
+	ours := make([]byte, nonceLen)
+	if _, err := rand.Read(ours); err != nil {
+		return "", err
+	}
+	if err := c.writeFrame(frameHello, 0, ours); err != nil {
+		return "", err
+	}
+	theirs, err := c.expect(frameHello)
+	if err != nil {
+		return "", err
+	}
+	if len(theirs) != nonceLen || bytes.Equal(theirs, ours) {
+		return "", fmt.Errorf("%w: invalid challenge", ErrHandshake)
+	}
+
+	pub := key.Public().(ed25519.PublicKey)
+	auth := append(append([]byte(nil), pub...), ed25519.Sign(key, handshakeMessage(dialer, theirs))...)
+	if err := c.writeFrame(frameAuth, 0, auth); err != nil {
+		return "", err
+	}
+	payload, err := c.expect(frameAuth)
+	if err != nil {
+		return "", err
+	}
+	if len(payload) != ed25519.PublicKeySize+ed25519.SignatureSize {
+		return "", fmt.Errorf("%w: invalid auth frame", ErrHandshake)
+	}
+	remote := ed25519.PublicKey(payload[:ed25519.PublicKeySize])
+	if !ed25519.Verify(remote, handshakeMessage(!dialer, ours), payload[ed25519.PublicKeySize:]) {
+		return "", fmt.Errorf("%w: bad signature", ErrHandshake)
+	}
+	return PubkeyToPeerID(remote), nil
+}
+
+func handshakeMessage(dialer bool, challenge []byte) []byte {
+	role := byte(0)
+	if dialer {
+		role = 1
+	}
+	msg := append([]byte(handshakeDomain), role)
+	return append(msg, challenge...)
+}
+
+// expect reads the next frame and checks its type.
+func (c *conn) expect(typ byte) ([]byte, error) {
+	got, _, payload, err := c.readFrame()
+	if err != nil {
+		return nil, fmt.Errorf("read handshake: %w", err)
+	}
+	if got != typ {
+		return nil, fmt.Errorf("%w: expected frame type %d, got %d", ErrHandshake, typ, got)
+	}
+	return payload, nil
+}
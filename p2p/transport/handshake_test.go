@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func testNodeKey(seed byte) ed25519.PrivateKey {
+	s := make([]byte, ed25519.SeedSize)
+	s[0] = seed
+	return ed25519.NewKeyFromSeed(s)
+}
+
+func TestAuthenticatedHandshake(t *testing.T) {
+	lt := NewAuthenticatedTCP(testNodeKey(1))
+	dt := NewAuthenticatedTCP(testNodeKey(2))
+	l, err := lt.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := dt.Dial(ctx, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+
+	if client.RemotePeer() != lt.ID() || server.RemotePeer() != dt.ID() {
+		t.Errorf("peer IDs: %q %q", client.RemotePeer(), server.RemotePeer())
+	}
+}
+
+// fakePeer runs the authenticated handshake against addr but answers with
+// the public key of claimed, which it cannot sign for.
+func fakePeer(t *testing.T, addr string, claimed ed25519.PrivateKey) {
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer nc.Close()
+	c := &conn{nc: nc, w: bufio.NewWriter(nc), r: bufio.NewReader(nc)}
+	c.writeFrame(frameHello, 0, make([]byte, nonceLen))
+	theirs, err := c.expect(frameHello)
+	if err != nil {
+		return
+	}
+	forged := ed25519.Sign(testNodeKey(9), handshakeMessage(true, theirs))
+	pub := claimed.Public().(ed25519.PublicKey)
+	c.writeFrame(frameAuth, 0, append(append([]byte(nil), pub...), forged...))
+	c.expect(frameAuth)
+}
+
+func TestHandshakeRejectsImpersonation(t *testing.T) {
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nl.Close()
+	go fakePeer(t, nl.Addr().String(), testNodeKey(1))
+
+	nc, err := nl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newConn(nc, "", testNodeKey(2), false); !errors.Is(err, ErrHandshake) {
+		t.Errorf("expected ErrHandshake, got %v", err)
+	}
+}
+
+func TestHandshakeRequiresKeys(t *testing.T) {
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nl.Close()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if c, err := NewTCP("anyone").Dial(ctx, nl.Addr().String()); err == nil {
+			c.Close()
+		}
+	}()
+
+	nc, err := nl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newConn(nc, "", testNodeKey(1), false); !errors.Is(err, ErrHandshake) {
+		t.Errorf("a peer without a key should fail the handshake, got %v", err)
+	}
+}
@@ -0,0 +1,490 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/devlongs/gean/common/snappy"
+)
+
+// Frame types of the multiplexing protocol.
+//
+// Each frame is: type (1 byte) | stream ID (uvarint) | length (uvarint) |
+// payload. Data payloads are snappy-compressed. A window frame carries the
+// number of bytes (uvarint) the reader has consumed since its last update.
+const (
+	frameHello = iota
+	frameOpen
+	frameData
+	frameClose
+	frameReset
+	frameWindow
+	frameAuth
+)
+
+const (
+	// MaxFrameSize bounds both the wire and the decompressed payload size.
+	MaxFrameSize = 1 << 20
+
+	// maxWriteChunk is the largest data payload written in one frame.
+	maxWriteChunk = 64 * 1024
+
+	// streamWindow is how many bytes may be sent on a stream before the
+	// reader consumes them. The reader returns credit once it has consumed
+	// half of it.
+	streamWindow = 256 * 1024
+
+	// maxPendingAccepts bounds the streams waiting for AcceptStream. Further
+	// streams are reset.
+	maxPendingAccepts = 64
+
+	handshakeTimeout = 5 * time.Second
+)
+
+// conn multiplexes streams over a net.Conn. Streams opened by the dialer
+// have odd IDs, streams opened by the listener even IDs, and each side
+// opens them in increasing order. A peer that breaks these rules or
+// overruns a stream window is disconnected.
+type conn struct {
+	nc     net.Conn
+	local  PeerID
+	remote PeerID
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+	r   *bufio.Reader
+
+	mu         sync.Mutex
+	streams    map[uint64]*stream
+	nextID     uint64
+	lastRemote uint64 // highest stream ID opened by the peer
+	accept     chan *stream
+	closed     chan struct{}
+	closeErr   error
+	once       sync.Once
+
+	// resets queues streams to reset on behalf of readLoop, which must not
+	// block on writes.
+	resets chan uint64
+}
+
+// newConn runs the handshake and starts reading frames. With a key the
+// peers prove their IDs; without one they are taken on trust.
+func newConn(nc net.Conn, local PeerID, key ed25519.PrivateKey, dialer bool) (*conn, error) {
+	c := &conn{
+		nc:      nc,
+		local:   local,
+		w:       bufio.NewWriter(nc),
+		r:       bufio.NewReader(nc),
+		streams: make(map[uint64]*stream),
+		accept:  make(chan *stream, maxPendingAccepts),
+		closed:  make(chan struct{}),
+		resets:  make(chan uint64, maxPendingAccepts),
+	}
+	if dialer {
+		c.nextID = 1
+	} else {
+		c.nextID = 2
+	}
+
+	nc.SetDeadline(time.Now().Add(handshakeTimeout))
+	var err error
+	if key != nil {
+		c.remote, err = c.authHandshake(key, dialer)
+	} else {
+		c.remote, err = c.hello()
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+
+	go c.readLoop()
+	go c.resetLoop()
+	return c, nil
+}
+
+func (c *conn) LocalPeer() PeerID    { return c.local }
+func (c *conn) RemotePeer() PeerID   { return c.remote }
+func (c *conn) RemoteAddr() net.Addr { return c.nc.RemoteAddr() }
+
+func (c *conn) Close() error {
+	c.shutdown(ErrClosed)
+	return nil
+}
+
+func (c *conn) shutdown(err error) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.closeErr = err
+		streams := c.streams
+		c.streams = make(map[uint64]*stream)
+		c.mu.Unlock()
+
+		close(c.closed)
+		c.nc.Close()
+		for _, s := range streams {
+			s.fail(err)
+		}
+	})
+}
+
+func (c *conn) OpenStream(protocol string) (Stream, error) {
+	c.mu.Lock()
+	if c.closeErr != nil {
+		c.mu.Unlock()
+		return nil, c.closeErr
+	}
+	id := c.nextID
+	c.nextID += 2
+	s := newStream(c, id, protocol)
+	c.streams[id] = s
+	c.mu.Unlock()
+
+	if err := c.writeFrame(frameOpen, id, []byte(protocol)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *conn) AcceptStream() (Stream, error) {
+	select {
+	case s := <-c.accept:
+		return s, nil
+	case <-c.closed:
+		return nil, c.closeErr
+	}
+}
+
+func (c *conn) writeFrame(typ byte, id uint64, payload []byte) error {
+	if typ == frameData {
+		payload = snappy.Encode(payload)
+	}
+	if len(payload) > MaxFrameSize {
+		return ErrFrameTooLong
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	var hdr [1 + 2*binary.MaxVarintLen64]byte
+	hdr[0] = typ
+	n := 1 + binary.PutUvarint(hdr[1:], id)
+	n += binary.PutUvarint(hdr[n:], uint64(len(payload)))
+	if _, err := c.w.Write(hdr[:n]); err != nil {
+		return err
+	}
+	if _, err := c.w.Write(payload); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *conn) readFrame() (byte, uint64, []byte, error) {
+	typ, err := c.r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	id, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	length, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if length > MaxFrameSize {
+		return 0, 0, nil, ErrFrameTooLong
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if typ == frameData {
+		if payload, err = snappy.Decode(payload, MaxFrameSize); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	return typ, id, payload, nil
+}
+
+// readLoop dispatches incoming frames. It never blocks on a stream or on
+// the application: data is buffered within the stream window and streams
+// nobody accepts in time are reset.
+func (c *conn) readLoop() {
+	for {
+		typ, id, payload, err := c.readFrame()
+		if err == nil {
+			err = c.handleFrame(typ, id, payload)
+		}
+		if err != nil {
+			c.shutdown(fmt.Errorf("%w: %v", ErrClosed, err))
+			return
+		}
+	}
+}
+
+func (c *conn) handleFrame(typ byte, id uint64, payload []byte) error {
+	if typ == frameOpen {
+		return c.handleOpen(id, string(payload))
+	}
+	c.mu.Lock()
+	s := c.streams[id]
+	c.mu.Unlock()
+	if s == nil {
+		// The stream was closed or reset here; frames already in flight
+		// are dropped.
+		return nil
+	}
+	switch typ {
+	case frameData:
+		return s.push(payload)
+	case frameClose:
+		s.remoteClosed()
+	case frameReset:
+		s.fail(ErrStreamReset)
+		c.forget(id)
+	case frameWindow:
+		n, k := binary.Uvarint(payload)
+		if k <= 0 || k != len(payload) {
+			return fmt.Errorf("stream %d: invalid window update", id)
+		}
+		return s.grant(n)
+	}
+	return nil
+}
+
+// handleOpen registers a stream opened by the peer. The peer may only use
+// IDs of its own parity, in increasing order, so it can never take over one
+// of our streams or revive a closed one.
+func (c *conn) handleOpen(id uint64, protocol string) error {
+	c.mu.Lock()
+	if id%2 == c.nextID%2 || id <= c.lastRemote {
+		c.mu.Unlock()
+		return fmt.Errorf("peer opened invalid stream %d", id)
+	}
+	c.lastRemote = id
+	s := newStream(c, id, protocol)
+	c.streams[id] = s
+	c.mu.Unlock()
+
+	select {
+	case c.accept <- s:
+	default:
+		s.fail(ErrStreamReset)
+		c.forget(id)
+		c.queueReset(id)
+	}
+	return nil
+}
+
+// queueReset asks resetLoop to reset the stream. If the queue is full the
+// peer is not reading and the reset is dropped; the stream is forgotten
+// either way.
+func (c *conn) queueReset(id uint64) {
+	select {
+	case c.resets <- id:
+	default:
+	}
+}
+
+func (c *conn) resetLoop() {
+	for {
+		select {
+		case id := <-c.resets:
+			c.writeFrame(frameReset, id, nil)
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *conn) forget(id uint64) {
+	c.mu.Lock()
+	delete(c.streams, id)
+	c.mu.Unlock()
+}
+
+// stream buffers incoming data until it is read. Each direction has a
+// window of streamWindow bytes: the writer blocks once it has sent that much
+// without credit, and the reader returns credit as it consumes data.
+type stream struct {
+	c        *conn
+	id       uint64
+	protocol string
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	buf         []byte
+	unacked     int    // bytes read but not yet credited to the writer
+	sendWindow  uint64 // bytes we may still send
+	readClosed  bool   // remote sent close
+	writeClosed bool
+	err         error
+}
+
+func newStream(c *conn, id uint64, protocol string) *stream {
+	s := &stream{c: c, id: id, protocol: protocol, sendWindow: streamWindow}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *stream) Protocol() string { return s.protocol }
+
+// push buffers data from the peer, which must stay within the window.
+func (s *stream) push(data []byte) error {
+	s.mu.Lock()
+	if len(s.buf)+s.unacked+len(data) > streamWindow {
+		s.mu.Unlock()
+		return fmt.Errorf("stream %d exceeded its window", s.id)
+	}
+	if s.err == nil {
+		s.buf = append(s.buf, data...)
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	return nil
+}
+
+// grant returns n bytes of credit to the writer.
+func (s *stream) grant(n uint64) error {
+	s.mu.Lock()
+	if n > streamWindow-s.sendWindow {
+		s.mu.Unlock()
+		return fmt.Errorf("stream %d: window update beyond the window", s.id)
+	}
+	s.sendWindow += n
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	return nil
+}
+
+func (s *stream) remoteClosed() {
+	s.mu.Lock()
+	s.readClosed = true
+	done := s.writeClosed
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	if done {
+		s.c.forget(s.id)
+	}
+}
+
+func (s *stream) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// Read returns buffered data. Once the peer has closed its side, a later
+// reset only aborts our writes and reads still end with io.EOF.
+func (s *stream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	for len(s.buf) == 0 {
+		switch {
+		case s.readClosed:
+			s.mu.Unlock()
+			return 0, io.EOF
+		case s.err != nil:
+			err := s.err
+			s.mu.Unlock()
+			return 0, err
+		}
+		s.cond.Wait()
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	s.unacked += n
+	var credit int
+	if s.unacked >= streamWindow/2 && !s.readClosed {
+		credit, s.unacked = s.unacked, 0
+	}
+	s.mu.Unlock()
+
+	if credit > 0 {
+		var b [binary.MaxVarintLen64]byte
+		s.c.writeFrame(frameWindow, s.id, b[:binary.PutUvarint(b[:], uint64(credit))])
+	}
+	return n, nil
+}
+
+// Write sends p, blocking while the stream window is exhausted.
+func (s *stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		s.mu.Lock()
+		for s.err == nil && !s.writeClosed && s.sendWindow == 0 {
+			s.cond.Wait()
+		}
+		err := s.err
+		if err == nil && s.writeClosed {
+			err = ErrClosed
+		}
+		n := min(len(p), maxWriteChunk, int(s.sendWindow))
+		if err == nil {
+			s.sendWindow -= uint64(n)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return written, err
+		}
+
+		if err := s.c.writeFrame(frameData, s.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (s *stream) CloseWrite() error {
+	s.mu.Lock()
+	if s.writeClosed || s.err != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	s.writeClosed = true
+	done := s.readClosed
+	s.mu.Unlock()
+
+	if done {
+		s.c.forget(s.id)
+	}
+	return s.c.writeFrame(frameClose, s.id, nil)
+}
+
+// Close closes the write side and discards anything still unread. If the
+// peer has not finished writing, the stream is also reset so that its
+// writes fail instead of waiting for credit that never comes.
+func (s *stream) Close() error {
+	err := s.CloseWrite()
+	s.mu.Lock()
+	unfinished := !s.readClosed && s.err == nil
+	s.buf = nil
+	s.mu.Unlock()
+	s.fail(ErrClosed)
+	s.c.forget(s.id)
+	if unfinished {
+		if rerr := s.c.writeFrame(frameReset, s.id, nil); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+func (s *stream) Reset() error {
+	s.fail(ErrStreamReset)
+	s.c.forget(s.id)
+	return s.c.writeFrame(frameReset, s.id, nil)
+}
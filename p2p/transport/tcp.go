@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net"
+)
+
+// TCP is a Transport over plain TCP connections, intended for local devnets.
+type TCP struct {
+	id     PeerID
+	key    ed25519.PrivateKey
+	dialer net.Dialer
+}
+
+// NewTCP returns a transport whose peers declare their IDs without proof.
+// It suits tests only: any peer can claim any ID.
+func NewTCP(id PeerID) *TCP {
+	return &TCP{id: id}
+}
+
+// NewAuthenticatedTCP returns a transport identified by the node key. Both
+// sides of a connection prove their peer IDs, see PubkeyToPeerID.
+func NewAuthenticatedTCP(key ed25519.PrivateKey) *TCP {
+	return &TCP{id: PubkeyToPeerID(key.Public().(ed25519.PublicKey)), key: key}
+}
+
+// ID returns the local peer ID.
+func (t *TCP) ID() PeerID { return t.id }
+
+func (t *TCP) Dial(ctx context.Context, addr string) (Conn, error) {
+	nc, err := t.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(nc, t.id, t.key, true)
+}
+
+// maxPendingHandshakes bounds the inbound connections in the handshake or
+// waiting for Accept. Further connections wait in the kernel backlog.
+const maxPendingHandshakes = 64
+
+func (t *TCP) Listen(addr string) (Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tl := &tcpListener{
+		l:       l,
+		t:       t,
+		pending: make(chan struct{}, maxPendingHandshakes),
+		conns:   make(chan Conn),
+		done:    make(chan struct{}),
+	}
+	go tl.acceptLoop()
+	return tl, nil
+}
+
+// tcpListener runs the handshakes of inbound connections concurrently, so
+// that a slow or silent peer does not hold up the others, and hands the
+// connections that complete it to Accept.
+type tcpListener struct {
+	l       net.Listener
+	t       *TCP
+	pending chan struct{}
+	conns   chan Conn
+
+	done chan struct{} // closed with err set once the listener fails
+	err  error
+}
+
+func (l *tcpListener) acceptLoop() {
+	for {
+		l.pending <- struct{}{}
+		nc, err := l.l.Accept()
+		if err != nil {
+			l.err = err
+			close(l.done)
+			return
+		}
+		go l.handshake(nc)
+	}
+}
+
+func (l *tcpListener) handshake(nc net.Conn) {
+	defer func() { <-l.pending }()
+	c, err := newConn(nc, l.t.id, l.t.key, false)
+	if err != nil {
+		return
+	}
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+// Accept returns the next connection that completes the handshake.
+func (l *tcpListener) Accept() (Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *tcpListener) Addr() net.Addr { return l.l.Addr() }
+func (l *tcpListener) Close() error   { return l.l.Close() }
@@ -0,0 +1,330 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connect returns a dialed and an accepted connection over loopback.
+func connect(t *testing.T) (Conn, Conn) {
+	t.Helper()
+	l, err := NewTCP("listener").Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	accepted := make(chan Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- c
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dialed, err := NewTCP("dialer").Dial(ctx, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-accepted
+	t.Cleanup(func() {
+		dialed.Close()
+		server.Close()
+	})
+	return dialed, server
+}
+
+func TestPeerIDExchange(t *testing.T) {
+	client, server := connect(t)
+	if client.RemotePeer() != "listener" || server.RemotePeer() != "dialer" {
+		t.Errorf("peer IDs: %q %q", client.RemotePeer(), server.RemotePeer())
+	}
+	if client.LocalPeer() != "dialer" {
+		t.Error("local peer")
+	}
+}
+
+func TestStreamEcho(t *testing.T) {
+	client, server := connect(t)
+
+	go func() {
+		s, err := server.AcceptStream()
+		if err != nil {
+			return
+		}
+		defer s.Close()
+		data, _ := io.ReadAll(s)
+		s.Write(data)
+	}()
+
+	s, err := client.OpenStream("/echo/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := bytes.Repeat([]byte("lean"), 100000) // spans several frames
+	if _, err := s.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("echo mismatch: %d bytes", len(got))
+	}
+}
+
+func TestMultiplexedStreams(t *testing.T) {
+	client, server := connect(t)
+
+	go func() {
+		for {
+			s, err := server.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer s.Close()
+				data, _ := io.ReadAll(s)
+				s.Write(append([]byte(s.Protocol()+":"), data...))
+			}()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			proto := string(rune('a' + i))
+			s, err := client.OpenStream(proto)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			s.Write([]byte{byte(i)})
+			s.CloseWrite()
+			got, err := io.ReadAll(s)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if want := append([]byte(proto+":"), byte(i)); !bytes.Equal(got, want) {
+				t.Errorf("stream %d: got %q want %q", i, got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestStreamReset(t *testing.T) {
+	client, server := connect(t)
+
+	s, err := client.OpenStream("/reset/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote.Reset()
+
+	if _, err := io.ReadAll(s); !errors.Is(err, ErrStreamReset) {
+		t.Errorf("expected ErrStreamReset, got %v", err)
+	}
+}
+
+func TestConnCloseUnblocksStreams(t *testing.T) {
+	client, server := connect(t)
+
+	s, err := client.OpenStream("/hang/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.AcceptStream(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	if _, err := io.ReadAll(s); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if _, err := client.AcceptStream(); err == nil {
+		t.Error("expected error accepting on closed connection")
+	}
+}
+
+func TestFlowControl(t *testing.T) {
+	client, server := connect(t)
+
+	s, err := client.OpenStream("/flow/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The writer stalls once the window is full and nobody reads.
+	msg := bytes.Repeat([]byte{1}, 3*streamWindow)
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Write(msg)
+		if err == nil {
+			err = s.CloseWrite()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("write did not wait for the reader: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	rs := remote.(*stream)
+	rs.mu.Lock()
+	n := len(rs.buf)
+	rs.mu.Unlock()
+	if n > streamWindow {
+		t.Errorf("%d bytes buffered, window is %d", n, streamWindow)
+	}
+
+	got, err := io.ReadAll(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("got %d bytes, want %d", len(got), len(msg))
+	}
+}
+
+func TestRejectsStreamWithOurParity(t *testing.T) {
+	client, server := connect(t)
+
+	s, err := client.OpenStream("/mine/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The listener reuses the dialer's stream ID.
+	if err := server.(*conn).writeFrame(frameOpen, 1, []byte("/theirs/1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(s); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected the connection to be dropped, got %v", err)
+	}
+}
+
+func TestCloseForgetsStream(t *testing.T) {
+	client, server := connect(t)
+
+	s, err := client.OpenStream("/close/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	c := client.(*conn)
+	c.mu.Lock()
+	n := len(c.streams)
+	c.mu.Unlock()
+	if n != 0 {
+		t.Errorf("%d streams left after close", n)
+	}
+
+	// The peer's writes fail instead of waiting for credit.
+	msg := bytes.Repeat([]byte{1}, 2*streamWindow)
+	if _, err := remote.Write(msg); !errors.Is(err, ErrStreamReset) {
+		t.Errorf("expected ErrStreamReset, got %v", err)
+	}
+}
+
+func TestAcceptBacklogResetsStreams(t *testing.T) {
+	client, _ := connect(t)
+
+	var streams []Stream
+	for i := 0; i < maxPendingAccepts+1; i++ {
+		s, err := client.OpenStream("/backlog/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams = append(streams, s)
+	}
+	// Nobody accepts: the stream beyond the backlog is reset while the
+	// connection keeps working.
+	last := streams[len(streams)-1]
+	if _, err := io.ReadAll(last); !errors.Is(err, ErrStreamReset) {
+		t.Errorf("expected ErrStreamReset, got %v", err)
+	}
+	if _, err := client.OpenStream("/backlog/1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSilentPeerDoesNotBlockAccept(t *testing.T) {
+	l, err := NewTCP("listener").Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The silent peer never says hello, so its handshake only ends with
+	// handshakeTimeout.
+	silent, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	dialed := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c, err := NewTCP("dialer").Dial(ctx, l.Addr().String())
+		if err == nil {
+			defer c.Close()
+		}
+		dialed <- err
+	}()
+	accepted := make(chan Conn, 1)
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+	select {
+	case c := <-accepted:
+		defer c.Close()
+		if c.RemotePeer() != "dialer" {
+			t.Errorf("accepted %q", c.RemotePeer())
+		}
+	case <-time.After(handshakeTimeout / 2):
+		t.Fatal("accept waited for the silent peer")
+	}
+	if err := <-dialed; err != nil {
+		t.Fatal(err)
+	}
+
+	l.Close()
+	if _, err := l.Accept(); err == nil {
+		t.Error("accept should fail once the listener is closed")
+	}
+}
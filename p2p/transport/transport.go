@@ -0,0 +1,55 @@
+// Package transport provides connections with multiplexed streams between
+// gean nodes.
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+)
+
+// PeerID identifies a node. It is exchanged when a connection is set up.
+type PeerID string
+
+var (
+	ErrClosed       = errors.New("transport: connection closed")
+	ErrStreamReset  = errors.New("transport: stream reset")
+	ErrFrameTooLong = errors.New("transport: frame too long")
+)
+
+// Transport dials and accepts connections.
+type Transport interface {
+	Listen(addr string) (Listener, error)
+	Dial(ctx context.Context, addr string) (Conn, error)
+}
+
+type Listener interface {
+	Accept() (Conn, error)
+	Addr() net.Addr
+	Close() error
+}
+
+// Conn is a connection to a peer carrying any number of streams.
+type Conn interface {
+	// OpenStream opens a stream for the given protocol ID.
+	OpenStream(protocol string) (Stream, error)
+	// AcceptStream waits for the remote peer to open a stream.
+	AcceptStream() (Stream, error)
+
+	LocalPeer() PeerID
+	RemotePeer() PeerID
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+// Stream is a bidirectional byte stream within a Conn.
+type Stream interface {
+	io.ReadWriteCloser
+	Protocol() string
+	// CloseWrite signals end of data to the remote reader while keeping the
+	// read side open.
+	CloseWrite() error
+	// Reset aborts the stream in both directions.
+	Reset() error
+}
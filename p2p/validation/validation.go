@@ -0,0 +1,254 @@
+// Package validation implements the gossip validation rules for blocks and
+// attestations. Every outcome has its own Result code so that peer scoring
+// can weigh them differently.
+package validation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/clock"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/p2p/gossip"
+	"github.com/devlongs/gean/p2p/transport"
+	"github.com/devlongs/gean/validator/duties"
+)
+
+// Result is the outcome of validating a gossip message.
+type Result int
+
+const (
+	Accept Result = iota
+
+	// Ignored: the message may be valid but is not useful to us now.
+	IgnoreFutureSlot
+	IgnoreFinalizedSlot
+	IgnoreUnknownParent
+	IgnoreUnknownBlock
+	IgnoreSlotOutOfRange
+	IgnoreDuplicate
+
+	// Rejected: the message is invalid and the sender is at fault.
+	RejectMalformed
+	RejectWrongProposer
+	RejectUnknownValidator
+	RejectInconsistentCheckpoints
+	RejectInvalidSignature
+)
+
+var resultNames = map[Result]string{
+	Accept:                        "accept",
+	IgnoreFutureSlot:              "ignore_future_slot",
+	IgnoreFinalizedSlot:           "ignore_finalized_slot",
+	IgnoreUnknownParent:           "ignore_unknown_parent",
+	IgnoreUnknownBlock:            "ignore_unknown_block",
+	IgnoreSlotOutOfRange:          "ignore_slot_out_of_range",
+	IgnoreDuplicate:               "ignore_duplicate",
+	RejectMalformed:               "reject_malformed",
+	RejectWrongProposer:           "reject_wrong_proposer",
+	RejectUnknownValidator:        "reject_unknown_validator",
+	RejectInconsistentCheckpoints: "reject_inconsistent_checkpoints",
+	RejectInvalidSignature:        "reject_invalid_signature",
+}
+
+func (r Result) String() string {
+	if name, ok := resultNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// GossipResult maps the code to the gossip propagation decision.
+func (r Result) GossipResult() gossip.ValidationResult {
+	switch {
+	case r == Accept:
+		return gossip.ValidationAccept
+	case r >= RejectMalformed:
+		return gossip.ValidationReject
+	default:
+		return gossip.ValidationIgnore
+	}
+}
+
+const (
+	// MaxClockDisparity tolerates peers whose clocks run slightly ahead.
+	MaxClockDisparity = 500 * time.Millisecond
+
+	// AttestationSlotRange is how many slots back an attestation may be.
+	AttestationSlotRange = 8
+)
+
+// Chain is the view of the local chain the validators need.
+type Chain interface {
+	HasBlock(root types.Root) bool
+	Finalized() types.Checkpoint
+	NumValidators() uint64
+	ValidatorPubkey(index types.ValidatorIndex) (types.Bytes52, bool)
+	// ValidatorPubkeyAt returns the public key of a validator in the
+	// post-state of the block root, if that state is stored.
+	ValidatorPubkeyAt(root types.Root, index types.ValidatorIndex) (types.Bytes52, bool)
+}
+
+// Reporter receives every result together with the peer that sent the
+// message.
+type Reporter func(peer transport.PeerID, r Result)
+
+// BlockValidator validates gossip blocks. The proposer signature is checked
+// against the parent state, so a block is only accepted once its parent has
+// been imported; blocks whose parent is merely queued are ignored like those
+// with an unknown parent.
+type BlockValidator struct {
+	Clock    *clock.SlotClock
+	Chain    Chain
+	Verifier signature.Verifier
+
+	// OnUnknownParent, if set, receives blocks ignored for an unknown
+	// parent so that they can be queued and their ancestors fetched.
+	OnUnknownParent func(peer transport.PeerID, block *types.SignedBlockWithAttestation)
+}
+
+func (v *BlockValidator) Validate(signed *types.SignedBlockWithAttestation) Result {
+	block := &signed.Message.Block
+
+	if block.Slot > v.Clock.SlotAt(v.Clock.Now().Add(MaxClockDisparity)) {
+		return IgnoreFutureSlot
+	}
+	if block.Slot <= v.Chain.Finalized().Slot {
+		return IgnoreFinalizedSlot
+	}
+	proposer, err := duties.ProposerIndex(block.Slot, v.Chain.NumValidators())
+	if err != nil || proposer != block.ProposerIndex {
+		return RejectWrongProposer
+	}
+	if !v.Chain.HasBlock(block.ParentRoot) {
+		return IgnoreUnknownParent
+	}
+	pubkey, ok := v.Chain.ValidatorPubkeyAt(block.ParentRoot, block.ProposerIndex)
+	if !ok {
+		return IgnoreUnknownParent
+	}
+	if len(signed.Signatures) == 0 {
+		return RejectInvalidSignature
+	}
+	sig := &signed.Signatures[len(signed.Signatures)-1]
+	if err := v.Verifier.Verify(pubkey, chain.ProposerSigningRoot(&signed.Message), sig); err != nil {
+		return RejectInvalidSignature
+	}
+	return Accept
+}
+
+// AttestationValidator validates gossip attestations and remembers which
+// validators already attested in each slot. Only attestations with a valid
+// signature are remembered, so a forged one cannot shadow the real vote.
+type AttestationValidator struct {
+	Clock    *clock.SlotClock
+	Chain    Chain
+	Verifier signature.Verifier
+
+	mu   sync.Mutex
+	seen map[types.Slot]map[types.ValidatorIndex]bool
+}
+
+func (v *AttestationValidator) Validate(att *types.SignedAttestation) Result {
+	data := &att.Message
+	current := v.Clock.SlotAt(v.Clock.Now().Add(MaxClockDisparity))
+
+	if data.Slot > current {
+		return IgnoreFutureSlot
+	}
+	if data.Slot+AttestationSlotRange < current {
+		return IgnoreSlotOutOfRange
+	}
+	if data.Slot < v.Chain.Finalized().Slot {
+		return IgnoreFinalizedSlot
+	}
+	if uint64(att.ValidatorID) >= v.Chain.NumValidators() {
+		return RejectUnknownValidator
+	}
+	if data.Source.Slot > data.Target.Slot || data.Target.Slot > data.Head.Slot || data.Head.Slot > data.Slot {
+		return RejectInconsistentCheckpoints
+	}
+	for _, cp := range []*types.Checkpoint{&data.Head, &data.Target, &data.Source} {
+		if !v.Chain.HasBlock(cp.Root) {
+			return IgnoreUnknownBlock
+		}
+	}
+	// Verification is the expensive step: skip it for validators already
+	// seen, and mark them only once the signature holds.
+	if v.isSeen(data.Slot, att.ValidatorID) {
+		return IgnoreDuplicate
+	}
+	pubkey, ok := v.Chain.ValidatorPubkey(att.ValidatorID)
+	if !ok {
+		return RejectUnknownValidator
+	}
+	if err := v.Verifier.Verify(pubkey, chain.AttestationSigningRoot(data), &att.Signature); err != nil {
+		return RejectInvalidSignature
+	}
+	if !v.markSeen(data.Slot, att.ValidatorID, current) {
+		return IgnoreDuplicate
+	}
+	return Accept
+}
+
+func (v *AttestationValidator) isSeen(slot types.Slot, validator types.ValidatorIndex) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.seen[slot][validator]
+}
+
+func (v *AttestationValidator) markSeen(slot types.Slot, validator types.ValidatorIndex, current types.Slot) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen == nil {
+		v.seen = make(map[types.Slot]map[types.ValidatorIndex]bool)
+	}
+	for s := range v.seen {
+		if s+AttestationSlotRange < current {
+			delete(v.seen, s)
+		}
+	}
+	if v.seen[slot] == nil {
+		v.seen[slot] = make(map[types.ValidatorIndex]bool)
+	}
+	if v.seen[slot][validator] {
+		return false
+	}
+	v.seen[slot][validator] = true
+	return true
+}
+
+// GossipBlockValidator adapts v to a gossip topic validator. report may be
+// nil.
+func GossipBlockValidator(v *BlockValidator, report Reporter) gossip.Validator {
+	return func(msg *gossip.Message) gossip.ValidationResult {
+		r := RejectMalformed
+		if block, err := gossip.DecodeBlock(msg); err == nil {
+			r = v.Validate(block)
+			if r == IgnoreUnknownParent && v.OnUnknownParent != nil {
+				v.OnUnknownParent(msg.From, block)
+			}
+		}
+		if report != nil {
+			report(msg.From, r)
+		}
+		return r.GossipResult()
+	}
+}
+
+// GossipAttestationValidator adapts v to a gossip topic validator. report
+// may be nil.
+func GossipAttestationValidator(v *AttestationValidator, report Reporter) gossip.Validator {
+	return func(msg *gossip.Message) gossip.ValidationResult {
+		r := RejectMalformed
+		if att, err := gossip.DecodeAttestation(msg); err == nil {
+			r = v.Validate(att)
+		}
+		if report != nil {
+			report(msg.From, r)
+		}
+		return r.GossipResult()
+	}
+}
@@ -0,0 +1,218 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/clock"
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/p2p/gossip"
+	"github.com/devlongs/gean/p2p/transport"
+)
+
+const genesisTime = 1700000000
+
+type fakeChain struct {
+	blocks     map[types.Root]bool
+	finalized  types.Checkpoint
+	validators uint64
+}
+
+func (c *fakeChain) HasBlock(root types.Root) bool { return c.blocks[root] }
+func (c *fakeChain) Finalized() types.Checkpoint   { return c.finalized }
+func (c *fakeChain) NumValidators() uint64         { return c.validators }
+
+func (c *fakeChain) ValidatorPubkey(index types.ValidatorIndex) (types.Bytes52, bool) {
+	if uint64(index) >= c.validators {
+		return types.Bytes52{}, false
+	}
+	return signature.NewMockSigner(uint64(index)).PublicKey(), true
+}
+
+// ValidatorPubkeyAt knows the states of every block except root {2}, as if
+// it had been pruned.
+func (c *fakeChain) ValidatorPubkeyAt(root types.Root, index types.ValidatorIndex) (types.Bytes52, bool) {
+	if !c.blocks[root] || root == (types.Root{2}) {
+		return types.Bytes52{}, false
+	}
+	return c.ValidatorPubkey(index)
+}
+
+// testClock is at the start of slot 10.
+func testClock() *clock.SlotClock {
+	return clock.NewWithTime(genesisTime, func() time.Time {
+		return time.Unix(genesisTime+10*int64(types.SecondsPerSlot), 0)
+	})
+}
+
+func testChain() *fakeChain {
+	return &fakeChain{
+		blocks:     map[types.Root]bool{{1}: true, {2}: true, {3}: true},
+		finalized:  types.Checkpoint{Root: types.Root{1}, Slot: 2},
+		validators: 4,
+	}
+}
+
+// testBlock returns a block signed with the mock key of proposer.
+func testBlock(slot types.Slot, proposer types.ValidatorIndex, parent types.Root) *types.SignedBlockWithAttestation {
+	b := &types.SignedBlockWithAttestation{}
+	b.Message.Block.Slot = slot
+	b.Message.Block.ProposerIndex = proposer
+	b.Message.Block.ParentRoot = parent
+	sig, _ := signature.NewMockSigner(uint64(proposer)).Sign(chain.ProposerSigningRoot(&b.Message))
+	b.Signatures = []types.Bytes3116{sig}
+	return b
+}
+
+func TestBlockValidator(t *testing.T) {
+	v := &BlockValidator{Clock: testClock(), Chain: testChain(), Verifier: signature.MockVerifier{}}
+
+	forged := testBlock(10, 2, types.Root{3})
+	forged.Signatures[0], _ = signature.NewMockSigner(1).Sign(chain.ProposerSigningRoot(&forged.Message))
+	unsigned := testBlock(10, 2, types.Root{3})
+	unsigned.Signatures = nil
+
+	tests := []struct {
+		name  string
+		block *types.SignedBlockWithAttestation
+		want  Result
+	}{
+		{"valid", testBlock(10, 2, types.Root{3}), Accept},
+		{"parent state pruned", testBlock(10, 2, types.Root{2}), IgnoreUnknownParent},
+		{"forged signature", forged, RejectInvalidSignature},
+		{"unsigned", unsigned, RejectInvalidSignature},
+		{"future slot", testBlock(11, 3, types.Root{3}), IgnoreFutureSlot},
+		{"finalized slot", testBlock(2, 2, types.Root{3}), IgnoreFinalizedSlot},
+		{"wrong proposer", testBlock(10, 1, types.Root{3}), RejectWrongProposer},
+		{"unknown parent", testBlock(10, 2, types.Root{8}), IgnoreUnknownParent},
+	}
+	for _, tt := range tests {
+		if got := v.Validate(tt.block); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// testAttestation returns an attestation signed with the mock key of
+// validator.
+func testAttestation(validator types.ValidatorIndex, slot types.Slot) *types.SignedAttestation {
+	att := &types.SignedAttestation{
+		ValidatorID: validator,
+		Message: types.AttestationData{
+			Slot:   slot,
+			Head:   types.Checkpoint{Root: types.Root{3}, Slot: 9},
+			Target: types.Checkpoint{Root: types.Root{2}, Slot: 6},
+			Source: types.Checkpoint{Root: types.Root{1}, Slot: 2},
+		},
+	}
+	att.Signature, _ = signature.NewMockSigner(uint64(validator)).Sign(chain.AttestationSigningRoot(&att.Message))
+	return att
+}
+
+func testAttestationValidator() *AttestationValidator {
+	return &AttestationValidator{Clock: testClock(), Chain: testChain(), Verifier: signature.MockVerifier{}}
+}
+
+func TestAttestationValidator(t *testing.T) {
+	v := testAttestationValidator()
+
+	inconsistent := testAttestation(1, 10)
+	inconsistent.Message.Source.Slot = 7
+	unknownHead := testAttestation(1, 10)
+	unknownHead.Message.Head.Root = types.Root{7}
+	forged := testAttestation(1, 10)
+	forged.Signature, _ = signature.NewMockSigner(99).Sign(chain.AttestationSigningRoot(&forged.Message))
+
+	tests := []struct {
+		name string
+		att  *types.SignedAttestation
+		want Result
+	}{
+		{"valid", testAttestation(0, 10), Accept},
+		{"duplicate", testAttestation(0, 10), IgnoreDuplicate},
+		{"same validator next slot", testAttestation(0, 9), Accept},
+		{"future slot", testAttestation(1, 11), IgnoreFutureSlot},
+		{"too old", testAttestation(1, 1), IgnoreSlotOutOfRange},
+		{"unknown validator", testAttestation(4, 10), RejectUnknownValidator},
+		{"inconsistent checkpoints", inconsistent, RejectInconsistentCheckpoints},
+		{"unknown head", unknownHead, IgnoreUnknownBlock},
+		{"forged signature", forged, RejectInvalidSignature},
+		{"real vote after a forgery", testAttestation(1, 10), Accept},
+	}
+	for _, tt := range tests {
+		if got := v.Validate(tt.att); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGossipResultMapping(t *testing.T) {
+	if Accept.GossipResult() != gossip.ValidationAccept {
+		t.Error("accept")
+	}
+	if IgnoreUnknownParent.GossipResult() != gossip.ValidationIgnore {
+		t.Error("ignore")
+	}
+	if RejectWrongProposer.GossipResult() != gossip.ValidationReject {
+		t.Error("reject")
+	}
+}
+
+func TestGossipAdapters(t *testing.T) {
+	var reported []Result
+	report := func(peer transport.PeerID, r Result) {
+		if peer != "peer" {
+			t.Errorf("unexpected peer %s", peer)
+		}
+		reported = append(reported, r)
+	}
+
+	blocks := GossipBlockValidator(&BlockValidator{Clock: testClock(), Chain: testChain(), Verifier: signature.MockVerifier{}}, report)
+	good := &gossip.Message{From: "peer", Data: ssz.MarshalSignedBlockWithAttestation(testBlock(10, 2, types.Root{3}))}
+	if blocks(good) != gossip.ValidationAccept {
+		t.Error("valid block should be accepted")
+	}
+	if blocks(&gossip.Message{From: "peer", Data: []byte{1, 2}}) != gossip.ValidationReject {
+		t.Error("malformed block should be rejected")
+	}
+
+	atts := GossipAttestationValidator(testAttestationValidator(), report)
+	if atts(&gossip.Message{From: "peer", Data: ssz.MarshalSignedAttestation(testAttestation(0, 10))}) != gossip.ValidationAccept {
+		t.Error("valid attestation should be accepted")
+	}
+
+	want := []Result{Accept, RejectMalformed, Accept}
+	if len(reported) != len(want) {
+		t.Fatalf("reported %v", reported)
+	}
+	for i := range want {
+		if reported[i] != want[i] {
+			t.Errorf("report %d: got %s, want %s", i, reported[i], want[i])
+		}
+	}
+}
+
+func TestGossipBlockValidatorUnknownParent(t *testing.T) {
+	var orphans []*types.SignedBlockWithAttestation
+	v := &BlockValidator{
+		Clock:    testClock(),
+		Chain:    testChain(),
+		Verifier: signature.MockVerifier{},
+		OnUnknownParent: func(peer transport.PeerID, block *types.SignedBlockWithAttestation) {
+			orphans = append(orphans, block)
+		},
+	}
+	validate := GossipBlockValidator(v, nil)
+
+	orphan := &gossip.Message{From: "peer", Data: ssz.MarshalSignedBlockWithAttestation(testBlock(10, 2, types.Root{8}))}
+	if validate(orphan) != gossip.ValidationIgnore {
+		t.Error("orphan should be ignored")
+	}
+	validate(&gossip.Message{From: "peer", Data: ssz.MarshalSignedBlockWithAttestation(testBlock(10, 2, types.Root{3}))})
+	if len(orphans) != 1 || orphans[0].Message.Block.ParentRoot != (types.Root{8}) {
+		t.Errorf("expected the orphan to be handed over, got %d blocks", len(orphans))
+	}
+}
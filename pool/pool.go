@@ -0,0 +1,256 @@
+// Package pool keeps attestations received from the network until they are
+// packed into a block.
+package pool
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+)
+
+// group collects the votes for one AttestationData.
+type group struct {
+	data types.AttestationData
+	sigs map[types.ValidatorIndex]types.Bytes3116
+}
+
+// aggregate returns the group's votes, leaving out skip, as an aggregated
+// attestation with signatures in ascending validator index.
+func (g *group) aggregate(skip map[types.ValidatorIndex]bool) (chain.SignedAggregate, bool) {
+	validators := make([]types.ValidatorIndex, 0, len(g.sigs))
+	for v := range g.sigs {
+		if !skip[v] {
+			validators = append(validators, v)
+		}
+	}
+	if len(validators) == 0 {
+		return chain.SignedAggregate{}, false
+	}
+	sort.Slice(validators, func(i, j int) bool { return validators[i] < validators[j] })
+
+	bits := make([]bool, validators[len(validators)-1]+1)
+	sigs := make([]types.Bytes3116, len(validators))
+	for i, v := range validators {
+		bits[v] = true
+		sigs[i] = g.sigs[v]
+	}
+	bl, err := types.BitlistFromBits(bits, types.ValidatorRegistryLimit)
+	if err != nil {
+		return chain.SignedAggregate{}, false
+	}
+	return chain.SignedAggregate{
+		Attestation: types.AggregatedAttestation{AggregationBits: bl, Data: g.data},
+		Signatures:  sigs,
+	}, true
+}
+
+type Config struct {
+	// MaxGroups bounds the number of distinct AttestationData held. When
+	// the pool is full, the votes of the oldest slot make room for newer
+	// ones.
+	MaxGroups int
+	// MaxGroupsPerSlot bounds the number of distinct AttestationData held
+	// for one slot; votes for further ones are refused.
+	MaxGroupsPerSlot int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxGroups:        4096,
+		MaxGroupsPerSlot: 64,
+	}
+}
+
+// Pool groups attestations by the hash tree root of their data. Callers add
+// attestations that already passed gossip validation; signatures are not
+// checked here.
+type Pool struct {
+	cfg Config
+
+	mu     sync.Mutex
+	groups map[types.Root]*group
+	// perSlot counts the groups of each slot.
+	perSlot map[types.Slot]int
+}
+
+func New(cfg Config) *Pool {
+	return &Pool{cfg: cfg, groups: make(map[types.Root]*group), perSlot: make(map[types.Slot]int)}
+}
+
+// Add records att. It reports false if the vote was already known, the
+// validator index is beyond the registry limit, or there is no room for
+// its data.
+func (p *Pool) Add(att *types.SignedAttestation) bool {
+	if uint64(att.ValidatorID) >= types.ValidatorRegistryLimit {
+		return false
+	}
+	root := ssz.HashTreeRootAttestationData(&att.Message)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.groups[root]
+	if !ok {
+		if !p.makeRoomLocked(att.Message.Slot) {
+			return false
+		}
+		g = &group{data: att.Message, sigs: make(map[types.ValidatorIndex]types.Bytes3116)}
+		p.groups[root] = g
+		p.perSlot[att.Message.Slot]++
+	}
+	if _, dup := g.sigs[att.ValidatorID]; dup {
+		return false
+	}
+	g.sigs[att.ValidatorID] = att.Signature
+	return true
+}
+
+// makeRoomLocked reports whether a new group for slot fits, dropping the
+// groups of the oldest slot if that is older than slot.
+func (p *Pool) makeRoomLocked(slot types.Slot) bool {
+	if p.perSlot[slot] >= p.cfg.MaxGroupsPerSlot {
+		return false
+	}
+	if len(p.groups) < p.cfg.MaxGroups {
+		return true
+	}
+	oldest := slot
+	for s := range p.perSlot {
+		oldest = min(oldest, s)
+	}
+	if oldest == slot {
+		return false
+	}
+	for root, g := range p.groups {
+		if g.data.Slot == oldest {
+			p.deleteLocked(root)
+		}
+	}
+	return true
+}
+
+func (p *Pool) deleteLocked(root types.Root) {
+	g, ok := p.groups[root]
+	if !ok {
+		return
+	}
+	delete(p.groups, root)
+	if p.perSlot[g.data.Slot]--; p.perSlot[g.data.Slot] == 0 {
+		delete(p.perSlot, g.data.Slot)
+	}
+}
+
+// Len returns the number of individual votes held.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, g := range p.groups {
+		n += len(g.sigs)
+	}
+	return n
+}
+
+// Aggregate returns the merged votes for the attestation data with the
+// given root.
+func (p *Pool) Aggregate(dataRoot types.Root) (chain.SignedAggregate, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.groups[dataRoot]
+	if !ok {
+		return chain.SignedAggregate{}, false
+	}
+	return g.aggregate(nil)
+}
+
+// Prune drops votes whose target is at or below the finalized slot; they
+// can no longer justify anything.
+func (p *Pool) Prune(finalized types.Checkpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for root, g := range p.groups {
+		if g.data.Target.Slot <= finalized.Slot {
+			p.deleteLocked(root)
+		}
+	}
+}
+
+// RemoveIncluded drops the votes carried by attestations included in a
+// block.
+func (p *Pool) RemoveIncluded(atts []types.AggregatedAttestation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range atts {
+		root := ssz.HashTreeRootAttestationData(&atts[i].Data)
+		g, ok := p.groups[root]
+		if !ok {
+			continue
+		}
+		bits := atts[i].AggregationBits
+		for v := range g.sigs {
+			if bits.Get(int(v)) {
+				delete(g.sigs, v)
+			}
+		}
+		if len(g.sigs) == 0 {
+			p.deleteLocked(root)
+		}
+	}
+}
+
+// Aggregates returns the votes to pack into a block at slot. See Select.
+func (p *Pool) Aggregates(slot types.Slot) []chain.SignedAggregate {
+	return p.Select(slot, types.AttestationsLimit)
+}
+
+// Select picks at most limit aggregates for a block at slot, from votes
+// made before slot. Aggregates are chosen largest first and do not overlap:
+// a validator's vote for a given source and target is included only once,
+// however many slots it was repeated in.
+func (p *Pool) Select(slot types.Slot, limit int) []chain.SignedAggregate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	candidates := make([]*group, 0, len(p.groups))
+	for _, g := range p.groups {
+		if g.data.Slot < slot && g.data.Target.Slot < slot {
+			candidates = append(candidates, g)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if len(a.sigs) != len(b.sigs) {
+			return len(a.sigs) > len(b.sigs)
+		}
+		// Prefer the most recent head, then any fixed order.
+		if a.data.Slot != b.data.Slot {
+			return a.data.Slot > b.data.Slot
+		}
+		ra, rb := ssz.HashTreeRootAttestationData(&a.data), ssz.HashTreeRootAttestationData(&b.data)
+		return string(ra[:]) < string(rb[:])
+	})
+
+	type link struct{ source, target types.Checkpoint }
+	counted := make(map[link]map[types.ValidatorIndex]bool)
+	var out []chain.SignedAggregate
+	for _, g := range candidates {
+		if len(out) == limit {
+			break
+		}
+		l := link{g.data.Source, g.data.Target}
+		agg, ok := g.aggregate(counted[l])
+		if !ok {
+			continue
+		}
+		if counted[l] == nil {
+			counted[l] = make(map[types.ValidatorIndex]bool)
+		}
+		for v := range g.sigs {
+			counted[l][v] = true
+		}
+		out = append(out, agg)
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package pool
+
+import (
+	"testing"
+
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/validator"
+)
+
+var _ validator.AttestationSource = (*Pool)(nil)
+
+func data(slot, target types.Slot) types.AttestationData {
+	return types.AttestationData{
+		Slot:   slot,
+		Head:   types.Checkpoint{Root: types.Root{byte(slot)}, Slot: slot},
+		Target: types.Checkpoint{Root: types.Root{byte(target)}, Slot: target},
+		Source: types.Checkpoint{Root: types.Root{0}, Slot: 0},
+	}
+}
+
+func att(validator types.ValidatorIndex, d types.AttestationData) *types.SignedAttestation {
+	return &types.SignedAttestation{ValidatorID: validator, Message: d, Signature: types.Bytes3116{byte(validator), byte(d.Slot)}}
+}
+
+func TestAddAndAggregate(t *testing.T) {
+	p := New(DefaultConfig())
+	d := data(3, 2)
+	for _, v := range []types.ValidatorIndex{5, 1, 3} {
+		if !p.Add(att(v, d)) {
+			t.Errorf("validator %d should be new", v)
+		}
+	}
+	if p.Add(att(3, d)) {
+		t.Error("duplicate vote should be ignored")
+	}
+	if p.Add(att(types.ValidatorRegistryLimit, d)) {
+		t.Error("validator beyond the registry limit should be ignored")
+	}
+	p.Add(att(2, data(3, 1)))
+	if p.Len() != 4 {
+		t.Errorf("pool holds %d votes, want 4", p.Len())
+	}
+
+	agg, ok := p.Aggregate(ssz.HashTreeRootAttestationData(&d))
+	if !ok {
+		t.Fatal("missing aggregate")
+	}
+	bits := agg.Attestation.AggregationBits
+	for v := 0; v < 6; v++ {
+		want := v == 1 || v == 3 || v == 5
+		if bits.Get(v) != want {
+			t.Errorf("bit %d = %v, want %v", v, bits.Get(v), want)
+		}
+	}
+	if agg.Attestation.Data != d {
+		t.Error("aggregate data")
+	}
+	for i, v := range []byte{1, 3, 5} {
+		if agg.Signatures[i][0] != v {
+			t.Errorf("signature %d is from validator %d, want %d", i, agg.Signatures[i][0], v)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	p := New(DefaultConfig())
+	// Validators 0-2 vote for target 2 in slot 3 and again in slot 4; the
+	// second round must not be counted twice.
+	for v := types.ValidatorIndex(0); v < 3; v++ {
+		p.Add(att(v, data(3, 2)))
+		p.Add(att(v, data(4, 2)))
+	}
+	p.Add(att(3, data(4, 2)))
+	p.Add(att(0, data(4, 3)))
+	p.Add(att(1, data(5, 4)))
+
+	selected := p.Select(5, 10)
+	if len(selected) != 2 {
+		t.Fatalf("selected %d aggregates, want 2", len(selected))
+	}
+	if got := selected[0].Attestation.Data; got != data(4, 2) || len(selected[0].Signatures) != 4 {
+		t.Errorf("largest aggregate first, got slot %d with %d votes", got.Slot, len(selected[0].Signatures))
+	}
+	if got := selected[1].Attestation.Data; got != data(4, 3) {
+		t.Errorf("second aggregate for slot %d target %d", got.Slot, got.Target.Slot)
+	}
+
+	if n := len(p.Select(5, 1)); n != 1 {
+		t.Errorf("limit ignored, got %d aggregates", n)
+	}
+	if n := len(p.Aggregates(4)); n != 1 {
+		t.Errorf("only votes before the block slot count, got %d aggregates", n)
+	}
+}
+
+func TestPruneAndRemoveIncluded(t *testing.T) {
+	p := New(DefaultConfig())
+	p.Add(att(0, data(2, 1)))
+	p.Add(att(1, data(4, 3)))
+	p.Add(att(2, data(4, 3)))
+
+	p.Prune(types.Checkpoint{Slot: 1})
+	if p.Len() != 2 {
+		t.Errorf("votes with finalized targets should be pruned, %d left", p.Len())
+	}
+
+	agg, _ := p.Aggregate(ssz.HashTreeRootAttestationData(&types.AttestationData{}))
+	if agg.Signatures != nil {
+		t.Error("unknown data should have no aggregate")
+	}
+	included, _ := types.BitlistFromBits([]bool{false, true}, types.ValidatorRegistryLimit)
+	p.RemoveIncluded([]types.AggregatedAttestation{{AggregationBits: included, Data: data(4, 3)}})
+	if p.Len() != 1 {
+		t.Errorf("included votes should be removed, %d left", p.Len())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	p := New(Config{MaxGroups: 4, MaxGroupsPerSlot: 2})
+	// Distinct heads give distinct data at the same slot.
+	withHead := func(slot types.Slot, head byte) types.AttestationData {
+		d := data(slot, slot-1)
+		d.Head.Root = types.Root{head}
+		return d
+	}
+	p.Add(att(0, withHead(3, 1)))
+	p.Add(att(0, withHead(3, 2)))
+	if p.Add(att(1, withHead(3, 3))) {
+		t.Error("a third group for slot 3 should be refused")
+	}
+	if !p.Add(att(1, withHead(3, 1))) {
+		t.Error("votes for held data are still accepted")
+	}
+
+	p.Add(att(0, withHead(4, 1)))
+	p.Add(att(0, withHead(4, 2)))
+	if !p.Add(att(0, withHead(5, 1))) {
+		t.Error("a newer slot should make room")
+	}
+	d := withHead(3, 1)
+	if _, ok := p.Aggregate(ssz.HashTreeRootAttestationData(&d)); ok {
+		t.Error("the oldest slot should be dropped")
+	}
+	p.Add(att(0, withHead(5, 2)))
+	if p.Add(att(2, withHead(2, 1))) {
+		t.Error("a vote older than every held slot should be refused when full")
+	}
+	if p.Len() != 4 {
+		t.Errorf("pool holds %d votes, want 4", p.Len())
+	}
+}
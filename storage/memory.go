@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// MemoryStore is an in-memory Store, used for tests and short-lived devnets.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	blocks map[types.Root]*types.SignedBlockWithAttestation
+	states map[types.Root]*types.State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		blocks: make(map[types.Root]*types.SignedBlockWithAttestation),
+		states: make(map[types.Root]*types.State),
+	}
+}
+
+func (m *MemoryStore) GetBlock(root types.Root) (*types.SignedBlockWithAttestation, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.blocks[root]
+	return b, ok
+}
+
+func (m *MemoryStore) PutBlock(root types.Root, block *types.SignedBlockWithAttestation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocks[root] = block
+}
+
+func (m *MemoryStore) DeleteBlock(root types.Root) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blocks, root)
+}
+
+func (m *MemoryStore) GetState(root types.Root) (*types.State, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.states[root]
+	return s, ok
+}
+
+func (m *MemoryStore) PutState(root types.Root, state *types.State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[root] = state
+}
+
+func (m *MemoryStore) DeleteState(root types.Root) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, root)
+}
+
+func (m *MemoryStore) BlockRoots() []types.Root {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	roots := make([]types.Root, 0, len(m.blocks))
+	for root := range m.blocks {
+		roots = append(roots, root)
+	}
+	return roots
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+func TestMemoryStoreBlocks(t *testing.T) {
+	db := NewMemoryStore()
+	root := types.Root{1}
+	block := &types.SignedBlockWithAttestation{}
+	block.Message.Block.Slot = 5
+
+	if _, ok := db.GetBlock(root); ok {
+		t.Error("empty store should not have block")
+	}
+	db.PutBlock(root, block)
+	got, ok := db.GetBlock(root)
+	if !ok || got.Message.Block.Slot != 5 {
+		t.Error("stored block")
+	}
+	if len(db.BlockRoots()) != 1 {
+		t.Error("block roots")
+	}
+	db.DeleteBlock(root)
+	if _, ok := db.GetBlock(root); ok {
+		t.Error("deleted block")
+	}
+}
+
+func TestMemoryStoreStates(t *testing.T) {
+	db := NewMemoryStore()
+	root := types.Root{2}
+
+	db.PutState(root, &types.State{Slot: 7})
+	got, ok := db.GetState(root)
+	if !ok || got.Slot != 7 {
+		t.Error("stored state")
+	}
+	db.DeleteState(root)
+	if _, ok := db.GetState(root); ok {
+		t.Error("deleted state")
+	}
+}
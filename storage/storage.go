@@ -0,0 +1,19 @@
+// Package storage persists blocks and states keyed by block root.
+package storage
+
+import "github.com/devlongs/gean/common/types"
+
+// Store is the block and state storage interface. States are keyed by the
+// root of the block that produced them.
+type Store interface {
+	GetBlock(root types.Root) (*types.SignedBlockWithAttestation, bool)
+	PutBlock(root types.Root, block *types.SignedBlockWithAttestation)
+	DeleteBlock(root types.Root)
+
+	GetState(root types.Root) (*types.State, bool)
+	PutState(root types.Root, state *types.State)
+	DeleteState(root types.Root)
+
+	// BlockRoots returns the roots of all stored blocks in no particular order.
+	BlockRoots() []types.Root
+}
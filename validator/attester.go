@@ -0,0 +1,87 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/validator/duties"
+)
+
+// Attester makes attestations for our validators.
+type Attester struct {
+	chain     Chain
+	publisher Publisher
+	keys      Keys
+	protect   Protection
+}
+
+// NewAttester returns an attester signing with keys. Every vote is checked
+// against protect before it is signed.
+func NewAttester(c Chain, pub Publisher, keys Keys, protect Protection) *Attester {
+	return &Attester{chain: c, publisher: pub, keys: keys, protect: protect}
+}
+
+// AttestationData returns what our validators vote for at slot: the fork
+// choice head, the target derived from it and the latest justified
+// checkpoint as source. The target is never older than the source.
+func (a *Attester) AttestationData(slot types.Slot) types.AttestationData {
+	head := a.chain.Head()
+	var parent types.Root
+	if block, ok := a.chain.Block(head.Root); ok {
+		parent = block.Message.Block.ParentRoot
+	}
+	source := a.chain.Justified()
+	return types.AttestationData{
+		Slot:   slot,
+		Head:   head,
+		Target: attestationTarget(a.chain, head, parent, source),
+		Source: source,
+	}
+}
+
+// Attest signs and publishes an attestation for slot from each of our
+// validators, except the proposer of slot whose vote is carried by its
+// block. Validators that fail to sign are reported in the returned error;
+// the others still attest.
+func (a *Attester) Attest(ctx context.Context, slot types.Slot) ([]*types.SignedAttestation, error) {
+	state := a.chain.HeadState()
+	data := a.AttestationData(slot)
+	root := chain.AttestationSigningRoot(&data)
+
+	validators := make([]types.ValidatorIndex, 0, len(a.keys))
+	for v := range a.keys {
+		validators = append(validators, v)
+	}
+	sort.Slice(validators, func(i, j int) bool { return validators[i] < validators[j] })
+
+	var atts []*types.SignedAttestation
+	var errs []error
+	for _, v := range validators {
+		if ctx.Err() != nil {
+			return atts, ctx.Err()
+		}
+		if duties.IsProposer(state, slot, v) {
+			continue
+		}
+		signer, err := a.keys.signer(state, v)
+		if err == nil {
+			err = a.protect.CheckAndRecordAttestation(signer.PublicKey(), &data, root)
+		}
+		var sig types.Bytes3116
+		if err == nil {
+			sig, err = signAttestation(ctx, signer, &data, root)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("validator %d: %w", v, err))
+			continue
+		}
+		att := &types.SignedAttestation{ValidatorID: v, Message: data, Signature: sig}
+		a.publisher.PublishAttestation(att)
+		atts = append(atts, att)
+	}
+	return atts, errors.Join(errs...)
+}
@@ -0,0 +1,183 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/clock"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/validator/slashing"
+)
+
+func TestAttest(t *testing.T) {
+	c, keys := testChain(4)
+	pub := &testPublisher{}
+	genesis := c.Head()
+	block, err := NewProposer(c, nil, pub, keys, newProtection(t)).Propose(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAttester(c, pub, keys, newProtection(t))
+	atts, err := a.Attest(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(atts) != 3 || len(pub.atts) != 3 {
+		t.Fatalf("expected 3 attestations, got %d", len(atts))
+	}
+	head := types.Checkpoint{Root: chain.BlockRoot(&block.Message.Block), Slot: 1}
+	for _, att := range atts {
+		if att.ValidatorID == 1 {
+			t.Error("the proposer should not attest separately")
+		}
+		data := att.Message
+		if data.Slot != 1 || data.Head != head || data.Source != genesis || data.Target != genesis {
+			t.Errorf("unexpected attestation data %+v", data)
+		}
+		pubkey := keys[att.ValidatorID].PublicKey()
+		if err := (signature.MockVerifier{}).Verify(pubkey, chain.AttestationSigningRoot(&data), &att.Signature); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Signing the same data again is harmless.
+	if _, err := a.Attest(context.Background(), 1); err != nil {
+		t.Errorf("re-signing identical data: %v", err)
+	}
+}
+
+func TestAttestRefusesSlashable(t *testing.T) {
+	c, keys := testChain(4)
+	pub := &testPublisher{}
+	p := NewProposer(c, nil, pub, keys, newProtection(t))
+	if _, err := p.Propose(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	a := NewAttester(c, pub, keys, newProtection(t))
+	if _, err := a.Attest(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The head moves, so slot 1 would now get different data.
+	if _, err := p.Propose(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	atts, err := a.Attest(context.Background(), 1)
+	if !errors.Is(err, slashing.ErrSlashable) || len(atts) != 0 {
+		t.Errorf("expected every validator to refuse, got %d attestations, %v", len(atts), err)
+	}
+	if atts, err := a.Attest(context.Background(), 2); err != nil || len(atts) != 3 {
+		t.Errorf("next slot should be signed, got %d attestations, %v", len(atts), err)
+	}
+}
+
+func TestAttestationTargetUsesSafeTarget(t *testing.T) {
+	c, keys := testChain(4)
+	pub := &testPublisher{}
+	p := NewProposer(c, nil, pub, keys, newProtection(t))
+	for slot := types.Slot(1); slot <= 4; slot++ {
+		if _, err := p.Propose(context.Background(), slot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each proposer voted for its own block, so only the blocks at slots 1
+	// and 2 have three of four votes. The target moves back from the head
+	// to the safe target at slot 2.
+	if c.SafeTarget().Slot != 2 {
+		t.Fatalf("safe target at slot %d, want 2", c.SafeTarget().Slot)
+	}
+	data := NewAttester(c, pub, keys, newProtection(t)).AttestationData(5)
+	if data.Head.Slot != 4 || data.Target.Slot != 2 {
+		t.Errorf("head %d target %d, want 4 and 2", data.Head.Slot, data.Target.Slot)
+	}
+}
+
+// justifiedChain reports a justified checkpoint ahead of the chain's own.
+type justifiedChain struct {
+	*chain.Chain
+	justified types.Checkpoint
+}
+
+func (c justifiedChain) Justified() types.Checkpoint { return c.justified }
+
+func TestAttestationTargetNotBeforeSource(t *testing.T) {
+	c, keys := testChain(4)
+	pub := &testPublisher{}
+	p := NewProposer(c, nil, pub, keys, newProtection(t))
+	for slot := types.Slot(1); slot <= 4; slot++ {
+		if _, err := p.Propose(context.Background(), slot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The safe target is at slot 2, behind the justified head.
+	jc := justifiedChain{Chain: c, justified: c.Head()}
+	a := NewAttester(jc, pub, keys, newProtection(t))
+	data := a.AttestationData(5)
+	if data.Source != jc.justified || data.Target != jc.justified {
+		t.Errorf("source %d target %d, want both at %d", data.Source.Slot, data.Target.Slot, jc.justified.Slot)
+	}
+	if _, err := a.Attest(context.Background(), 5); err != nil {
+		t.Errorf("attesting with the clamped target: %v", err)
+	}
+}
+
+func TestAttestationTargetAfterJustifiedSource(t *testing.T) {
+	c, keys := testChain(4)
+	pub := &testPublisher{}
+	p := NewProposer(c, nil, pub, keys, newProtection(t))
+	for slot := types.Slot(1); slot <= 4; slot++ {
+		if _, err := p.Propose(context.Background(), slot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	protect := newProtection(t)
+	before := NewAttester(c, pub, keys, protect)
+	if data := before.AttestationData(5); data.Target != c.SafeTarget() || data.Source.Slot != 0 {
+		t.Fatalf("source %d target %d, want 0 and the safe target", data.Source.Slot, data.Target.Slot)
+	}
+	if _, err := before.Attest(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the safe target is justified, voting for it again from the new
+	// source would be a double vote; the head is voted for instead.
+	jc := justifiedChain{Chain: c, justified: c.SafeTarget()}
+	after := NewAttester(jc, pub, keys, protect)
+	if data := after.AttestationData(6); data.Source != jc.justified || data.Target != c.Head() {
+		t.Errorf("source %d target %d, want %d and the head", data.Source.Slot, data.Target.Slot, jc.justified.Slot)
+	}
+	if _, err := after.Attest(context.Background(), 6); err != nil {
+		t.Errorf("attesting after justification: %v", err)
+	}
+}
+
+func TestNextDuty(t *testing.T) {
+	genesis := uint64(1700000000)
+	clk := clock.NewWithTime(genesis, time.Now)
+	c := NewClient(clk, nil, nil)
+	start := time.Unix(int64(genesis), 0)
+
+	tests := []struct {
+		offset   time.Duration
+		slot     types.Slot
+		interval uint64
+	}{
+		{-time.Minute, 0, types.AttestInterval},
+		{0, 0, types.AttestInterval},
+		{500 * time.Millisecond, 0, types.AttestInterval},
+		{time.Second, 1, types.ProposeInterval},
+		{3 * time.Second, 1, types.ProposeInterval},
+		{4 * time.Second, 1, types.AttestInterval},
+	}
+	for _, tt := range tests {
+		slot, interval := c.nextDuty(start.Add(tt.offset))
+		if slot != tt.slot || interval != tt.interval {
+			t.Errorf("%v: got %d/%d, want %d/%d", tt.offset, slot, interval, tt.slot, tt.interval)
+		}
+	}
+}
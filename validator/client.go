@@ -0,0 +1,62 @@
+package validator
+
+import (
+	"context"
+	"time"
+
+	"github.com/devlongs/gean/common/clock"
+	"github.com/devlongs/gean/common/types"
+)
+
+// Client runs the duties of our validators on the slot clock: blocks are
+// proposed at the start of a slot and attestations are made at the
+// attestation interval.
+type Client struct {
+	clock    *clock.SlotClock
+	proposer *Proposer
+	attester *Attester
+}
+
+// NewClient returns a client that schedules p and a on clk.
+func NewClient(clk *clock.SlotClock, p *Proposer, a *Attester) *Client {
+	return &Client{clock: clk, proposer: p, attester: a}
+}
+
+// Run performs duties until ctx is cancelled. Errors are passed to onError,
+// which may be nil.
+func (c *Client) Run(ctx context.Context, onError func(slot types.Slot, err error)) {
+	for {
+		slot, interval := c.nextDuty(c.clock.Now())
+		timer := time.NewTimer(c.clock.IntervalStart(slot, interval).Sub(c.clock.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		var err error
+		switch interval {
+		case types.ProposeInterval:
+			_, err = c.proposer.Propose(ctx, slot)
+		case types.AttestInterval:
+			_, err = c.attester.Attest(ctx, slot)
+		}
+		if err != nil && onError != nil {
+			onError(slot, err)
+		}
+	}
+}
+
+// nextDuty returns the first duty interval starting after now.
+func (c *Client) nextDuty(now time.Time) (types.Slot, uint64) {
+	if now.Before(c.clock.SlotStart(0)) {
+		// There is no block to propose at genesis.
+		return 0, types.AttestInterval
+	}
+	slot, interval := c.clock.IntervalAt(now)
+	if interval < types.AttestInterval {
+		return slot, types.AttestInterval
+	}
+	return slot + 1, types.ProposeInterval
+}
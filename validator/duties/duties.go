@@ -0,0 +1,82 @@
+// Package duties computes validator duties from the validator registry of
+// a state. It is shared by block processing, the validator client and the
+// HTTP API so they all agree on who proposes when.
+package duties
+
+import (
+	"errors"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+var (
+	ErrNoValidators = errors.New("duties: no validators")
+	ErrLookahead    = errors.New("duties: too many slots requested")
+)
+
+// MaxLookahead bounds the number of slots a single query may cover, so
+// that a request count cannot be used to exhaust memory.
+const MaxLookahead = 1024
+
+// ProposerDuty is the proposer of a single slot.
+type ProposerDuty struct {
+	Slot           types.Slot
+	ValidatorIndex types.ValidatorIndex
+}
+
+// ProposerIndex returns the proposer of slot for a registry of
+// numValidators validators. Lean uses a round-robin rule: slot mod
+// numValidators.
+func ProposerIndex(slot types.Slot, numValidators uint64) (types.ValidatorIndex, error) {
+	if numValidators == 0 {
+		return 0, ErrNoValidators
+	}
+	return types.ValidatorIndex(uint64(slot) % numValidators), nil
+}
+
+// IsProposer reports whether validator proposes slot under state.
+func IsProposer(state *types.State, slot types.Slot, validator types.ValidatorIndex) bool {
+	proposer, err := ProposerIndex(slot, uint64(len(state.Validators)))
+	return err == nil && proposer == validator
+}
+
+// Proposers returns the proposers of the count slots starting at start,
+// using the validator registry of state. count is at most MaxLookahead.
+func Proposers(state *types.State, start types.Slot, count uint64) ([]ProposerDuty, error) {
+	if count > MaxLookahead {
+		return nil, ErrLookahead
+	}
+	n := uint64(len(state.Validators))
+	duties := make([]ProposerDuty, count)
+	for i := range duties {
+		slot := start + types.Slot(i)
+		proposer, err := ProposerIndex(slot, n)
+		if err != nil {
+			return nil, err
+		}
+		duties[i] = ProposerDuty{Slot: slot, ValidatorIndex: proposer}
+	}
+	return duties, nil
+}
+
+// ProposalSlots returns the slots among the count slots starting at start
+// in which validator proposes. count is at most MaxLookahead.
+func ProposalSlots(state *types.State, validator types.ValidatorIndex, start types.Slot, count uint64) ([]types.Slot, error) {
+	if count > MaxLookahead {
+		return nil, ErrLookahead
+	}
+	n := uint64(len(state.Validators))
+	if n == 0 {
+		return nil, ErrNoValidators
+	}
+	if uint64(validator) >= n {
+		return nil, nil
+	}
+	// The first slot at or after start that maps to validator.
+	first := start + types.Slot((uint64(validator)+n-uint64(start)%n)%n)
+	var slots []types.Slot
+	for slot := first; uint64(slot-start) < count; slot += types.Slot(n) {
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
@@ -0,0 +1,99 @@
+package duties
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+func stateWith(n int) *types.State {
+	return &types.State{Validators: make([]types.Validator, n)}
+}
+
+func TestProposerIndex(t *testing.T) {
+	tests := []struct {
+		slot types.Slot
+		n    uint64
+		want types.ValidatorIndex
+	}{
+		{0, 4, 0},
+		{3, 4, 3},
+		{4, 4, 0},
+		{10, 3, 1},
+		{7, 1, 0},
+	}
+	for _, tt := range tests {
+		got, err := ProposerIndex(tt.slot, tt.n)
+		if err != nil || got != tt.want {
+			t.Errorf("ProposerIndex(%d, %d) = %d, %v; want %d", tt.slot, tt.n, got, err, tt.want)
+		}
+	}
+	if _, err := ProposerIndex(5, 0); !errors.Is(err, ErrNoValidators) {
+		t.Errorf("expected ErrNoValidators, got %v", err)
+	}
+}
+
+func TestProposersAcrossValidatorCounts(t *testing.T) {
+	// The same slots map to different proposers once the registry grows.
+	for _, tt := range []struct {
+		n    int
+		want []types.ValidatorIndex
+	}{
+		{2, []types.ValidatorIndex{0, 1, 0, 1, 0}},
+		{3, []types.ValidatorIndex{2, 0, 1, 2, 0}},
+		{5, []types.ValidatorIndex{3, 4, 0, 1, 2}},
+	} {
+		duties, err := Proposers(stateWith(tt.n), 8, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, d := range duties {
+			if d.Slot != types.Slot(8+i) || d.ValidatorIndex != tt.want[i] {
+				t.Errorf("n=%d: duty %d = %+v, want slot %d proposer %d", tt.n, i, d, 8+i, tt.want[i])
+			}
+			if !IsProposer(stateWith(tt.n), d.Slot, d.ValidatorIndex) {
+				t.Errorf("n=%d: IsProposer disagrees at slot %d", tt.n, d.Slot)
+			}
+		}
+	}
+	if _, err := Proposers(stateWith(0), 0, 1); !errors.Is(err, ErrNoValidators) {
+		t.Errorf("expected ErrNoValidators, got %v", err)
+	}
+	if _, err := Proposers(stateWith(4), 0, MaxLookahead+1); !errors.Is(err, ErrLookahead) {
+		t.Errorf("expected ErrLookahead, got %v", err)
+	}
+}
+
+func TestProposalSlots(t *testing.T) {
+	for _, n := range []int{1, 3, 4, 7} {
+		state := stateWith(n)
+		for v := 0; v < n; v++ {
+			slots, err := ProposalSlots(state, types.ValidatorIndex(v), 5, 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []types.Slot
+			for slot := types.Slot(5); slot < 25; slot++ {
+				if IsProposer(state, slot, types.ValidatorIndex(v)) {
+					want = append(want, slot)
+				}
+			}
+			if len(slots) != len(want) {
+				t.Fatalf("n=%d v=%d: got %v, want %v", n, v, slots, want)
+			}
+			for i := range want {
+				if slots[i] != want[i] {
+					t.Errorf("n=%d v=%d: got %v, want %v", n, v, slots, want)
+					break
+				}
+			}
+		}
+	}
+	if slots, _ := ProposalSlots(stateWith(4), 9, 0, 100); len(slots) != 0 {
+		t.Error("unknown validator should have no slots")
+	}
+	if _, err := ProposalSlots(stateWith(1), 0, 0, 1<<40); !errors.Is(err, ErrLookahead) {
+		t.Errorf("expected ErrLookahead, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/validator/duties"
+)
+
+// AttestationSource supplies the aggregates a block at slot may include.
+// The attestation pool implements it.
+type AttestationSource interface {
+	Aggregates(slot types.Slot) []chain.SignedAggregate
+}
+
+// Proposer produces blocks for our validators.
+type Proposer struct {
+	chain     Chain
+	atts      AttestationSource
+	publisher Publisher
+	keys      Keys
+	protect   Protection
+}
+
+// NewProposer returns a proposer. atts may be nil, in which case blocks
+// carry no attestations.
+func NewProposer(c Chain, atts AttestationSource, pub Publisher, keys Keys, protect Protection) *Proposer {
+	return &Proposer{chain: c, atts: atts, publisher: pub, keys: keys, protect: protect}
+}
+
+// Propose builds, signs, imports and broadcasts the block for slot on top
+// of the fork choice head. It returns nil without a block when none of our
+// validators proposes slot.
+func (p *Proposer) Propose(ctx context.Context, slot types.Slot) (*types.SignedBlockWithAttestation, error) {
+	pre := p.chain.HeadState()
+	proposer, err := duties.ProposerIndex(slot, uint64(len(pre.Validators)))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.keys[proposer]; !ok {
+		return nil, nil
+	}
+	signer, err := p.keys.signer(pre, proposer)
+	if err != nil {
+		return nil, err
+	}
+
+	block, post, included, err := p.buildBlock(pre, slot)
+	if err != nil {
+		return nil, err
+	}
+
+	root := chain.BlockRoot(block)
+	source := p.chain.Justified()
+	if post.LatestJustified.Slot > source.Slot {
+		source = post.LatestJustified
+	}
+	head := types.Checkpoint{Root: root, Slot: slot}
+	// The block may justify a checkpoint newer than the safe target.
+	target := attestationTarget(p.chain, head, block.ParentRoot, source)
+	signed := &types.SignedBlockWithAttestation{
+		Message: types.BlockWithAttestation{
+			Block: *block,
+			ProposerAttestation: types.Attestation{
+				ValidatorID: proposer,
+				Data: types.AttestationData{
+					Slot:   slot,
+					Head:   head,
+					Target: target,
+					Source: source,
+				},
+			},
+		},
+	}
+	for _, agg := range included {
+		signed.Signatures = append(signed.Signatures, agg.Signatures...)
+	}
+	signingRoot := chain.ProposerSigningRoot(&signed.Message)
+	if err := p.protect.CheckAndRecordBlock(signer.PublicKey(), slot, signingRoot); err != nil {
+		return nil, err
+	}
+	// The block signature also signs the proposer's vote, so it must not
+	// conflict with the votes signed before either.
+	vote := &signed.Message.ProposerAttestation.Data
+	if err := p.protect.CheckAndRecordAttestation(signer.PublicKey(), vote, chain.AttestationSigningRoot(vote)); err != nil {
+		return nil, err
+	}
+	sig, err := signBlock(ctx, signer, &signed.Message, signingRoot)
+	if err != nil {
+		return nil, fmt.Errorf("sign block: %w", err)
+	}
+	signed.Signatures = append(signed.Signatures, sig)
+
+	if err := p.chain.ImportBlock(ctx, signed); err != nil {
+		return nil, fmt.Errorf("import own block: %w", err)
+	}
+	p.publisher.PublishBlock(signed)
+	return signed, nil
+}
+
+// buildBlock builds the block for slot on pre. Aggregates whose source is
+// the justified checkpoint of the post-state are added, largest first,
+// until no more apply or fit in the block's signature list: including some
+// may justify a new checkpoint that others build on.
+func (p *Proposer) buildBlock(pre *types.State, slot types.Slot) (*types.Block, *types.State, []chain.SignedAggregate, error) {
+	var candidates []chain.SignedAggregate
+	if p.atts != nil {
+		candidates = p.atts.Aggregates(slot)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].Signatures) > len(candidates[j].Signatures)
+	})
+
+	used := make([]bool, len(candidates))
+	var included []chain.SignedAggregate
+	// The block's signatures list also holds the proposer's signature.
+	sigRoom := types.ValidatorRegistryLimit - 1
+	for {
+		atts := make([]types.AggregatedAttestation, len(included))
+		for i := range included {
+			atts[i] = included[i].Attestation
+		}
+		block, post, err := chain.BuildBlock(pre, slot, atts)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		added := false
+		for i, c := range candidates {
+			if used[i] || len(included) == types.AttestationsLimit || len(c.Signatures) > sigRoom {
+				continue
+			}
+			data := &c.Attestation.Data
+			if data.Source != post.LatestJustified || data.Target.Slot >= slot || post.JustifiedSlots.Get(int(data.Target.Slot)) {
+				continue
+			}
+			used[i] = true
+			sigRoom -= len(c.Signatures)
+			included = append(included, c)
+			added = true
+		}
+		if !added {
+			return block, post, included, nil
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/p2p/gossip"
+	"github.com/devlongs/gean/storage"
+	"github.com/devlongs/gean/validator/slashing"
+)
+
+type testPublisher struct {
+	blocks []*types.SignedBlockWithAttestation
+	atts   []*types.SignedAttestation
+}
+
+func (p *testPublisher) PublishBlock(b *types.SignedBlockWithAttestation) gossip.MessageID {
+	p.blocks = append(p.blocks, b)
+	return gossip.MessageID{}
+}
+
+func (p *testPublisher) PublishAttestation(a *types.SignedAttestation) gossip.MessageID {
+	p.atts = append(p.atts, a)
+	return gossip.MessageID{}
+}
+
+type testSource []chain.SignedAggregate
+
+func (s testSource) Aggregates(types.Slot) []chain.SignedAggregate { return s }
+
+// testChain starts a chain of n validators with mock keys and signature
+// verification enabled.
+func testChain(n int) (*chain.Chain, Keys) {
+	keys := make(Keys)
+	validators := make([]types.Validator, n)
+	for i := range validators {
+		s := signature.NewMockSigner(uint64(i))
+		keys[types.ValidatorIndex(i)] = s
+		validators[i] = types.Validator{Pubkey: s.PublicKey(), Index: types.ValidatorIndex(i)}
+	}
+	anchor := chain.Genesis(1700000000, validators)
+	return chain.New(anchor, storage.NewMemoryStore(), signature.MockVerifier{}, 1), keys
+}
+
+func newProtection(t *testing.T) *slashing.DB {
+	t.Helper()
+	db, err := slashing.Open("", types.Root{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// aggregate signs data with the given validators.
+func aggregate(t *testing.T, keys Keys, data types.AttestationData, validators ...int) chain.SignedAggregate {
+	t.Helper()
+	bits := make([]bool, len(keys))
+	for _, v := range validators {
+		bits[v] = true
+	}
+	bl, err := types.BitlistFromBits(bits, types.ValidatorRegistryLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg := chain.SignedAggregate{Attestation: types.AggregatedAttestation{AggregationBits: bl, Data: data}}
+	for i, set := range bits {
+		if !set {
+			continue
+		}
+		sig, err := keys[types.ValidatorIndex(i)].Sign(chain.AttestationSigningRoot(&data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		agg.Signatures = append(agg.Signatures, sig)
+	}
+	return agg
+}
+
+func TestProposeBlock(t *testing.T) {
+	c, keys := testChain(4)
+	pub := &testPublisher{}
+	p := NewProposer(c, nil, pub, keys, newProtection(t))
+
+	block, err := p.Propose(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block == nil || block.Message.Block.ProposerIndex != 1 {
+		t.Fatal("validator 1 should propose slot 1")
+	}
+	root := chain.BlockRoot(&block.Message.Block)
+	if c.Head() != (types.Checkpoint{Root: root, Slot: 1}) {
+		t.Error("proposed block should become the head")
+	}
+	if len(pub.blocks) != 1 || pub.blocks[0] != block {
+		t.Error("block should be published")
+	}
+	att := block.Message.ProposerAttestation
+	if att.ValidatorID != 1 || att.Data.Head.Root != root || att.Data.Source != c.Justified() {
+		t.Errorf("unexpected proposer attestation %+v", att)
+	}
+
+	delete(keys, 2)
+	block, err = p.Propose(context.Background(), 2)
+	if err != nil || block != nil {
+		t.Errorf("no block expected without the proposer key, got %v, %v", block, err)
+	}
+}
+
+func TestProposeIncludesAttestations(t *testing.T) {
+	c, keys := testChain(4)
+	pub := &testPublisher{}
+	genesis := c.Head()
+
+	p := NewProposer(c, nil, pub, keys, newProtection(t))
+	b1, err := p.Propose(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := p.Propose(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp1 := types.Checkpoint{Root: chain.BlockRoot(&b1.Message.Block), Slot: 1}
+	cp2 := types.Checkpoint{Root: chain.BlockRoot(&b2.Message.Block), Slot: 2}
+
+	// The second vote only counts once the first has justified slot 1, so
+	// it is offered first to check that selection iterates.
+	source := testSource{
+		aggregate(t, keys, types.AttestationData{Slot: 2, Head: cp2, Target: cp2, Source: cp1}, 0, 1, 2),
+		aggregate(t, keys, types.AttestationData{Slot: 2, Head: cp2, Target: cp1, Source: genesis}, 0, 1, 2),
+		aggregate(t, keys, types.AttestationData{Slot: 2, Head: cp2, Target: cp2, Source: cp2}, 3),
+	}
+	p = NewProposer(c, source, pub, keys, newProtection(t))
+	b3, err := p.Propose(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(b3.Message.Block.Body.Attestations); n != 2 {
+		t.Fatalf("expected 2 attestations, got %d", n)
+	}
+	if len(b3.Signatures) != 7 {
+		t.Errorf("expected 7 signatures, got %d", len(b3.Signatures))
+	}
+	if c.Justified() != cp2 || c.Finalized() != cp1 {
+		t.Errorf("justified %v finalized %v", c.Justified(), c.Finalized())
+	}
+}
+
+func TestProposeRefusesSlashableVote(t *testing.T) {
+	c, keys := testChain(4)
+	protect := newProtection(t)
+
+	// Validator 1 already voted at slot 1 for something else.
+	vote := types.AttestationData{Slot: 1, Head: c.Head(), Target: c.Head(), Source: c.Justified()}
+	if err := protect.CheckAndRecordAttestation(keys[1].PublicKey(), &vote, types.Root{1}); err != nil {
+		t.Fatal(err)
+	}
+	pub := &testPublisher{}
+	block, err := NewProposer(c, nil, pub, keys, protect).Propose(context.Background(), 1)
+	if !errors.Is(err, slashing.ErrSlashable) || block != nil {
+		t.Errorf("expected the conflicting proposer vote to be refused, got %v, %v", block, err)
+	}
+	if len(pub.blocks) != 0 {
+		t.Error("no block should be published")
+	}
+}
@@ -0,0 +1,217 @@
+package remotesigner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/xmss"
+)
+
+// Client talks to a remote signer service.
+type Client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+// NewClient returns a client for the service at baseURL that authenticates
+// with token. Use an https URL unless the service is on the same host: the
+// token is sent with every request.
+func NewClient(baseURL, token string, timeout time.Duration) *Client {
+	return &Client{url: strings.TrimSuffix(baseURL, "/"), token: token, http: &http.Client{Timeout: timeout}}
+}
+
+// PublicKeys lists the keys the service holds.
+func (c *Client) PublicKeys(ctx context.Context) ([]types.Bytes52, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+publicKeysPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	if err := c.do(req, &keys); err != nil {
+		return nil, err
+	}
+	out := make([]types.Bytes52, len(keys))
+	for i, k := range keys {
+		if out[i], err = ParsePublicKey(k); err != nil {
+			return nil, fmt.Errorf("public key %d: %w", i, err)
+		}
+	}
+	return out, nil
+}
+
+// Signer returns a signer for one of the service's keys.
+func (c *Client) Signer(pubkey types.Bytes52) *Signer {
+	return &Signer{client: c, pubkey: pubkey}
+}
+
+func (c *Client) sign(ctx context.Context, pubkey types.Bytes52, body *signRequest) (types.Bytes3116, error) {
+	var sig types.Bytes3116
+	data, err := json.Marshal(body)
+	if err != nil {
+		return sig, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+signPath+encodeHex(pubkey[:]), bytes.NewReader(data))
+	if err != nil {
+		return sig, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var resp signResponse
+	if err := c.do(req, &resp); err != nil {
+		return sig, err
+	}
+	if err := decodeFixed(resp.Signature, sig[:]); err != nil {
+		return sig, fmt.Errorf("remote signer: signature: %w", err)
+	}
+	return sig, nil
+}
+
+func (c *Client) do(req *http.Request, out any) error {
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.Unmarshal(body, out)
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %s", ErrRefused, strings.TrimSpace(string(body)))
+	default:
+		return fmt.Errorf("remote signer: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+}
+
+// Signer signs with a key held by the remote service. It only serves typed
+// requests; Sign always fails with ErrUntyped.
+type Signer struct {
+	client *Client
+	pubkey types.Bytes52
+}
+
+func (s *Signer) PublicKey() types.Bytes52 { return s.pubkey }
+
+func (s *Signer) Sign(types.Root) (types.Bytes3116, error) {
+	return types.Bytes3116{}, ErrUntyped
+}
+
+func (s *Signer) SignBlock(ctx context.Context, block *types.BlockWithAttestation, signingRoot types.Root) (types.Bytes3116, error) {
+	return s.client.sign(ctx, s.pubkey, &signRequest{
+		Type:        TypeBlock,
+		SigningRoot: encodeHex(signingRoot[:]),
+		Block:       encodeHex(ssz.MarshalBlockWithAttestation(block)),
+	})
+}
+
+func (s *Signer) SignAttestation(ctx context.Context, data *types.AttestationData, signingRoot types.Root) (types.Bytes3116, error) {
+	return s.client.sign(ctx, s.pubkey, &signRequest{
+		Type:            TypeAttestation,
+		SigningRoot:     encodeHex(signingRoot[:]),
+		AttestationData: encodeHex(ssz.MarshalAttestationData(data)),
+	})
+}
+
+// Fallback signs through the remote service and uses a local key only when
+// the service cannot be reached: the connection was refused or the host was
+// not found, so no request was sent. Answers from the service, refusals
+// included, are never retried locally, and neither are timeouts: the
+// service may have signed before the answer was lost.
+//
+// XMSS keys are stateful, so the local signer is restricted to a leaf range
+// the service must never use. Every remote signature is checked, and once
+// the service signs with a leaf of the local range the fallback is disabled.
+type Fallback struct {
+	remote *Signer
+	local  *xmss.Signer
+
+	mu      sync.Mutex
+	overlap error
+}
+
+// NewFallback returns a fallback from remote to local, which must hold the
+// same key restricted to part of its leaves.
+func NewFallback(remote *Signer, local *xmss.Signer) (*Fallback, error) {
+	if remote.PublicKey() != local.PublicKey() {
+		return nil, errors.New("remote signer: fallback key differs from the remote key")
+	}
+	if first, end := local.LeafRange(); first == 0 && end == local.Params().Lifetime() {
+		return nil, errors.New("remote signer: fallback key must be restricted to a leaf range the service does not use")
+	}
+	return &Fallback{remote: remote, local: local}, nil
+}
+
+func (f *Fallback) PublicKey() types.Bytes52 { return f.remote.PublicKey() }
+
+// Sign signs untyped messages with the local key.
+func (f *Fallback) Sign(msg types.Root) (types.Bytes3116, error) {
+	return f.signLocal(msg)
+}
+
+func (f *Fallback) SignBlock(ctx context.Context, block *types.BlockWithAttestation, signingRoot types.Root) (types.Bytes3116, error) {
+	sig, err := f.remote.SignBlock(ctx, block, signingRoot)
+	return f.result(sig, err, signingRoot)
+}
+
+func (f *Fallback) SignAttestation(ctx context.Context, data *types.AttestationData, signingRoot types.Root) (types.Bytes3116, error) {
+	sig, err := f.remote.SignAttestation(ctx, data, signingRoot)
+	return f.result(sig, err, signingRoot)
+}
+
+// result checks the leaf of a remote signature, or signs locally if the
+// service could not be reached.
+func (f *Fallback) result(sig types.Bytes3116, err error, signingRoot types.Root) (types.Bytes3116, error) {
+	if err == nil {
+		f.checkLeaf(&sig)
+		return sig, nil
+	}
+	if !unreachable(err) {
+		return sig, err
+	}
+	return f.signLocal(signingRoot)
+}
+
+func (f *Fallback) checkLeaf(sig *types.Bytes3116) {
+	parsed, err := xmss.ParseSignature(f.local.Params(), sig)
+	if err != nil {
+		return
+	}
+	first, end := f.local.LeafRange()
+	if leaf := uint64(parsed.Leaf); leaf >= first && leaf < end {
+		f.mu.Lock()
+		f.overlap = fmt.Errorf("remote signer used leaf %d of the local range [%d, %d)", leaf, first, end)
+		f.mu.Unlock()
+	}
+}
+
+func (f *Fallback) signLocal(msg types.Root) (types.Bytes3116, error) {
+	f.mu.Lock()
+	overlap := f.overlap
+	f.mu.Unlock()
+	if overlap != nil {
+		return types.Bytes3116{}, fmt.Errorf("local fallback disabled: %w", overlap)
+	}
+	return f.local.Sign(msg)
+}
+
+// unreachable reports whether err means the request was never sent: the
+// dial failed for another reason than a timeout.
+func unreachable(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial" && !opErr.Timeout()
+}
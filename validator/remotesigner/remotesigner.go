@@ -0,0 +1,92 @@
+// Package remotesigner keeps validator keys off the node host. The node
+// sends each signing request over HTTP to a signer service, in the style of
+// Web3Signer, together with the typed object being signed so the service
+// can check the signing root and apply its own slashing protection.
+//
+// Endpoints:
+//
+//	GET  /api/v1/lean/publicKeys       -> ["0x<pubkey>", ...]
+//	POST /api/v1/lean/sign/0x<pubkey>  -> {"signature": "0x<signature>"}
+//
+// Every request carries the service's token in an "Authorization: Bearer"
+// header; the service answers 401 without it.
+//
+// A sign request carries "type" ("block" or "attestation"), "signing_root"
+// and the SSZ-encoded BlockWithAttestation or AttestationData, hex-encoded,
+// in "block" or "attestation_data". The service answers 400 for malformed
+// requests or a signing root that does not match the object, 404 for an
+// unknown key and 412 when slashing protection refuses to sign.
+package remotesigner
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+const (
+	publicKeysPath = "/api/v1/lean/publicKeys"
+	signPath       = "/api/v1/lean/sign/"
+)
+
+// Request types.
+const (
+	TypeBlock       = "block"
+	TypeAttestation = "attestation"
+)
+
+var (
+	// ErrRefused is returned when the signer's slashing protection refuses
+	// a request.
+	ErrRefused = errors.New("remote signer refused to sign")
+
+	// ErrUntyped is returned by Signer.Sign: the remote signer needs to
+	// know what it signs.
+	ErrUntyped = errors.New("remote signer needs a typed signing request")
+)
+
+type signRequest struct {
+	Type            string `json:"type"`
+	SigningRoot     string `json:"signing_root"`
+	Block           string `json:"block,omitempty"`
+	AttestationData string `json:"attestation_data,omitempty"`
+}
+
+type signResponse struct {
+	Signature string `json:"signature"`
+}
+
+func encodeHex(b []byte) string { return "0x" + hex.EncodeToString(b) }
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+func decodeFixed(s string, out []byte) error {
+	b, err := decodeHex(s)
+	if err != nil {
+		return err
+	}
+	if len(b) != len(out) {
+		return fmt.Errorf("expected %d bytes, got %d", len(out), len(b))
+	}
+	copy(out, b)
+	return nil
+}
+
+// ParsePublicKey decodes a hex-encoded public key.
+func ParsePublicKey(s string) (types.Bytes52, error) {
+	var pk types.Bytes52
+	err := decodeFixed(s, pk[:])
+	return pk, err
+}
+
+// ParseRoot decodes a hex-encoded root.
+func ParseRoot(s string) (types.Root, error) {
+	var r types.Root
+	err := decodeFixed(s, r[:])
+	return r, err
+}
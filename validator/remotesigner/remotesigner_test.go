@@ -0,0 +1,212 @@
+package remotesigner
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/crypto/xmss"
+	"github.com/devlongs/gean/validator"
+	"github.com/devlongs/gean/validator/slashing"
+)
+
+var (
+	_ validator.BlockSigner       = (*Signer)(nil)
+	_ validator.AttestationSigner = (*Signer)(nil)
+	_ validator.BlockSigner       = (*Fallback)(nil)
+	_ validator.AttestationSigner = (*Fallback)(nil)
+)
+
+const testToken = "secret"
+
+func setup(t *testing.T) (*Client, signature.Signer) {
+	t.Helper()
+	key := signature.NewMockSigner(1)
+	db, _ := slashing.Open("", types.Root{})
+	srv := httptest.NewServer(NewServer([]signature.Signer{key}, db, testToken))
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL, testToken, time.Second), key
+}
+
+func testBlock(slot types.Slot) *types.BlockWithAttestation {
+	return &types.BlockWithAttestation{
+		Block: types.Block{Slot: slot, ProposerIndex: 1, ParentRoot: types.Root{1}},
+		ProposerAttestation: types.Attestation{
+			ValidatorID: 1,
+			Data:        types.AttestationData{Slot: slot, Target: types.Checkpoint{Slot: slot}},
+		},
+	}
+}
+
+func TestRemoteSigning(t *testing.T) {
+	client, key := setup(t)
+	keys, err := client.PublicKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != key.PublicKey() {
+		t.Fatalf("public keys = %x", keys)
+	}
+	remote := client.Signer(key.PublicKey())
+
+	block := testBlock(3)
+	root := chain.ProposerSigningRoot(block)
+	sig, err := remote.SignBlock(context.Background(), block, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (signature.MockVerifier{}).Verify(key.PublicKey(), root, &sig); err != nil {
+		t.Errorf("block signature: %v", err)
+	}
+
+	data := &block.ProposerAttestation.Data
+	root = chain.AttestationSigningRoot(data)
+	sig, err = remote.SignAttestation(context.Background(), data, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (signature.MockVerifier{}).Verify(key.PublicKey(), root, &sig); err != nil {
+		t.Errorf("attestation signature: %v", err)
+	}
+
+	if _, err := remote.SignAttestation(context.Background(), data, types.Root{9}); err == nil || errors.Is(err, ErrRefused) {
+		t.Errorf("expected a rejected signing root, got %v", err)
+	}
+	if _, err := remote.Sign(root); !errors.Is(err, ErrUntyped) {
+		t.Errorf("expected ErrUntyped, got %v", err)
+	}
+	if _, err := client.Signer(types.Bytes52{7}).SignAttestation(context.Background(), data, root); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		other := NewClient(client.url, token, time.Second)
+		if _, err := other.PublicKeys(context.Background()); err == nil {
+			t.Errorf("token %q: expected the request to be refused", token)
+		}
+		if _, err := other.Signer(key.PublicKey()).SignAttestation(context.Background(), data, root); err == nil {
+			t.Errorf("token %q: expected signing to be refused", token)
+		}
+	}
+}
+
+func TestRemoteSlashingProtection(t *testing.T) {
+	client, key := setup(t)
+	remote := client.Signer(key.PublicKey())
+
+	block := testBlock(3)
+	if _, err := remote.SignBlock(context.Background(), block, chain.ProposerSigningRoot(block)); err != nil {
+		t.Fatal(err)
+	}
+	other := testBlock(3)
+	other.Block.ParentRoot = types.Root{2}
+	if _, err := remote.SignBlock(context.Background(), other, chain.ProposerSigningRoot(other)); !errors.Is(err, ErrRefused) {
+		t.Errorf("expected ErrRefused for a double proposal, got %v", err)
+	}
+}
+
+// fallbackSetup serves key to the returned client, restricted to the leaves
+// in [first, end).
+func fallbackSetup(t *testing.T, key *xmss.PrivateKey, first, end uint64) (*Client, *httptest.Server) {
+	t.Helper()
+	signer, err := xmss.NewRangeSigner(key, &xmss.MemoryLeafStore{}, first, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _ := slashing.Open("", types.Root{})
+	srv := httptest.NewServer(NewServer([]signature.Signer{signer}, db, testToken))
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL, testToken, time.Second), srv
+}
+
+func TestFallback(t *testing.T) {
+	params := xmss.Params{TreeHeight: 3}
+	key, err := xmss.GenerateKey(params, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := xmss.NewRangeSigner(key, &xmss.MemoryLeafStore{}, 4, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ := fallbackSetup(t, key, 0, 4)
+	remote := client.Signer(key.PublicKey())
+
+	full, _ := xmss.NewSigner(key, &xmss.MemoryLeafStore{})
+	if _, err := NewFallback(remote, full); err == nil {
+		t.Error("expected an unrestricted local key to be refused")
+	}
+	f, err := NewFallback(remote, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Refusals are final.
+	block := testBlock(3)
+	if _, err := f.SignBlock(context.Background(), block, chain.ProposerSigningRoot(block)); err != nil {
+		t.Fatal(err)
+	}
+	other := testBlock(3)
+	other.Block.ParentRoot = types.Root{2}
+	if _, err := f.SignBlock(context.Background(), other, chain.ProposerSigningRoot(other)); !errors.Is(err, ErrRefused) {
+		t.Errorf("expected the refusal to be kept, got %v", err)
+	}
+
+	// An unreachable signer falls back to the local key.
+	down, _ := NewFallback(NewClient("http://127.0.0.1:1", testToken, time.Second).Signer(key.PublicKey()), local)
+	data := &block.ProposerAttestation.Data
+	root := chain.AttestationSigningRoot(data)
+	sig, err := down.SignAttestation(context.Background(), data, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xmss.Verify(params, key.PublicKey(), root, &sig); err != nil {
+		t.Errorf("fallback signature: %v", err)
+	}
+	if parsed, _ := xmss.ParseSignature(params, &sig); parsed.Leaf != 4 {
+		t.Errorf("fallback signed with leaf %d, want 4", parsed.Leaf)
+	}
+
+	// A signer that does not answer in time may still have signed.
+	release := make(chan struct{})
+	stuck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer stuck.Close()
+	defer close(release)
+	slow, _ := NewFallback(NewClient(stuck.URL, testToken, 50*time.Millisecond).Signer(key.PublicKey()), local)
+	if _, err := slow.SignAttestation(context.Background(), data, root); err == nil {
+		t.Error("a timeout must not fall back to the local key")
+	}
+}
+
+func TestFallbackDisabledByOverlap(t *testing.T) {
+	key, err := xmss.GenerateKey(xmss.Params{TreeHeight: 3}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, _ := xmss.NewRangeSigner(key, &xmss.MemoryLeafStore{}, 4, 8)
+	// The service is misconfigured to use the local range too.
+	client, srv := fallbackSetup(t, key, 4, 8)
+	f, err := NewFallback(client.Signer(key.PublicKey()), local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &testBlock(3).ProposerAttestation.Data
+	root := chain.AttestationSigningRoot(data)
+	if _, err := f.SignAttestation(context.Background(), data, root); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	if _, err := f.SignAttestation(context.Background(), data, root); err == nil {
+		t.Error("the fallback should be disabled once the service used a local leaf")
+	}
+}
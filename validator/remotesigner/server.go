@@ -0,0 +1,161 @@
+package remotesigner
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/devlongs/gean/chain"
+	"github.com/devlongs/gean/common/ssz"
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+)
+
+// Protection refuses to sign messages that conflict with ones signed
+// before. *slashing.DB implements it.
+type Protection interface {
+	CheckAndRecordBlock(pubkey types.Bytes52, slot types.Slot, signingRoot types.Root) error
+	CheckAndRecordAttestation(pubkey types.Bytes52, data *types.AttestationData, signingRoot types.Root) error
+}
+
+// Server is the signer service. It only serves clients presenting its
+// bearer token and only signs roots that match the typed object sent along
+// with them, once protect agrees.
+type Server struct {
+	keys    map[types.Bytes52]signature.Signer
+	protect Protection
+	token   string
+}
+
+// NewServer serves the given keys to clients presenting token. Every
+// request is checked against protect, which must not be nil. An empty
+// token refuses all clients.
+func NewServer(keys []signature.Signer, protect Protection, token string) *Server {
+	s := &Server{keys: make(map[types.Bytes52]signature.Signer), protect: protect, token: token}
+	for _, k := range keys {
+		s.keys[k.PublicKey()] = k
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == publicKeysPath:
+		s.handlePublicKeys(w)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, signPath):
+		s.handleSign(w, r, strings.TrimPrefix(r.URL.Path, signPath))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *Server) handlePublicKeys(w http.ResponseWriter) {
+	keys := make([]string, 0, len(s.keys))
+	for pk := range s.keys {
+		keys = append(keys, encodeHex(pk[:]))
+	}
+	sort.Strings(keys)
+	writeJSON(w, keys)
+}
+
+func (s *Server) handleSign(w http.ResponseWriter, r *http.Request, id string) {
+	pubkey, err := ParsePublicKey(id)
+	if err != nil {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	signer, ok := s.keys[pubkey]
+	if !ok {
+		http.Error(w, "unknown public key", http.StatusNotFound)
+		return
+	}
+
+	var req signRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	var root types.Root
+	if err := decodeFixed(req.SigningRoot, root[:]); err != nil {
+		http.Error(w, "invalid signing root", http.StatusBadRequest)
+		return
+	}
+
+	check, err := s.check(pubkey, &req, root)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := check(); err != nil {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	sig, err := signer.Sign(root)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, signResponse{Signature: encodeHex(sig[:])})
+}
+
+// check decodes the typed object of req, verifies that root is its signing
+// root and returns the slashing protection check to run before signing.
+func (s *Server) check(pubkey types.Bytes52, req *signRequest, root types.Root) (func() error, error) {
+	switch req.Type {
+	case TypeBlock:
+		raw, err := decodeHex(req.Block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block encoding")
+		}
+		block, err := ssz.UnmarshalBlockWithAttestation(raw, types.AttestationsLimit, types.ValidatorRegistryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block: %v", err)
+		}
+		if chain.ProposerSigningRoot(block) != root {
+			return nil, errors.New("signing root does not match block")
+		}
+		return func() error {
+			return s.protect.CheckAndRecordBlock(pubkey, block.Block.Slot, root)
+		}, nil
+
+	case TypeAttestation:
+		raw, err := decodeHex(req.AttestationData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attestation data encoding")
+		}
+		data, err := ssz.UnmarshalAttestationData(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attestation data: %v", err)
+		}
+		if chain.AttestationSigningRoot(data) != root {
+			return nil, errors.New("signing root does not match attestation data")
+		}
+		return func() error {
+			return s.protect.CheckAndRecordAttestation(pubkey, data, root)
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown request type %q", req.Type)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,437 @@
+// Package slashing keeps a record of what our validators signed so that
+// they never sign conflicting messages, even across restarts or after
+// moving keys to another machine.
+//
+// The database is stored in, and can be exchanged as, a JSON interchange
+// format modelled on EIP-3076. Lean has no epochs, so attestations are
+// recorded by slot together with their source and target slots, and the
+// network is identified by its genesis block root.
+//
+// Only the minimal history is kept, as the minimal signing conditions of
+// EIP-3076 need no more: per validator, the latest proposal and a watermark
+// of the highest attestation slot, source and target signed. Signing below
+// a watermark is refused, so the database does not grow with time.
+package slashing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+// FormatVersion is the interchange format version written and accepted.
+const FormatVersion = "5"
+
+var ErrSlashable = errors.New("slashing protection: refusing to sign")
+
+type signedBlock struct {
+	slot types.Slot
+	root types.Root
+}
+
+type signedAttestation struct {
+	slot       types.Slot
+	source     types.Slot
+	target     types.Slot
+	root       types.Root
+	targetRoot types.Root
+}
+
+// history is the minimal history of a validator. A zero root means it is
+// unknown, as it may be for imported history or merged conflicting records.
+type history struct {
+	// block is the latest proposal.
+	block *signedBlock
+	// attestation holds the highest slot signed with its signing root, the
+	// highest source, and the highest target with its root.
+	attestation *signedAttestation
+}
+
+// mergeBlock returns the latest of the proposals a and b.
+func mergeBlock(a *signedBlock, b signedBlock) *signedBlock {
+	switch {
+	case a == nil || b.slot > a.slot:
+		return &b
+	case b.slot == a.slot && b.root != a.root:
+		return &signedBlock{slot: a.slot}
+	}
+	return a
+}
+
+// mergeAttestation returns the watermark covering both a and b.
+func mergeAttestation(a *signedAttestation, b signedAttestation) *signedAttestation {
+	if a == nil {
+		return &b
+	}
+	m := *a
+	switch {
+	case b.slot > m.slot:
+		m.slot, m.root = b.slot, b.root
+	case b.slot == m.slot && b.root != m.root:
+		m.root = types.Root{}
+	}
+	switch {
+	case b.target > m.target:
+		m.target, m.targetRoot = b.target, b.targetRoot
+	case b.target == m.target && b.targetRoot != m.targetRoot:
+		m.targetRoot = types.Root{}
+	}
+	m.source = max(m.source, b.source)
+	return &m
+}
+
+// DB is a slashing protection database. Every check that passes is
+// persisted before it returns, so a signature is only made once it is on
+// disk.
+type DB struct {
+	path        string
+	genesisRoot types.Root
+
+	mu         sync.Mutex
+	validators map[types.Bytes52]*history
+}
+
+// Open loads the database at path, creating it on first use. An empty path
+// gives a database that is only kept in memory.
+func Open(path string, genesisRoot types.Root) (*DB, error) {
+	db := &DB{path: path, genesisRoot: genesisRoot, validators: make(map[types.Bytes52]*history)}
+	if path == "" {
+		return db, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := db.Import(f); err != nil {
+		return nil, fmt.Errorf("slashing protection %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func (db *DB) historyLocked(pubkey types.Bytes52) *history {
+	h, ok := db.validators[pubkey]
+	if !ok {
+		h = &history{}
+		db.validators[pubkey] = h
+	}
+	return h
+}
+
+// CheckAndRecordBlock records a block proposal at slot with the given
+// signing root. Proposing a different block at a slot already proposed,
+// or at a slot older than the latest proposal, is refused. Re-signing the
+// same block is allowed unless its signing root is unknown, as it may be
+// for imported history.
+func (db *DB) CheckAndRecordBlock(pubkey types.Bytes52, slot types.Slot, signingRoot types.Root) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	h := db.historyLocked(pubkey)
+	if b := h.block; b != nil {
+		if b.slot == slot {
+			if b.root == signingRoot && !b.root.IsZero() {
+				return nil
+			}
+			return fmt.Errorf("%w: double proposal at slot %d", ErrSlashable, slot)
+		}
+		if b.slot > slot {
+			return fmt.Errorf("%w: block at slot %d is older than proposal at slot %d", ErrSlashable, slot, b.slot)
+		}
+	}
+	prev := h.block
+	h.block = &signedBlock{slot: slot, root: signingRoot}
+	if err := db.saveLocked(); err != nil {
+		h.block = prev
+		return err
+	}
+	return nil
+}
+
+// CheckAndRecordAttestation records an attestation with the given signing
+// root. It is refused unless it is newer than every earlier attestation: a
+// later slot, a source no older than any signed, and a target no older
+// than any signed. A vote for the highest target signed so far must repeat
+// its source and target checkpoints; anything else is a double vote. Votes
+// that surround or are surrounded by an earlier one fail these checks too.
+// Re-signing the latest attestation is allowed unless its signing root is
+// unknown.
+func (db *DB) CheckAndRecordAttestation(pubkey types.Bytes52, data *types.AttestationData, signingRoot types.Root) error {
+	if data.Source.Slot > data.Target.Slot {
+		return fmt.Errorf("%w: source slot %d after target slot %d", ErrSlashable, data.Source.Slot, data.Target.Slot)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	h := db.historyLocked(pubkey)
+	att := signedAttestation{
+		slot:       data.Slot,
+		source:     data.Source.Slot,
+		target:     data.Target.Slot,
+		root:       signingRoot,
+		targetRoot: data.Target.Root,
+	}
+	if w := h.attestation; w != nil {
+		switch {
+		case att.slot == w.slot && att.root == w.root && !w.root.IsZero():
+			return nil
+		case att.slot == w.slot:
+			return fmt.Errorf("%w: double vote at slot %d", ErrSlashable, att.slot)
+		case att.slot < w.slot:
+			return fmt.Errorf("%w: vote at slot %d is older than vote at slot %d", ErrSlashable, att.slot, w.slot)
+		case att.source < w.source:
+			return fmt.Errorf("%w: source slot %d is older than source slot %d", ErrSlashable, att.source, w.source)
+		case att.target < w.target:
+			return fmt.Errorf("%w: target slot %d is older than target slot %d", ErrSlashable, att.target, w.target)
+		case att.target == w.target && (att.source != w.source || att.targetRoot != w.targetRoot || w.targetRoot.IsZero()):
+			return fmt.Errorf("%w: double vote for target slot %d", ErrSlashable, att.target)
+		}
+	}
+	prev := h.attestation
+	h.attestation = &att
+	if err := db.saveLocked(); err != nil {
+		h.attestation = prev
+		return err
+	}
+	return nil
+}
+
+// interchange is the JSON interchange document.
+type interchange struct {
+	Metadata struct {
+		FormatVersion string `json:"interchange_format_version"`
+		GenesisRoot   string `json:"genesis_root"`
+	} `json:"metadata"`
+	Data []interchangeValidator `json:"data"`
+}
+
+type interchangeValidator struct {
+	Pubkey             string                   `json:"pubkey"`
+	SignedBlocks       []interchangeBlock       `json:"signed_blocks"`
+	SignedAttestations []interchangeAttestation `json:"signed_attestations"`
+}
+
+type interchangeBlock struct {
+	Slot        string `json:"slot"`
+	SigningRoot string `json:"signing_root,omitempty"`
+}
+
+type interchangeAttestation struct {
+	Slot        string `json:"slot"`
+	SourceSlot  string `json:"source_slot"`
+	TargetSlot  string `json:"target_slot"`
+	SigningRoot string `json:"signing_root,omitempty"`
+	TargetRoot  string `json:"target_root,omitempty"`
+}
+
+// Export writes the database in the interchange format. Each validator has
+// at most one block and one attestation, its watermarks.
+func (db *DB) Export(w io.Writer) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.exportLocked(w)
+}
+
+func (db *DB) exportLocked(w io.Writer) error {
+	var doc interchange
+	doc.Metadata.FormatVersion = FormatVersion
+	doc.Metadata.GenesisRoot = encodeHex(db.genesisRoot[:])
+
+	pubkeys := make([]types.Bytes52, 0, len(db.validators))
+	for pk := range db.validators {
+		pubkeys = append(pubkeys, pk)
+	}
+	sort.Slice(pubkeys, func(i, j int) bool { return string(pubkeys[i][:]) < string(pubkeys[j][:]) })
+
+	doc.Data = make([]interchangeValidator, 0, len(pubkeys))
+	for _, pk := range pubkeys {
+		h := db.validators[pk]
+		v := interchangeValidator{
+			Pubkey:             encodeHex(pk[:]),
+			SignedBlocks:       []interchangeBlock{},
+			SignedAttestations: []interchangeAttestation{},
+		}
+		if b := h.block; b != nil {
+			v.SignedBlocks = append(v.SignedBlocks, interchangeBlock{
+				Slot:        formatSlot(b.slot),
+				SigningRoot: encodeRoot(b.root),
+			})
+		}
+		if a := h.attestation; a != nil {
+			v.SignedAttestations = append(v.SignedAttestations, interchangeAttestation{
+				Slot:        formatSlot(a.slot),
+				SourceSlot:  formatSlot(a.source),
+				TargetSlot:  formatSlot(a.target),
+				SigningRoot: encodeRoot(a.root),
+				TargetRoot:  encodeRoot(a.targetRoot),
+			})
+		}
+		doc.Data = append(doc.Data, v)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&doc)
+}
+
+// Import merges an interchange document into the database. Documents for
+// another network or format version are rejected. Merging only raises the
+// watermarks, so importing can make signing stricter but never looser.
+func (db *DB) Import(r io.Reader) error {
+	var doc interchange
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return fmt.Errorf("decode interchange: %w", err)
+	}
+	if doc.Metadata.FormatVersion != FormatVersion {
+		return fmt.Errorf("unsupported interchange format version %q", doc.Metadata.FormatVersion)
+	}
+	genesis, err := decodeRoot(doc.Metadata.GenesisRoot)
+	if err != nil {
+		return fmt.Errorf("genesis root: %w", err)
+	}
+	if genesis != db.genesisRoot {
+		return fmt.Errorf("interchange is for genesis %x, not %x", genesis[:4], db.genesisRoot[:4])
+	}
+
+	imported := make(map[types.Bytes52]*history)
+	for _, v := range doc.Data {
+		var pk types.Bytes52
+		if err := decodeHex(v.Pubkey, pk[:]); err != nil {
+			return fmt.Errorf("pubkey: %w", err)
+		}
+		h := &history{}
+		for _, b := range v.SignedBlocks {
+			slot, err := parseSlot(b.Slot)
+			if err != nil {
+				return err
+			}
+			root, err := decodeRoot(b.SigningRoot)
+			if err != nil {
+				return fmt.Errorf("block signing root: %w", err)
+			}
+			h.block = mergeBlock(h.block, signedBlock{slot: slot, root: root})
+		}
+		for _, a := range v.SignedAttestations {
+			var att signedAttestation
+			if att.slot, err = parseSlot(a.Slot); err != nil {
+				return err
+			}
+			if att.source, err = parseSlot(a.SourceSlot); err != nil {
+				return err
+			}
+			if att.target, err = parseSlot(a.TargetSlot); err != nil {
+				return err
+			}
+			if att.root, err = decodeRoot(a.SigningRoot); err != nil {
+				return fmt.Errorf("attestation signing root: %w", err)
+			}
+			if att.targetRoot, err = decodeRoot(a.TargetRoot); err != nil {
+				return fmt.Errorf("attestation target root: %w", err)
+			}
+			h.attestation = mergeAttestation(h.attestation, att)
+		}
+		imported[pk] = h
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for pk, in := range imported {
+		h := db.historyLocked(pk)
+		if in.block != nil {
+			h.block = mergeBlock(h.block, *in.block)
+		}
+		if in.attestation != nil {
+			h.attestation = mergeAttestation(h.attestation, *in.attestation)
+		}
+	}
+	return db.saveLocked()
+}
+
+// saveLocked atomically replaces the database file.
+func (db *DB) saveLocked() error {
+	if db.path == "" {
+		return nil
+	}
+	dir := filepath.Dir(db.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(db.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := db.exportLocked(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		return err
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func formatSlot(s types.Slot) string { return strconv.FormatUint(uint64(s), 10) }
+
+func parseSlot(s string) (types.Slot, error) {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid slot %q", s)
+	}
+	return types.Slot(v), nil
+}
+
+func encodeHex(b []byte) string { return "0x" + hex.EncodeToString(b) }
+
+// encodeRoot leaves unknown signing roots out, as EIP-3076 does.
+func encodeRoot(r types.Root) string {
+	if r.IsZero() {
+		return ""
+	}
+	return encodeHex(r[:])
+}
+
+func decodeRoot(s string) (types.Root, error) {
+	var r types.Root
+	if s == "" {
+		return r, nil
+	}
+	err := decodeHex(s, r[:])
+	return r, err
+}
+
+func decodeHex(s string, out []byte) error {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return err
+	}
+	if len(b) != len(out) {
+		return fmt.Errorf("expected %d bytes, got %d", len(out), len(b))
+	}
+	copy(out, b)
+	return nil
+}
@@ -0,0 +1,206 @@
+package slashing
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devlongs/gean/common/types"
+)
+
+var (
+	genesis = types.Root{0xaa}
+	alice   = types.Bytes52{1}
+	bob     = types.Bytes52{2}
+)
+
+// vote returns a vote whose checkpoint roots are derived from their slots.
+func vote(slot, source, target types.Slot) *types.AttestationData {
+	return &types.AttestationData{
+		Slot:   slot,
+		Source: types.Checkpoint{Root: types.Root{byte(source), 1}, Slot: source},
+		Target: types.Checkpoint{Root: types.Root{byte(target), 1}, Slot: target},
+	}
+}
+
+func TestBlockProtection(t *testing.T) {
+	db, _ := Open("", genesis)
+	if err := db.CheckAndRecordBlock(alice, 5, types.Root{1}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		slot types.Slot
+		root types.Root
+		ok   bool
+	}{
+		{"same block", 5, types.Root{1}, true},
+		{"double proposal", 5, types.Root{2}, false},
+		{"older slot", 4, types.Root{3}, false},
+		{"newer slot", 6, types.Root{4}, true},
+	}
+	for _, tt := range tests {
+		err := db.CheckAndRecordBlock(alice, tt.slot, tt.root)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrSlashable) {
+			t.Errorf("%s: expected ErrSlashable, got %v", tt.name, err)
+		}
+	}
+	if err := db.CheckAndRecordBlock(bob, 5, types.Root{2}); err != nil {
+		t.Errorf("validators are tracked separately: %v", err)
+	}
+}
+
+func TestAttestationProtection(t *testing.T) {
+	db, _ := Open("", genesis)
+	if err := db.CheckAndRecordAttestation(alice, vote(10, 4, 8), types.Root{1}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data *types.AttestationData
+		root types.Root
+		ok   bool
+	}{
+		{"same vote", vote(10, 4, 8), types.Root{1}, true},
+		{"double vote", vote(10, 4, 9), types.Root{2}, false},
+		{"surrounding", vote(11, 3, 9), types.Root{3}, false},
+		{"surrounded", vote(11, 5, 7), types.Root{4}, false},
+		{"older than history", vote(9, 2, 3), types.Root{5}, false},
+		{"source after target", vote(12, 9, 8), types.Root{6}, false},
+		{"same checkpoints next slot", vote(11, 4, 8), types.Root{7}, true},
+		{"new source for the same target", vote(12, 5, 8), types.Root{8}, false},
+		{"later vote", vote(12, 8, 12), types.Root{9}, true},
+		{"earlier slot", vote(11, 8, 12), types.Root{9}, false},
+		{"older target", vote(13, 8, 11), types.Root{10}, false},
+	}
+	for _, tt := range tests {
+		err := db.CheckAndRecordAttestation(alice, tt.data, tt.root)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrSlashable) {
+			t.Errorf("%s: expected ErrSlashable, got %v", tt.name, err)
+		}
+	}
+
+	other := vote(13, 8, 12)
+	other.Target.Root = types.Root{0xee}
+	if err := db.CheckAndRecordAttestation(alice, other, types.Root{11}); !errors.Is(err, ErrSlashable) {
+		t.Errorf("another target block at the same target slot is a double vote, got %v", err)
+	}
+}
+
+func TestHistoryIsCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slashing.json")
+	db, err := Open(path, genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for slot := types.Slot(1); slot <= 50; slot++ {
+		if err := db.CheckAndRecordBlock(alice, slot, types.Root{byte(slot)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.CheckAndRecordAttestation(alice, vote(slot, slot-1, slot), types.Root{byte(slot)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := db.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), `"slot"`); n != 2 {
+		t.Errorf("export holds %d records, want one block and one attestation:\n%s", n, buf.String())
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slashing.json")
+	db, err := Open(path, genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.CheckAndRecordBlock(alice, 3, types.Root{1})
+	db.CheckAndRecordAttestation(alice, vote(3, 0, 2), types.Root{2})
+
+	db, err = Open(path, genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckAndRecordBlock(alice, 3, types.Root{9}); !errors.Is(err, ErrSlashable) {
+		t.Errorf("block history should survive a restart, got %v", err)
+	}
+	if err := db.CheckAndRecordAttestation(alice, vote(3, 0, 1), types.Root{9}); !errors.Is(err, ErrSlashable) {
+		t.Errorf("attestation history should survive a restart, got %v", err)
+	}
+
+	if _, err := Open(path, types.Root{0xbb}); err == nil {
+		t.Error("expected an error opening the database for another network")
+	}
+}
+
+func TestInterchange(t *testing.T) {
+	src, _ := Open("", genesis)
+	src.CheckAndRecordBlock(alice, 7, types.Root{1})
+	src.CheckAndRecordAttestation(alice, vote(7, 2, 6), types.Root{2})
+	src.CheckAndRecordAttestation(bob, vote(7, 2, 6), types.Root{3})
+
+	var buf bytes.Buffer
+	if err := src.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	exported := buf.String()
+	for _, want := range []string{`"interchange_format_version": "5"`, `"signed_blocks"`, `"source_slot": "2"`} {
+		if !strings.Contains(exported, want) {
+			t.Errorf("export lacks %s:\n%s", want, exported)
+		}
+	}
+
+	dst, _ := Open("", genesis)
+	dst.CheckAndRecordAttestation(alice, vote(9, 3, 8), types.Root{4})
+	if err := dst.Import(strings.NewReader(exported)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.CheckAndRecordBlock(alice, 7, types.Root{5}); !errors.Is(err, ErrSlashable) {
+		t.Errorf("imported block should be protected, got %v", err)
+	}
+	if err := dst.CheckAndRecordAttestation(bob, vote(7, 2, 6), types.Root{6}); !errors.Is(err, ErrSlashable) {
+		t.Errorf("imported attestation should be protected, got %v", err)
+	}
+	if err := dst.CheckAndRecordAttestation(alice, vote(9, 3, 8), types.Root{4}); err != nil {
+		t.Errorf("newer existing history should be kept: %v", err)
+	}
+
+	// Importing again changes nothing.
+	before := *dst.validators[alice].attestation
+	if err := dst.Import(strings.NewReader(exported)); err != nil {
+		t.Fatal(err)
+	}
+	if *dst.validators[alice].attestation != before {
+		t.Errorf("alice's watermark changed on re-import: %+v", *dst.validators[alice].attestation)
+	}
+
+	other, _ := Open("", types.Root{0xbb})
+	if err := other.Import(strings.NewReader(exported)); err == nil {
+		t.Error("expected genesis mismatch")
+	}
+	if err := dst.Import(strings.NewReader(strings.Replace(exported, `"5"`, `"4"`, 1))); err == nil {
+		t.Error("expected unsupported version")
+	}
+}
+
+func TestImportedUnknownRootsAreNotResigned(t *testing.T) {
+	doc := `{"metadata":{"interchange_format_version":"5","genesis_root":"0x` + strings.Repeat("00", 32) + `"},
+		"data":[{"pubkey":"0x01` + strings.Repeat("00", 51) + `","signed_blocks":[{"slot":"4"}],"signed_attestations":[]}]}`
+	db, _ := Open("", types.Root{})
+	if err := db.Import(strings.NewReader(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CheckAndRecordBlock(alice, 4, types.Root{}); !errors.Is(err, ErrSlashable) {
+		t.Errorf("a block with an unknown signing root must not be re-signed, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+// Package validator is the validator client: it produces blocks and
+// attestations for the validator keys it holds.
+package validator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/devlongs/gean/common/types"
+	"github.com/devlongs/gean/crypto/signature"
+	"github.com/devlongs/gean/p2p/gossip"
+)
+
+// Chain is the view of the local chain the validator client needs.
+// *chain.Chain implements it.
+type Chain interface {
+	Head() types.Checkpoint
+	HeadState() *types.State
+	Justified() types.Checkpoint
+	Finalized() types.Checkpoint
+	SafeTarget() types.Checkpoint
+	Block(root types.Root) (*types.SignedBlockWithAttestation, bool)
+	ImportBlock(ctx context.Context, block *types.SignedBlockWithAttestation) error
+}
+
+// Publisher broadcasts blocks and attestations. *gossip.Router implements
+// it.
+type Publisher interface {
+	PublishBlock(block *types.SignedBlockWithAttestation) gossip.MessageID
+	PublishAttestation(att *types.SignedAttestation) gossip.MessageID
+}
+
+// Protection refuses to sign messages that conflict with ones signed
+// before. *slashing.DB implements it.
+type Protection interface {
+	CheckAndRecordBlock(pubkey types.Bytes52, slot types.Slot, signingRoot types.Root) error
+	CheckAndRecordAttestation(pubkey types.Bytes52, data *types.AttestationData, signingRoot types.Root) error
+}
+
+// Keys holds the signers of our validators by validator index.
+type Keys map[types.ValidatorIndex]signature.Signer
+
+// BlockSigner is implemented by signers that want the block along with its
+// signing root, such as a remote signer that checks what it signs.
+type BlockSigner interface {
+	SignBlock(ctx context.Context, block *types.BlockWithAttestation, signingRoot types.Root) (types.Bytes3116, error)
+}
+
+// AttestationSigner is the attestation counterpart of BlockSigner.
+type AttestationSigner interface {
+	SignAttestation(ctx context.Context, data *types.AttestationData, signingRoot types.Root) (types.Bytes3116, error)
+}
+
+func signBlock(ctx context.Context, s signature.Signer, block *types.BlockWithAttestation, signingRoot types.Root) (types.Bytes3116, error) {
+	if bs, ok := s.(BlockSigner); ok {
+		return bs.SignBlock(ctx, block, signingRoot)
+	}
+	return s.Sign(signingRoot)
+}
+
+func signAttestation(ctx context.Context, s signature.Signer, data *types.AttestationData, signingRoot types.Root) (types.Bytes3116, error) {
+	if as, ok := s.(AttestationSigner); ok {
+		return as.SignAttestation(ctx, data, signingRoot)
+	}
+	return s.Sign(signingRoot)
+}
+
+// signer returns the signer for validator, checking that its key matches
+// the registry of state.
+func (k Keys) signer(state *types.State, validator types.ValidatorIndex) (signature.Signer, error) {
+	s, ok := k[validator]
+	if !ok {
+		return nil, fmt.Errorf("no key for validator %d", validator)
+	}
+	if uint64(validator) >= uint64(len(state.Validators)) {
+		return nil, fmt.Errorf("validator %d not in registry", validator)
+	}
+	if state.Validators[validator].Pubkey != s.PublicKey() {
+		return nil, fmt.Errorf("key for validator %d does not match the registry", validator)
+	}
+	return s, nil
+}
+
+// JustificationLookbackSlots bounds how far the attestation target is moved
+// back from the head towards the safe target.
+const JustificationLookbackSlots = 3
+
+// attestationTarget picks the target checkpoint for a vote on head with
+// source. The target starts at head, moves back up to
+// JustificationLookbackSlots blocks while it is newer than the safe target,
+// then back to the closest block whose slot can still be justified after
+// the finalized slot. parent is the parent root of head, so head need not
+// be in the chain yet.
+//
+// A target that is not after source counts for nothing. Past the anchor it
+// also conflicts with the votes that justified source, which had source as
+// their target. So if the safe target has not moved past a justified
+// source, the newest justifiable block after source is chosen instead. If
+// there is none, head is: the vote then only counts for fork choice but
+// still conflicts with nothing.
+func attestationTarget(c Chain, head types.Checkpoint, parent types.Root, source types.Checkpoint) types.Checkpoint {
+	finalized := c.Finalized()
+	safe := c.SafeTarget()
+	target, next := head, parent
+
+	back := func() bool {
+		block, ok := c.Block(next)
+		if !ok {
+			return false
+		}
+		target = types.Checkpoint{Root: next, Slot: block.Message.Block.Slot}
+		next = block.Message.Block.ParentRoot
+		return true
+	}
+	justifiable := func() bool {
+		return target.Slot <= finalized.Slot || target.Slot.IsJustifiableAfter(finalized.Slot)
+	}
+	for i := 0; i < JustificationLookbackSlots && target.Slot > safe.Slot; i++ {
+		if !back() {
+			target = finalized
+			break
+		}
+	}
+	for !justifiable() {
+		if !back() {
+			target = finalized
+			break
+		}
+	}
+	if target.Slot > source.Slot || source.Slot <= finalized.Slot {
+		return target
+	}
+
+	target, next = head, parent
+	for target.Slot > source.Slot {
+		if justifiable() {
+			return target
+		}
+		if !back() {
+			break
+		}
+	}
+	if head.Slot > source.Slot {
+		return head
+	}
+	return source
+}